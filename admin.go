@@ -0,0 +1,110 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SECTION: ADMIN LISTENER
+
+// adminListener describes where admin endpoints are served when -admin-listen is set
+type adminListener struct {
+	network string // "tcp" or "unix"
+	address string
+}
+
+// parseAdminListen parses -admin-listen: "unix:/path" or an absolute path for a
+// Unix socket, otherwise a TCP host:port (or :port, which binds to loopback)
+func parseAdminListen(addr string) (*adminListener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok || filepath.IsAbs(addr) {
+		if !ok {
+			path = addr
+		}
+		if !filepath.IsAbs(path) {
+			return nil, fmt.Errorf("unix socket path must be absolute: %q", path)
+		}
+		return &adminListener{network: "unix", address: path}, nil
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: use host:port or unix:/path", addr)
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return &adminListener{network: "tcp", address: net.JoinHostPort(host, port)}, nil
+}
+
+// String returns the listener address for log lines
+func (a *adminListener) String() string {
+	if a.network == "unix" {
+		return "unix:" + a.address
+	}
+	return a.address
+}
+
+// Listen opens the listener. Unix sockets replace a stale socket and are
+// restricted to the owner; TCP addresses that are not loopback get a warning.
+func (a *adminListener) Listen() (net.Listener, error) {
+	if a.network == "unix" {
+		if err := os.MkdirAll(filepath.Dir(a.address), 0700); err != nil {
+			return nil, err
+		}
+		if info, err := os.Lstat(a.address); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(a.address)
+		}
+		l, err := net.Listen("unix", a.address)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(a.address, 0600); err != nil {
+			l.Close()
+			return nil, err
+		}
+		return l, nil
+	}
+
+	host, _, _ := net.SplitHostPort(a.address)
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		log.Printf("Warning: admin listener %s is not loopback-only", a.address)
+	}
+	return net.Listen("tcp", a.address)
+}
+
+// adminOnly answers admin endpoints on the public listener when a separate admin listener is configured
+func adminOnly(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "Forbidden: admin endpoints are only served on the admin listener", http.StatusForbidden)
+}
+
+// handlePublicSettings serves settings reads on the public listener; writes
+// go to the admin listener
+func (s *Server) handlePublicSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		adminOnly(w, r)
+		return
+	}
+	s.handleSettings(w, r)
+}
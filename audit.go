@@ -0,0 +1,284 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SECTION: AUDIT
+
+// Audit event types
+const (
+	AuditSessionCreate  = "session.create"
+	AuditSessionClose   = "session.close"
+	AuditSessionRename  = "session.rename"
+	AuditSessionACL     = "session.acl"
+	AuditKeysSend       = "keys.send"
+	AuditFileUpload     = "file.upload"
+	AuditFileDownload   = "file.download"
+	AuditMarkedDownload = "file.download-marked"
+	AuditSettingsWrite  = "settings.write"
+	AuditClipboardWrite = "clipboard.write"
+	AuditShareCreate    = "share.create"
+	AuditShareRevoke    = "share.revoke"
+	AuditProjectTrust   = "project.trust"
+)
+
+const (
+	// Default and maximum number of events returned by /api/audit
+	defaultAuditLimit = 1000
+	maxAuditLimit     = 10000
+)
+
+// AuditEvent is one line of the audit log
+type AuditEvent struct {
+	Time    time.Time      `json:"time"`
+	Type    string         `json:"type"`
+	User    string         `json:"user,omitempty"`
+	Remote  string         `json:"remote,omitempty"`
+	Token   string         `json:"token,omitempty"` // name of the API token used, if any
+	Session string         `json:"session,omitempty"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// AuditLog appends events as JSON lines to a file that is never truncated
+type AuditLog struct {
+	path string
+	file *os.File
+	mu   sync.Mutex
+}
+
+// auditLogPath returns the default audit log location
+func auditLogPath() string {
+	return filepath.Join(xdgStateHome(), "webmux", "audit.jsonl")
+}
+
+// NewAuditLog opens (or creates) the audit log at path for appending.
+// An empty path disables auditing and returns nil.
+func NewAuditLog(path string) (*AuditLog, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{path: path, file: file}, nil
+}
+
+// Record appends an event attributed to the client of r. It is a no-op on a nil log.
+func (a *AuditLog) Record(r *http.Request, eventType, sessionID string, details map[string]any) {
+	if a == nil {
+		return
+	}
+	// Details can carry text typed or printed in a terminal (e.g. session names)
+	for key, value := range details {
+		if text, ok := value.(string); ok {
+			details[key] = redactor.Redact(text)
+		}
+	}
+	event := AuditEvent{
+		Time:    time.Now().UTC(),
+		Type:    eventType,
+		Session: sessionID,
+		Details: details,
+	}
+	if r != nil {
+		event.User = requestUser(r)
+		event.Remote = clientAddr(r)
+		// wm calls from a terminal carry that session's token
+		if token, ok := r.Context().Value(tokenContextKey{}).(*APIToken); ok {
+			event.Token = token.Name
+			if event.Session == "" {
+				event.Session = token.SessionID
+			}
+		}
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Audit: failed to encode %s event: %v", eventType, err)
+		return
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// A single write per line keeps lines whole even if another process appends
+	if _, err := a.file.Write(line); err != nil {
+		log.Printf("Audit: failed to write %s event: %v", eventType, err)
+	}
+}
+
+// auditFilter selects events by time range and type
+type auditFilter struct {
+	since, until time.Time
+	types        []string // exact types, categories ("session") or "prefix*" patterns
+	limit        int
+}
+
+// matches reports whether the event passes the filter
+func (f *auditFilter) matches(e *AuditEvent) bool {
+	if !f.since.IsZero() && e.Time.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && e.Time.After(f.until) {
+		return false
+	}
+	if len(f.types) == 0 {
+		return true
+	}
+	for _, t := range f.types {
+		if t == e.Type {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(t, "*"); ok && strings.HasPrefix(e.Type, prefix) {
+			return true
+		}
+		if !strings.Contains(t, ".") && strings.HasPrefix(e.Type, t+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Query returns the most recent events matching f, oldest first
+func (a *AuditLog) Query(f *auditFilter) ([]AuditEvent, error) {
+	file, err := os.Open(a.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	events := make([]AuditEvent, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue // Skip a torn or hand-edited line rather than failing the query
+		}
+		if !f.matches(&e) {
+			continue
+		}
+		events = append(events, e)
+		// Keep only the newest limit events
+		if len(events) > f.limit*2 {
+			events = append(events[:0], events[len(events)-f.limit:]...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(events) > f.limit {
+		events = events[len(events)-f.limit:]
+	}
+	return events, nil
+}
+
+// Close closes the audit log file
+func (a *AuditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file.Close()
+}
+
+// parseAuditTime accepts RFC 3339, Unix seconds, or a duration meaning "that long ago"
+func parseAuditTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use RFC 3339, Unix seconds or a duration like 24h)", value)
+}
+
+// handleAudit returns audit events: GET /api/audit?since=&until=&type=&limit=
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isAdmin(r, s.multiUser) {
+		http.Error(w, "Forbidden: the audit log is admin only", http.StatusForbidden)
+		return
+	}
+	if s.audit == nil {
+		http.Error(w, "Audit log is disabled", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := &auditFilter{limit: defaultAuditLimit}
+	var err error
+	if v := query.Get("since"); v != "" {
+		if filter.since, err = parseAuditTime(v); err != nil {
+			http.Error(w, "since: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("until"); v != "" {
+		if filter.until, err = parseAuditTime(v); err != nil {
+			http.Error(w, "until: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	for _, v := range query["type"] {
+		filter.types = append(filter.types, splitList(v)...)
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.limit = min(n, maxAuditLimit)
+	}
+
+	events, err := s.audit.Query(filter)
+	if err != nil {
+		log.Printf("Audit query failed: %v", err)
+		http.Error(w, "Failed to read audit log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(events)
+}
@@ -0,0 +1,708 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SECTION: AUTH
+
+const (
+	// Cookie holding the browser login session token
+	authCookieName = "webmux_session"
+	// How long a browser login stays valid
+	authSessionTTL = 7 * 24 * time.Hour
+	// PBKDF2 parameters for the stored password hash
+	pbkdf2Iterations = 600000
+	pbkdf2KeyLength  = 32
+	// Minimum accepted password length for -set-password
+	minPasswordLength = 8
+)
+
+// authPublicPaths are reachable without logging in (the login page and its assets)
+var authPublicPaths = map[string]bool{
+	"/login.html":      true,
+	"/favicon.ico":     true,
+	"/api/auth/login":  true,
+	"/api/auth/status": true,
+}
+
+// AuthConfig is the on-disk auth configuration (hashes and the TOTP secret, never the password)
+type AuthConfig struct {
+	PasswordHash  string   `json:"passwordHash"`            // pbkdf2-sha256$<iterations>$<salt>$<hash>
+	TOTPSecret    string   `json:"totpSecret,omitempty"`    // base32 RFC 6238 secret; empty = no second factor
+	RecoveryCodes []string `json:"recoveryCodes,omitempty"` // SHA-256 hashes of unused recovery codes
+
+	// Named accounts added with -add-user; each logs in to its own namespace
+	Users map[string]*UserAccount `json:"users,omitempty"`
+}
+
+// UserAccount is a named login account
+type UserAccount struct {
+	PasswordHash string `json:"passwordHash"`
+}
+
+// authSession is a logged-in browser session
+type authSession struct {
+	user      string // named account, empty for the shared password
+	createdAt time.Time
+	expiresAt time.Time
+	done      chan struct{} // closed on logout/expiry to tear down long-lived connections
+}
+
+// AuthManager handles password verification, login sessions, API tokens and the auth middleware
+type AuthManager struct {
+	enabled   bool
+	config    *AuthConfig
+	configMod time.Time               // auth.json mtime, to pick up -set-password/-reset-totp while running
+	sessions  map[string]*authSession // token -> session
+	mu        sync.Mutex
+	tokens    *TokenStore    // API tokens for wm and automation clients
+	totp      totpState      // pending enrollment and replay protection
+	proxy     *proxyIdentity // trusted reverse-proxy identity header (nil = off)
+	multiUser bool           // Tokens belong to their user (-multi-user)
+}
+
+// tokenContextKey is the context key for the API token that authenticated a request
+type tokenContextKey struct{}
+
+// stdinReader is shared so consecutive password prompts don't drop buffered input
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// authFilePath returns the path to the auth config file
+func authFilePath() string {
+	return filepath.Join(xdgConfigHome(), "webmux", "auth.json")
+}
+
+// LoadAuthConfig loads the auth config from disk (nil if no password is set)
+func LoadAuthConfig() (*AuthConfig, error) {
+	data, err := os.ReadFile(authFilePath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var config AuthConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid auth config %s: %w", authFilePath(), err)
+	}
+	if config.PasswordHash == "" && len(config.Users) == 0 {
+		return nil, nil
+	}
+	return &config, nil
+}
+
+// SaveAuthConfig writes the auth config with owner-only permissions
+func SaveAuthConfig(config *AuthConfig) error {
+	path := authFilePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0600)
+}
+
+// hashPassword derives a PBKDF2-SHA256 hash with a random salt
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, pbkdf2Iterations, pbkdf2KeyLength)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", pbkdf2Iterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// verifyPassword checks a password against a stored hash in constant time
+func verifyPassword(password, stored string) bool {
+	parts := strings.Split(stored, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(expected))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, expected) == 1
+}
+
+// randomToken returns n random bytes encoded as hex
+func randomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand never fails on supported platforms
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// NewAuthManager creates an auth manager; when enabled, a password must be configured
+func NewAuthManager(enabled bool) (*AuthManager, error) {
+	tokens, err := NewTokenStore()
+	if err != nil {
+		return nil, err
+	}
+	a := &AuthManager{
+		enabled:  enabled,
+		sessions: make(map[string]*authSession),
+		tokens:   tokens,
+	}
+	if !enabled {
+		return a, nil
+	}
+
+	config, err := LoadAuthConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, fmt.Errorf("no password set; run 'webmux -set-password' or 'webmux -add-user NAME' first")
+	}
+	a.config = config
+	if info, err := os.Stat(authFilePath()); err == nil {
+		a.configMod = info.ModTime()
+	}
+	return a, nil
+}
+
+// currentConfig returns the auth config, reloading auth.json if it changed on disk
+func (a *AuthManager) currentConfig() AuthConfig {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if info, err := os.Stat(authFilePath()); err == nil && !info.ModTime().Equal(a.configMod) {
+		if config, err := LoadAuthConfig(); err != nil {
+			log.Printf("Failed to reload auth config: %v", err)
+		} else if config != nil {
+			a.config = config
+			a.configMod = info.ModTime()
+			log.Printf("Reloaded auth config from %s", authFilePath())
+		}
+	}
+	return *a.config
+}
+
+// saveConfig persists the auth config
+// Must be called with a.mu held
+func (a *AuthManager) saveConfig() error {
+	if err := SaveAuthConfig(a.config); err != nil {
+		return err
+	}
+	if info, err := os.Stat(authFilePath()); err == nil {
+		a.configMod = info.ModTime()
+	}
+	return nil
+}
+
+// Enabled reports whether password login is required
+func (a *AuthManager) Enabled() bool {
+	return a.enabled
+}
+
+// Required reports whether requests must be authenticated (password login or proxy identity)
+func (a *AuthManager) Required() bool {
+	return a.enabled || a.proxy != nil
+}
+
+// IssueSessionToken returns a token for wm inside a terminal session, acting as
+// its owner (empty when auth is off)
+func (a *AuthManager) IssueSessionToken(sessionID, owner string) string {
+	if !a.Required() {
+		return ""
+	}
+	return a.tokens.IssueSessionToken(sessionID, owner)
+}
+
+// RestoreSessionToken re-registers a reattached session's token (no-op when auth is off)
+func (a *AuthManager) RestoreSessionToken(sessionID, owner, hash string) {
+	if !a.Required() {
+		return
+	}
+	a.tokens.RestoreSessionToken(sessionID, owner, hash)
+}
+
+// createSession creates a new login session for user (empty for the shared password) and returns its token
+func (a *AuthManager) createSession(user string) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Drop expired sessions while we hold the lock
+	now := time.Now()
+	for token, sess := range a.sessions {
+		if now.After(sess.expiresAt) {
+			close(sess.done)
+			delete(a.sessions, token)
+		}
+	}
+
+	token := randomToken(32)
+	a.sessions[token] = &authSession{
+		user:      user,
+		createdAt: now,
+		expiresAt: now.Add(authSessionTTL),
+		done:      make(chan struct{}),
+	}
+	return token
+}
+
+// lookupSession returns the session for a token if it exists and has not expired
+func (a *AuthManager) lookupSession(token string) (*authSession, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	sess, ok := a.sessions[token]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(sess.expiresAt) {
+		close(sess.done)
+		delete(a.sessions, token)
+		return nil, false
+	}
+	return sess, true
+}
+
+// revokeSession ends a login session and closes its long-lived connections
+func (a *AuthManager) revokeSession(token string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if sess, ok := a.sessions[token]; ok {
+		close(sess.done)
+		delete(a.sessions, token)
+	}
+}
+
+// sessionUser returns the named account of the request's login session, if any
+func (a *AuthManager) sessionUser(r *http.Request) string {
+	if cookie, err := r.Cookie(authCookieName); err == nil && cookie.Value != "" {
+		if sess, ok := a.lookupSession(cookie.Value); ok {
+			return sess.user
+		}
+	}
+	return ""
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer" header
+func bearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(h, "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// authenticate checks the request for a valid login cookie or API token.
+// Returns the login session or token that matched and whether the request is authenticated.
+func (a *AuthManager) authenticate(r *http.Request) (*authSession, *APIToken, bool) {
+	if cookie, err := r.Cookie(authCookieName); err == nil && cookie.Value != "" {
+		if sess, ok := a.lookupSession(cookie.Value); ok {
+			return sess, nil, true
+		}
+	}
+
+	if secret := bearerToken(r); secret != "" {
+		if token, ok := a.tokens.Lookup(secret); ok {
+			return nil, token, true
+		}
+	}
+
+	return nil, nil, false
+}
+
+// Middleware rejects unauthenticated requests before they reach the mux.
+// WebSocket upgrades and SSE streams are tied to the login session and
+// are torn down when the user logs out.
+func (a *AuthManager) Middleware(next http.Handler) http.Handler {
+	if !a.Required() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Share links carry their own token and are checked by the share handler
+		if authPublicPaths[r.URL.Path] || strings.HasPrefix(r.URL.Path, "/s/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// A trusted proxy vouches for the user on every request
+		ctx := r.Context()
+		if a.proxy != nil {
+			if user := a.proxy.user(r); user != "" {
+				next.ServeHTTP(w, r.WithContext(withUser(ctx, user)))
+				return
+			}
+		}
+
+		sess, token, ok := a.authenticate(r)
+		if !ok {
+			if !a.enabled {
+				http.Error(w, fmt.Sprintf("Unauthorized: missing %s header from a trusted proxy", a.proxy.header),
+					http.StatusUnauthorized)
+				return
+			}
+			// Send browsers loading the app to the login page; everything else gets 401
+			if r.Method == http.MethodGet && (r.URL.Path == "/" || r.URL.Path == "/index.html") {
+				http.Redirect(w, r, "login.html", http.StatusFound)
+				return
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		// API tokens only reach routes covered by their scopes
+		if token != nil {
+			if scope := routeScope(r); !token.Allows(scope) {
+				http.Error(w, fmt.Sprintf("Forbidden: token lacks scope %q", scope), http.StatusForbidden)
+				return
+			}
+			ctx = context.WithValue(ctx, tokenContextKey{}, token)
+			if token.User != "" {
+				ctx = withUser(ctx, token.User)
+			}
+		}
+		if sess != nil {
+			if sess.user != "" {
+				ctx = withUser(ctx, sess.user)
+			}
+			// Cancel the request context when the login session ends so that
+			// SSE streams and proxied terminal WebSockets are closed
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithCancel(ctx)
+			defer cancel()
+			go func() {
+				select {
+				case <-sess.done:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// isSecureRequest reports whether the client connection uses HTTPS; X-Forwarded-Proto
+// is only believed from a trusted proxy
+func isSecureRequest(r *http.Request) bool {
+	return r.TLS != nil || (r.Header.Get("X-Forwarded-Proto") == "https" && fromTrustedProxy(r))
+}
+
+// handleLogin verifies the password (and TOTP or recovery code when enrolled) and sets the session cookie.
+// With a username, the password of that account is checked instead of the shared one.
+// POST /api/auth/login {"username": "...", "password": "...", "code": "..."}
+func (a *AuthManager) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.enabled {
+		http.Error(w, "Password login is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"` // empty = shared password
+		Password string `json:"password"`
+		Code     string `json:"code"` // TOTP or recovery code
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	config := a.currentConfig()
+	stored := config.PasswordHash
+	if req.Username != "" {
+		stored = ""
+		if account, ok := config.Users[req.Username]; ok {
+			stored = account.PasswordHash
+		}
+	}
+	if stored == "" || !verifyPassword(req.Password, stored) {
+		log.Printf("Failed login from %s", r.RemoteAddr)
+		// Slow down brute-force attempts
+		time.Sleep(time.Second)
+		http.Error(w, "Invalid password", http.StatusUnauthorized)
+		return
+	}
+
+	// The second factor is enrolled for the shared password only
+	if config.TOTPSecret != "" && req.Username == "" {
+		if strings.TrimSpace(req.Code) == "" {
+			http.Error(w, "Authentication code required", http.StatusUnauthorized)
+			return
+		}
+		if !a.verifySecondFactor(req.Code) {
+			log.Printf("Failed login from %s: invalid authentication code", r.RemoteAddr)
+			time.Sleep(time.Second)
+			http.Error(w, "Invalid authentication code", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	token := a.createSession(req.Username)
+	http.SetCookie(w, &http.Cookie{
+		Name:     authCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(authSessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+	if req.Username != "" {
+		log.Printf("Login as %s from %s", req.Username, clientDescription(r))
+	} else {
+		log.Printf("Login from %s", clientDescription(r))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// handleLogout ends the current login session and clears the cookie
+// POST /api/auth/logout
+func (a *AuthManager) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if cookie, err := r.Cookie(authCookieName); err == nil {
+		a.revokeSession(cookie.Value)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     authCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "logged out"})
+}
+
+// handleAuthStatus reports whether auth is enabled, the request is logged in (and as whom),
+// and whether the login form needs a user name or an authentication code
+// GET /api/auth/status
+func (a *AuthManager) handleAuthStatus(w http.ResponseWriter, r *http.Request) {
+	_, _, authenticated := a.authenticate(r)
+	var user string
+	if a.proxy != nil {
+		user = a.proxy.user(r)
+	}
+	if user == "" {
+		user = a.sessionUser(r)
+	}
+	var config AuthConfig
+	if a.enabled {
+		config = a.currentConfig()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"enabled":       a.enabled,
+		"authenticated": !a.Required() || authenticated || user != "",
+		"totp":          config.TOTPSecret != "",
+		"users":         len(config.Users) > 0,
+		"user":          user,
+	})
+}
+
+// readPassword reads a line from stdin, disabling echo when stdin is a terminal
+func readPassword(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		stty := exec.Command("stty", "-echo")
+		stty.Stdin = os.Stdin
+		if stty.Run() == nil {
+			defer func() {
+				restore := exec.Command("stty", "echo")
+				restore.Stdin = os.Stdin
+				restore.Run()
+				fmt.Fprintln(os.Stderr)
+			}()
+		}
+	}
+
+	line, err := stdinReader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// promptPasswordHash prompts for a new password twice and returns its hash
+func promptPasswordHash() (string, error) {
+	password, err := readPassword("New password: ")
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	if len(password) < minPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	confirm, err := readPassword("Confirm password: ")
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	if password != confirm {
+		return "", fmt.Errorf("passwords do not match")
+	}
+	return hashPassword(password)
+}
+
+// runSetPassword prompts for a new password and stores its hash
+func runSetPassword() error {
+	hash, err := promptPasswordHash()
+	if err != nil {
+		return err
+	}
+
+	config, err := LoadAuthConfig()
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		config = &AuthConfig{}
+	}
+	config.PasswordHash = hash
+	if err := SaveAuthConfig(config); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Password saved to %s\n", authFilePath())
+	return nil
+}
+
+// runAddUser prompts for the password of a named account and stores its hash,
+// replacing the password if the account exists
+func runAddUser(name string) error {
+	if !validUserName(name) {
+		return fmt.Errorf("invalid user name %q", name)
+	}
+	fmt.Fprintf(os.Stderr, "Setting password for %s\n", name)
+	hash, err := promptPasswordHash()
+	if err != nil {
+		return err
+	}
+
+	config, err := LoadAuthConfig()
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		config = &AuthConfig{}
+	}
+	if config.Users == nil {
+		config.Users = make(map[string]*UserAccount)
+	}
+	config.Users[name] = &UserAccount{PasswordHash: hash}
+	if err := SaveAuthConfig(config); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "User %s saved to %s\n", name, authFilePath())
+	return nil
+}
+
+// runRemoveUser deletes a named account. Its sessions and files are left alone.
+func runRemoveUser(name string) error {
+	config, err := LoadAuthConfig()
+	if err != nil {
+		return err
+	}
+	if config == nil || config.Users[name] == nil {
+		return fmt.Errorf("no such user: %s", name)
+	}
+	delete(config.Users, name)
+	if err := SaveAuthConfig(config); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "User %s removed from %s\n", name, authFilePath())
+	return nil
+}
+
+// stripAuthCookie removes the login cookie from headers forwarded to ttyd
+func stripAuthCookie(header http.Header) {
+	cookies := header.Values("Cookie")
+	if len(cookies) == 0 {
+		return
+	}
+	header.Del("Cookie")
+	for _, line := range cookies {
+		var kept []string
+		for part := range strings.SplitSeq(line, ";") {
+			name, _, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name != authCookieName && strings.TrimSpace(part) != "" {
+				kept = append(kept, strings.TrimSpace(part))
+			}
+		}
+		if len(kept) > 0 {
+			header.Add("Cookie", strings.Join(kept, "; "))
+		}
+	}
+}
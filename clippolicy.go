@@ -0,0 +1,298 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// SECTION: CLIPBOARD POLICY
+
+// OSC 52 clipboard write policies, set globally with -osc52 and per session
+const (
+	ClipboardAllow   = "allow"   // write the server clipboard immediately
+	ClipboardDeny    = "deny"    // drop the write
+	ClipboardConfirm = "confirm" // hold the write until a browser approves it
+)
+
+const (
+	// Writes waiting for approval are dropped after this long
+	pendingClipboardTTL = 5 * time.Minute
+	// At most this many writes wait for approval; the oldest is dropped first
+	maxPendingClipboard = 20
+	// Characters of a pending write shown to the approver
+	clipboardPreviewLen = 200
+	// The same text from a session within this long is one write seen by several tabs
+	osc52DedupWindow = 2 * time.Second
+)
+
+// validClipboardPolicy reports whether p is a known policy
+func validClipboardPolicy(p string) bool {
+	return p == ClipboardAllow || p == ClipboardDeny || p == ClipboardConfirm
+}
+
+// ClipboardRequest is an OSC 52 write held for approval
+type ClipboardRequest struct {
+	ID          string    `json:"id"`
+	SessionID   string    `json:"sessionId"`
+	SessionName string    `json:"sessionName,omitempty"`
+	Bytes       int       `json:"bytes"`
+	Preview     string    `json:"preview"`
+	CreatedAt   time.Time `json:"createdAt"`
+
+	text string
+}
+
+// osc52Write is the last OSC 52 write handled for a session
+type osc52Write struct {
+	sum [sha256.Size]byte
+	at  time.Time
+}
+
+// clipboardPreview shortens text for display to the approver
+func clipboardPreview(text string) string {
+	if utf8.RuneCountInString(text) <= clipboardPreviewLen {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:clipboardPreviewLen]) + "…"
+}
+
+// setClipboard replaces the server clipboard and bumps its version so browsers pick it up
+func (s *Server) setClipboard(text string) {
+	s.clipboardMu.Lock()
+	s.clipboard = text
+	s.clipboardVersion++
+	s.clipboardMu.Unlock()
+}
+
+// SetClipboardPolicy sets a session's OSC 52 policy ("" = server default)
+func (sm *SessionManager) SetClipboardPolicy(id, policy string) error {
+	if policy != "" && !validClipboardPolicy(policy) {
+		return fmt.Errorf("invalid OSC 52 policy %q (use allow, deny or confirm)", policy)
+	}
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, ok := sm.sessions[id]
+	if !ok {
+		return fmt.Errorf("session not found: %s", id)
+	}
+	session.OSC52Policy = policy
+	sm.setTmuxOption(session, tmuxOptOSC52, policy)
+	return nil
+}
+
+// clipboardPolicyFor returns the effective OSC 52 policy and name of a session
+func (s *Server) clipboardPolicyFor(sessionID string) (policy, name string) {
+	s.manager.mu.RLock()
+	defer s.manager.mu.RUnlock()
+
+	policy = s.clipboardPolicy
+	if session, ok := s.manager.sessions[sessionID]; ok {
+		name = session.Name
+		if session.OSC52Policy != "" {
+			policy = session.OSC52Policy
+		}
+	}
+	return policy, name
+}
+
+// handleOSC52Write applies the session's policy to a clipboard write found in its output.
+// r is the terminal connection the sequence arrived on.
+func (s *Server) handleOSC52Write(r *http.Request, sessionID, text string) {
+	// Every browser tab on the session sees the same sequence; the policy,
+	// rate limit and audit record apply to it once
+	if s.repeatedOSC52Write(sessionID, text, time.Now()) {
+		return
+	}
+	// A program flooding the clipboard is limited like POST /api/clipboard,
+	// charged to its session; the limiter logs when it starts dropping writes
+	if ok, _ := s.limiter.Allow(RateClipboard, "session:"+sessionID); !ok {
+		return
+	}
+	policy, name := s.clipboardPolicyFor(sessionID)
+	details := map[string]any{"source": "osc52", "bytes": len(text), "policy": policy}
+
+	switch policy {
+	case ClipboardDeny:
+		details["decision"] = "denied"
+		log.Printf("Blocked OSC 52 clipboard write (%d bytes) from session %s", len(text), sessionID)
+
+	case ClipboardConfirm:
+		s.clipboardMu.Lock()
+		s.prunePendingClipboard(time.Now())
+		// A write repeated after the dedup window is still held once
+		for _, p := range s.clipboardPending {
+			if p.SessionID == sessionID && p.text == text {
+				s.clipboardMu.Unlock()
+				return
+			}
+		}
+		req := &ClipboardRequest{
+			ID:          randomToken(6),
+			SessionID:   sessionID,
+			SessionName: name,
+			Bytes:       len(text),
+			Preview:     redactor.RedactFor(s.user, clipboardPreview(text)),
+			CreatedAt:   time.Now(),
+			text:        text,
+		}
+		s.clipboardPending = append(s.clipboardPending, req)
+		if len(s.clipboardPending) > maxPendingClipboard {
+			s.clipboardPending = s.clipboardPending[len(s.clipboardPending)-maxPendingClipboard:]
+		}
+		s.pendingVersion++
+		s.clipboardMu.Unlock()
+		details["decision"] = "pending"
+		details["request"] = req.ID
+
+	default:
+		s.setClipboard(text)
+		details["decision"] = "allowed"
+	}
+	s.audit.Record(r, AuditClipboardWrite, sessionID, details)
+}
+
+// repeatedOSC52Write records a write and reports whether the session sent the same
+// text within osc52DedupWindow, i.e. it is another tab's copy of a handled write
+func (s *Server) repeatedOSC52Write(sessionID, text string, now time.Time) bool {
+	sum := sha256.Sum256([]byte(text))
+
+	s.clipboardMu.Lock()
+	defer s.clipboardMu.Unlock()
+
+	if last, ok := s.osc52Recent[sessionID]; ok && last.sum == sum && now.Sub(last.at) < osc52DedupWindow {
+		return true
+	}
+	if s.osc52Recent == nil {
+		s.osc52Recent = make(map[string]osc52Write)
+	}
+	s.osc52Recent[sessionID] = osc52Write{sum: sum, at: now}
+	return false
+}
+
+// prunePendingClipboard drops expired requests. Must be called with s.clipboardMu held.
+func (s *Server) prunePendingClipboard(now time.Time) {
+	kept := s.clipboardPending[:0]
+	for _, p := range s.clipboardPending {
+		if now.Sub(p.CreatedAt) < pendingClipboardTTL {
+			kept = append(kept, p)
+		}
+	}
+	if len(kept) != len(s.clipboardPending) {
+		s.pendingVersion++
+	}
+	s.clipboardPending = kept
+}
+
+// dropPendingClipboard discards requests from a closed session
+func (s *Server) dropPendingClipboard(sessionID string) {
+	s.clipboardMu.Lock()
+	defer s.clipboardMu.Unlock()
+
+	delete(s.osc52Recent, sessionID)
+
+	kept := s.clipboardPending[:0]
+	for _, p := range s.clipboardPending {
+		if p.SessionID != sessionID {
+			kept = append(kept, p)
+		}
+	}
+	if len(kept) != len(s.clipboardPending) {
+		s.pendingVersion++
+	}
+	s.clipboardPending = kept
+}
+
+// handleClipboardPending lists clipboard writes waiting for approval
+// GET /api/clipboard/pending
+func (s *Server) handleClipboardPending(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.clipboardMu.Lock()
+	s.prunePendingClipboard(time.Now())
+	pending := make([]*ClipboardRequest, len(s.clipboardPending))
+	copy(pending, s.clipboardPending)
+	s.clipboardMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(pending)
+}
+
+// handleClipboardDecision approves or rejects a pending clipboard write
+// POST /api/clipboard/pending/{id} {"approve": true}
+func (s *Server) handleClipboardDecision(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// A program in the requesting session must not approve its own write
+	if sessionBoundToken(r) {
+		http.Error(w, "Forbidden: session tokens cannot approve clipboard writes", http.StatusForbidden)
+		return
+	}
+
+	var body struct {
+		Approve bool `json:"approve"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/clipboard/pending/")
+	s.clipboardMu.Lock()
+	s.prunePendingClipboard(time.Now())
+	var req *ClipboardRequest
+	for i, p := range s.clipboardPending {
+		if p.ID == id {
+			req = p
+			s.clipboardPending = append(s.clipboardPending[:i], s.clipboardPending[i+1:]...)
+			s.pendingVersion++
+			break
+		}
+	}
+	s.clipboardMu.Unlock()
+	if req == nil {
+		http.Error(w, "clipboard request not found", http.StatusNotFound)
+		return
+	}
+
+	decision := "rejected"
+	if body.Approve {
+		s.setClipboard(req.text)
+		decision = "approved"
+	}
+	log.Printf("OSC 52 clipboard write from session %s %s by %s", req.SessionID, decision, clientDescription(r))
+	s.audit.Record(r, AuditClipboardWrite, req.SessionID, map[string]any{
+		"source": "osc52", "bytes": req.Bytes, "decision": decision, "request": req.ID,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
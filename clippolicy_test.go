@@ -0,0 +1,150 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newClipboardTestServer returns a server with one session, "s1", using sessionPolicy
+func newClipboardTestServer(serverPolicy, sessionPolicy string) *Server {
+	manager := &SessionManager{sessions: map[string]*Session{
+		"s1": {ID: "s1", Name: "one", OSC52Policy: sessionPolicy},
+	}}
+	limiter, err := NewRateLimiter("")
+	if err != nil {
+		panic(err)
+	}
+	return &Server{manager: manager, clipboardPolicy: serverPolicy, limiter: limiter}
+}
+
+func TestHandleOSC52Write(t *testing.T) {
+	tests := []struct {
+		name          string
+		server        string // -osc52
+		session       string // per-session override
+		id            string
+		wantClipboard string
+		wantPending   int
+	}{
+		{"allow", ClipboardAllow, "", "s1", "copied", 0},
+		{"deny", ClipboardDeny, "", "s1", "", 0},
+		{"confirm", ClipboardConfirm, "", "s1", "", 1},
+		{"session overrides deny", ClipboardDeny, ClipboardAllow, "s1", "copied", 0},
+		{"session overrides allow", ClipboardAllow, ClipboardConfirm, "s1", "", 1},
+		{"unknown session uses default", ClipboardDeny, ClipboardAllow, "s2", "", 0},
+	}
+	for _, tt := range tests {
+		s := newClipboardTestServer(tt.server, tt.session)
+		s.handleOSC52Write(httptest.NewRequest("GET", "/t/"+tt.id+"/ws", nil), tt.id, "copied")
+		if s.clipboard != tt.wantClipboard {
+			t.Errorf("%s: clipboard = %q, want %q", tt.name, s.clipboard, tt.wantClipboard)
+		}
+		if len(s.clipboardPending) != tt.wantPending {
+			t.Errorf("%s: %d pending, want %d", tt.name, len(s.clipboardPending), tt.wantPending)
+		}
+	}
+}
+
+func TestHandleOSC52WriteConfirmOnce(t *testing.T) {
+	s := newClipboardTestServer(ClipboardConfirm, "")
+	r := httptest.NewRequest("GET", "/t/s1/ws", nil)
+	// Each browser tab on the session reports the same sequence
+	s.handleOSC52Write(r, "s1", "copied")
+	s.handleOSC52Write(r, "s1", "copied")
+	s.handleOSC52Write(r, "s1", "other")
+	if len(s.clipboardPending) != 2 {
+		t.Fatalf("%d pending, want 2", len(s.clipboardPending))
+	}
+	p := s.clipboardPending[0]
+	if p.SessionID != "s1" || p.SessionName != "one" || p.Bytes != len("copied") || p.Preview != "copied" {
+		t.Errorf("pending request = %+v", p)
+	}
+}
+
+func TestHandleOSC52WriteRateLimit(t *testing.T) {
+	s := newClipboardTestServer(ClipboardAllow, "")
+	var err error
+	if s.limiter, err = NewRateLimiter("clipboard=2/1m"); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", "/t/s1/ws", nil)
+	for _, text := range []string{"one", "two", "three"} {
+		s.handleOSC52Write(r, "s1", text)
+	}
+	if s.clipboard != "two" {
+		t.Errorf("clipboard = %q, want the third write dropped", s.clipboard)
+	}
+	// The limit is per session
+	s.manager.sessions["s2"] = &Session{ID: "s2"}
+	s.handleOSC52Write(r, "s2", "four")
+	if s.clipboard != "four" {
+		t.Errorf("clipboard = %q, want another session's write applied", s.clipboard)
+	}
+}
+
+func TestHandleOSC52WriteOncePerTabs(t *testing.T) {
+	s := newClipboardTestServer(ClipboardAllow, "")
+	var err error
+	if s.limiter, err = NewRateLimiter("clipboard=1/1m"); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", "/t/s1/ws", nil)
+	// Three tabs on the session report the same sequence
+	for range 3 {
+		s.handleOSC52Write(r, "s1", "copied")
+	}
+	if s.clipboard != "copied" || s.clipboardVersion != 1 {
+		t.Fatalf("clipboard = %q (version %d), want one write", s.clipboard, s.clipboardVersion)
+	}
+	// The repeats took no token, so only the next write is over the limit
+	s.handleOSC52Write(r, "s1", "other")
+	if s.clipboard != "copied" {
+		t.Errorf("clipboard = %q, want the second write dropped", s.clipboard)
+	}
+}
+
+func TestRepeatedOSC52Write(t *testing.T) {
+	s := &Server{}
+	now := time.Now()
+	tests := []struct {
+		name string
+		id   string
+		text string
+		at   time.Duration
+		want bool
+	}{
+		{"first", "s1", "copied", 0, false},
+		{"another tab", "s1", "copied", 100 * time.Millisecond, true},
+		{"other session", "s2", "copied", 200 * time.Millisecond, false},
+		{"other text", "s1", "other", 300 * time.Millisecond, false},
+		{"after other text", "s1", "copied", 400 * time.Millisecond, false},
+		{"after the window", "s1", "copied", 400*time.Millisecond + osc52DedupWindow, false},
+	}
+	for _, tt := range tests {
+		if got := s.repeatedOSC52Write(tt.id, tt.text, now.Add(tt.at)); got != tt.want {
+			t.Errorf("%s: repeatedOSC52Write = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	s.dropPendingClipboard("s1")
+	if _, ok := s.osc52Recent["s1"]; ok {
+		t.Error("closed session's last write kept")
+	}
+}
@@ -18,15 +18,24 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"webmux/internal/shell"
 )
@@ -39,15 +48,8 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Determine host from environment
-	host := os.Getenv("WEBMUX_HOST")
-	if host == "" {
-		port := os.Getenv("WEBMUX_PORT")
-		if port == "" {
-			port = defaultPort
-		}
-		host = "localhost:" + port
-	}
+	host := serverHost()
+	apiClient = newAPIClient(host)
 
 	cmd := os.Args[1]
 	args := os.Args[2:]
@@ -70,6 +72,18 @@ func main() {
 		err = cmdScratch(host, args)
 	case "mark":
 		err = cmdMark(host, args)
+	case "share":
+		err = cmdShare(host, args)
+	case "acl":
+		err = cmdACL(host, args)
+	case "resurrect":
+		err = cmdResurrect(host, args)
+	case "profiles":
+		err = cmdProfiles(host)
+	case "workspace", "ws":
+		err = cmdWorkspace(host, args)
+	case "project":
+		err = cmdProject(host, args)
 	case "init":
 		err = cmdInit()
 	case "copy", "c":
@@ -99,6 +113,26 @@ Commands:
   info               Show server info (upload dir, work dir)
   ls, list           List all sessions
   new [name]         Create a new session
+  new [options] [name] [-- command args...]
+                     Create a session running a command instead of the shell, with
+                     --cwd dir, --env K=V (repeatable), --shell path, --size 120x40,
+                     and --keep to keep its output on screen after it exits
+  new --here [name]  Create a session in this terminal's directory, with its environment
+  new --profile p [name]
+                     Create a session from a profile (default: the default profile)
+                     In a directory with a .webmux.json, wm new offers the project's
+                     sessions and tasks (--no-project skips this)
+  project            Show the .webmux.json of this directory or a parent
+  project trust      Review and trust it, so its commands may run
+  project untrust    Withdraw trust
+  project open [name...]
+                     Open the project's sessions (default: all) or tasks
+  profiles           List session profiles
+  workspace up <file|name>
+                     Start a workspace's sessions and groups (skips running ones)
+  workspace down <name>
+                     Close the sessions a workspace started
+  workspace ls       List saved and running workspaces
   close <id>         Close a session
   rename <id> <name> Rename a session
   upload <file>...   Upload files to the server
@@ -110,6 +144,18 @@ Commands:
   mark <file>...     Mark files for download
   mark unmark <file> Unmark a file
   mark clear         Clear all marked files
+  share [-e d] [id]  Create a read-only link to a session (default: this one, 1h)
+  share ls           List active share links
+  share revoke <id>  Revoke a share link
+  acl [id]           Show who else may use a session (default: this one)
+  acl [id] user=view|control|none...
+                     Grant or remove another user's access to a session
+  resurrect          Recreate all sessions saved before a reboot
+  resurrect <id|name>...
+                     Recreate the given saved sessions
+  resurrect ls       List saved sessions that can be recreated
+  resurrect discard [id|name...]
+                     Forget saved sessions (default: all)
   copy, c [text]     Copy text to browser clipboard (reads stdin if no args)
   paste, p, v        Paste from browser clipboard to stdout
   init               Output shell code that defines the wm wrapper function
@@ -117,7 +163,10 @@ Commands:
 Environment:
   WEBMUX_PORT        Server port (set automatically in webmux terminals)
   WEBMUX_SESSION     Current session ID (set automatically in webmux terminals)
-  WEBMUX_HOST        Full server address (overrides WEBMUX_PORT if set)
+  WEBMUX_HOST        Full server address (overrides WEBMUX_PORT if set; may include https://)
+  WEBMUX_SCHEME      http or https (set automatically when the server uses TLS)
+  WEBMUX_TLS_CA      PEM certificate/CA to trust for https (set automatically)
+  WEBMUX_TOKEN       API token sent with requests (set automatically when login is required)
 
 In webmux terminals, use wm to run commands (e.g., wm ls, wm scratch hello)
 
@@ -138,8 +187,113 @@ Clipboard:
 
 // API helpers
 
+// apiClient is the HTTP client used for all API requests (configured in main)
+var apiClient = http.DefaultClient
+
+// serverHost returns the server address from WEBMUX_HOST or WEBMUX_PORT
+func serverHost() string {
+	if host := os.Getenv("WEBMUX_HOST"); host != "" {
+		return host
+	}
+	port := os.Getenv("WEBMUX_PORT")
+	if port == "" {
+		port = defaultPort
+	}
+	return "localhost:" + port
+}
+
+// apiURL builds the URL for an API path on host (which may carry its own scheme)
+func apiURL(host, path string) string {
+	if strings.Contains(host, "://") {
+		return strings.TrimSuffix(host, "/") + path
+	}
+	scheme := os.Getenv("WEBMUX_SCHEME")
+	if scheme == "" {
+		scheme = "http"
+	}
+	return scheme + "://" + host + path
+}
+
+// newAPIClient returns a client that also trusts WEBMUX_TLS_CA when set.
+// Loopback connections skip the hostname check (the server may use a cert
+// issued for its public name), but the chain must still verify.
+func newAPIClient(host string) *http.Client {
+	caPath := os.Getenv("WEBMUX_TLS_CA")
+	if caPath == "" {
+		return http.DefaultClient
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	data, err := os.ReadFile(caPath)
+	if err != nil || !pool.AppendCertsFromPEM(data) {
+		fmt.Fprintf(os.Stderr, "Warning: could not load WEBMUX_TLS_CA %s\n", caPath)
+		return http.DefaultClient
+	}
+
+	hostname := host
+	if u, err := url.Parse(host); err == nil && u.Host != "" {
+		hostname = u.Host
+	}
+	if h, _, err := net.SplitHostPort(hostname); err == nil {
+		hostname = h
+	}
+	ip := net.ParseIP(hostname)
+	isLoopback := hostname == "localhost" || (ip != nil && ip.IsLoopback())
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		// Verification is done in VerifyConnection so the hostname check can be relaxed for loopback
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return fmt.Errorf("server sent no certificate")
+			}
+			opts := x509.VerifyOptions{Roots: pool, Intermediates: x509.NewCertPool()}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			if !isLoopback {
+				opts.DNSName = hostname
+			}
+			_, err := cs.PeerCertificates[0].Verify(opts)
+			return err
+		},
+	}
+	return &http.Client{Transport: transport}
+}
+
+// newRequest creates an API request, adding the WEBMUX_TOKEN credential when set
+func newRequest(method, rawURL string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if token := os.Getenv("WEBMUX_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// apiError is an error response from the server
+type apiError struct {
+	status int
+	body   string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("server error (%d): %s", e.status, e.body)
+}
+
 func apiGet(host, path string) ([]byte, error) {
-	resp, err := http.Get(fmt.Sprintf("http://%s%s", host, path))
+	req, err := newRequest(http.MethodGet, apiURL(host, path), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := apiClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
@@ -151,7 +305,7 @@ func apiGet(host, path string) ([]byte, error) {
 	}
 
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("server error (%d): %s", resp.StatusCode, string(body))
+		return nil, &apiError{status: resp.StatusCode, body: string(body)}
 	}
 
 	return body, nil
@@ -163,11 +317,13 @@ func apiPost(host, path string, data any) ([]byte, error) {
 		return nil, fmt.Errorf("failed to encode request: %w", err)
 	}
 
-	resp, err := http.Post(
-		fmt.Sprintf("http://%s%s", host, path),
-		"application/json",
-		bytes.NewReader(jsonData),
-	)
+	req, err := newRequest(http.MethodPost, apiURL(host, path), bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := apiClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
@@ -179,19 +335,19 @@ func apiPost(host, path string, data any) ([]byte, error) {
 	}
 
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("server error (%d): %s", resp.StatusCode, string(body))
+		return nil, &apiError{status: resp.StatusCode, body: string(body)}
 	}
 
 	return body, nil
 }
 
 func apiDelete(host, path string) error {
-	req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("http://%s%s", host, path), nil)
+	req, err := newRequest(http.MethodDelete, apiURL(host, path), nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := apiClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
 	}
@@ -199,7 +355,7 @@ func apiDelete(host, path string) error {
 
 	if resp.StatusCode >= 400 {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("server error (%d): %s", resp.StatusCode, string(body))
+		return &apiError{status: resp.StatusCode, body: string(body)}
 	}
 
 	return nil
@@ -211,13 +367,13 @@ func apiPatch(host, path string, data any) error {
 		return fmt.Errorf("failed to encode request: %w", err)
 	}
 
-	req, err := http.NewRequest(http.MethodPatch, fmt.Sprintf("http://%s%s", host, path), bytes.NewReader(jsonData))
+	req, err := newRequest(http.MethodPatch, apiURL(host, path), bytes.NewReader(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := apiClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
 	}
@@ -225,7 +381,7 @@ func apiPatch(host, path string, data any) error {
 
 	if resp.StatusCode >= 400 {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("server error (%d): %s", resp.StatusCode, string(body))
+		return &apiError{status: resp.StatusCode, body: string(body)}
 	}
 
 	return nil
@@ -253,7 +409,7 @@ func cmdInfo(host string) error {
 		return fmt.Errorf("failed to parse response: %w", err)
 	}
 
-	fmt.Printf("Server:       http://localhost:%s\n", info.Port)
+	fmt.Printf("Server:       %s\n", apiURL(serverHost(), ""))
 	fmt.Printf("Sessions:     %d\n", info.SessionCount)
 	fmt.Printf("Shell:        %s\n", info.Shell)
 	fmt.Printf("Work dir:     %s\n", info.WorkDir)
@@ -272,6 +428,8 @@ func cmdList(host string) error {
 		ID             string `json:"id"`
 		Name           string `json:"name"`
 		CurrentProcess string `json:"currentProcess"`
+		Owner          string `json:"owner"`
+		Access         string `json:"access"`
 	}
 	if err := json.Unmarshal(body, &sessions); err != nil {
 		return fmt.Errorf("failed to parse response: %w", err)
@@ -287,18 +445,103 @@ func cmdList(host string) error {
 		if proc == "" {
 			proc = "-"
 		}
+		if s.Access != "" && s.Access != "owner" {
+			fmt.Printf("%s\t%s\t(%s)\t[%s, %s]\n", s.ID, s.Name, proc, s.Owner, s.Access)
+			continue
+		}
 		fmt.Printf("%s\t%s\t(%s)\n", s.ID, s.Name, proc)
 	}
 	return nil
 }
 
 func cmdNew(host string, args []string) error {
-	name := ""
-	if len(args) > 0 {
-		name = args[0]
+	const usage = "usage: wm new [--profile p] [--cwd dir] [--env K=V]... [--shell path] [--size COLSxROWS] [--keep] [--here] [--no-project] [name] [-- command args...]"
+	req := map[string]any{}
+	var name, profile, cwd string
+	var command []string
+	env := map[string]string{}
+	noProject, here := false, false
+	for len(args) > 0 {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			command, args = args, nil
+			break
+		}
+		// Flags take a value as the next argument or after "="
+		flagName, value, hasValue := strings.Cut(arg, "=")
+		takesValue := slices.Contains([]string{"-p", "--profile", "--cwd", "-e", "--env", "--shell", "--size"}, flagName)
+		if takesValue && !hasValue {
+			if len(args) == 0 {
+				return fmt.Errorf("%s needs a value\n%s", flagName, usage)
+			}
+			value, args = args[0], args[1:]
+		}
+		switch {
+		case flagName == "-p" || flagName == "--profile":
+			profile = value
+		case flagName == "--cwd":
+			cwd = value
+		case flagName == "-e" || flagName == "--env":
+			key, val, ok := strings.Cut(value, "=")
+			if !ok {
+				return fmt.Errorf("--env takes KEY=VALUE, got %q", value)
+			}
+			env[key] = val
+		case flagName == "--shell":
+			req["shell"] = value
+		case flagName == "--size":
+			cols, rows, ok := strings.Cut(value, "x")
+			c, err1 := strconv.Atoi(cols)
+			r, err2 := strconv.Atoi(rows)
+			if !ok || err1 != nil || err2 != nil {
+				return fmt.Errorf("--size takes COLSxROWS, e.g. 120x40")
+			}
+			req["cols"], req["rows"] = c, r
+		case arg == "--keep":
+			req["keepOnExit"] = true
+		case arg == "--here":
+			here = true
+		case arg == "--no-project":
+			noProject = true
+		case strings.HasPrefix(arg, "-") || name != "":
+			return fmt.Errorf(usage)
+		default:
+			name = arg
+		}
+	}
+	if here {
+		// Start where this terminal is; outside webmux, where wm runs
+		if id := os.Getenv("WEBMUX_SESSION"); id != "" {
+			req["cloneFrom"], req["cloneEnv"] = id, true
+		} else if cwd == "" {
+			cwd = "."
+		}
+	}
+	if cwd != "" && !filepath.IsAbs(cwd) && !strings.HasPrefix(cwd, "~") {
+		abs, err := filepath.Abs(cwd)
+		if err != nil {
+			return err
+		}
+		cwd = abs
 	}
 
-	body, err := apiPost(host, "/api/sessions", map[string]string{"name": name})
+	// Offer the sessions of the project this is run in
+	if name == "" && profile == "" && cwd == "" && len(command) == 0 && len(env) == 0 &&
+		!here && !noProject && isTerminal(os.Stdin) {
+		if opened, err := offerProject(host); opened || err != nil {
+			return err
+		}
+	}
+
+	req["name"], req["profile"], req["cwd"] = name, profile, cwd
+	if len(command) > 0 {
+		req["command"] = command
+	}
+	if len(env) > 0 {
+		req["env"] = env
+	}
+	body, err := apiPost(host, "/api/sessions", req)
 	if err != nil {
 		return err
 	}
@@ -315,6 +558,355 @@ func cmdNew(host string, args []string) error {
 	return nil
 }
 
+// project is a .webmux.json found by the server (see GET /api/project)
+type project struct {
+	Root     string `json:"root"`
+	File     string `json:"file"`
+	Hash     string `json:"hash"`
+	Trusted  bool   `json:"trusted"`
+	Manifest struct {
+		Name     string            `json:"name"`
+		Env      map[string]string `json:"env"`
+		Sessions []projectSession  `json:"sessions"`
+		Tasks    []projectSession  `json:"tasks"`
+	} `json:"manifest"`
+}
+
+type projectSession struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Cwd         string            `json:"cwd"`
+	Command     []string          `json:"command"`
+	Env         map[string]string `json:"env"`
+}
+
+// isTerminal reports whether f is a terminal rather than a pipe or file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// findProject returns the manifest that applies to the current directory, or nil
+func findProject(host string) (*project, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	body, err := apiGet(host, "/api/project?path="+url.QueryEscape(dir))
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var p project
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return &p, nil
+}
+
+// describe returns what a project session runs
+func (ps projectSession) describe() string {
+	if ps.Description != "" {
+		return ps.Description
+	}
+	if len(ps.Command) > 0 {
+		return strings.Join(ps.Command, " ")
+	}
+	return "shell"
+}
+
+// printManifest shows everything a manifest sets up, for deciding to trust it
+func (p *project) printManifest() {
+	fmt.Printf("Project %s (%s)", p.Manifest.Name, p.File)
+	if !p.Trusted {
+		fmt.Print(", not trusted")
+	}
+	fmt.Println()
+	for _, key := range slices.Sorted(maps.Keys(p.Manifest.Env)) {
+		fmt.Printf("  env %s=%s\n", key, p.Manifest.Env[key])
+	}
+	show := func(kind string, ps projectSession) {
+		var env []string
+		for _, key := range slices.Sorted(maps.Keys(ps.Env)) {
+			env = append(env, key+"="+ps.Env[key])
+		}
+		line := strings.TrimSpace(strings.Join(env, " ") + " " + strings.Join(ps.Command, " "))
+		if line == "" {
+			line = "shell"
+		}
+		if ps.Cwd != "" {
+			line += " (in " + ps.Cwd + ")"
+		}
+		fmt.Printf("  %s %s: %s\n", kind, ps.Name, line)
+	}
+	for _, ps := range p.Manifest.Sessions {
+		show("session", ps)
+	}
+	for _, ps := range p.Manifest.Tasks {
+		show("task", ps)
+	}
+}
+
+// trust asks before trusting an untrusted manifest, reporting whether it is trusted
+func (p *project) trust(host string, in *bufio.Reader) (bool, error) {
+	if p.Trusted {
+		return true, nil
+	}
+	p.printManifest()
+	fmt.Print("Trust this manifest and run it? [y/N] ")
+	answer, _ := in.ReadString('\n')
+	if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+		return false, nil
+	}
+	if _, err := apiPost(host, "/api/project/trust", map[string]string{"path": p.Root, "hash": p.Hash}); err != nil {
+		return false, err
+	}
+	p.Trusted = true
+	return true, nil
+}
+
+// open starts the named sessions and tasks of a project (all sessions if none)
+func (p *project) open(host string, names []string) error {
+	body, err := apiPost(host, "/api/project/open", map[string]any{"path": p.Root, "names": names})
+	if err != nil {
+		return err
+	}
+	var sessions []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(body, &sessions); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	for _, s := range sessions {
+		fmt.Printf("Created session: %s (%s)\n", s.Name, s.ID)
+	}
+	return nil
+}
+
+// offerProject lets wm new open a session of the project it runs in,
+// reporting whether it did
+func offerProject(host string) (bool, error) {
+	p, err := findProject(host)
+	if err != nil || p == nil {
+		return false, nil // Not in a project (or an unreadable manifest): plain session
+	}
+	items := append(slices.Clone(p.Manifest.Sessions), p.Manifest.Tasks...)
+	if len(items) == 0 {
+		return false, nil
+	}
+	fmt.Printf("Project %s (%s):\n", p.Manifest.Name, p.File)
+	for i, ps := range items {
+		kind := ""
+		if i >= len(p.Manifest.Sessions) {
+			kind = " (task)"
+		}
+		fmt.Printf("  %d) %s%s: %s\n", i+1, ps.Name, kind, ps.describe())
+	}
+	if len(p.Manifest.Sessions) > 1 {
+		fmt.Println("  a) all sessions")
+	}
+	fmt.Print("Open which? [Enter for a plain shell] ")
+
+	in := bufio.NewReader(os.Stdin)
+	answer, _ := in.ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	var names []string
+	switch n, err := strconv.Atoi(answer); {
+	case answer == "":
+		return false, nil
+	case answer == "a" && len(p.Manifest.Sessions) > 1:
+	case err == nil && n >= 1 && n <= len(items):
+		names = []string{items[n-1].Name}
+	default:
+		return true, fmt.Errorf("no choice %q", answer)
+	}
+	if ok, err := p.trust(host, in); !ok || err != nil {
+		if err == nil {
+			fmt.Println("Not trusted; nothing was run")
+		}
+		return true, err
+	}
+	return true, p.open(host, names)
+}
+
+// cmdProject shows, trusts or opens the project of the current directory
+func cmdProject(host string, args []string) error {
+	p, err := findProject(host)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return fmt.Errorf("no .webmux.json in this directory or its parents")
+	}
+	if len(args) == 0 {
+		p.printManifest()
+		return nil
+	}
+
+	switch args[0] {
+	case "trust":
+		p.Trusted = false // Always show what is being trusted
+		if ok, err := p.trust(host, bufio.NewReader(os.Stdin)); err != nil || !ok {
+			return err
+		}
+		fmt.Println("Trusted", p.File)
+	case "untrust":
+		if err := apiDelete(host, "/api/project/trust?path="+url.QueryEscape(p.Root)); err != nil {
+			return err
+		}
+		fmt.Println("No longer trusted:", p.File)
+	case "open":
+		if !p.Trusted {
+			return fmt.Errorf("%s is not trusted; review it with wm project trust", p.File)
+		}
+		return p.open(host, args[1:])
+	default:
+		return fmt.Errorf("usage: wm project [trust|untrust|open [name...]]")
+	}
+	return nil
+}
+
+// cmdProfiles lists the profiles wm new --profile can use
+func cmdProfiles(host string) error {
+	body, err := apiGet(host, "/api/profiles")
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Default  string `json:"default"`
+		Profiles map[string]struct {
+			Cwd     string   `json:"cwd"`
+			Command []string `json:"command"`
+			Shell   string   `json:"shell"`
+			Login   bool     `json:"login"`
+		} `json:"profiles"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(resp.Profiles) == 0 {
+		fmt.Println("No profiles defined")
+		return nil
+	}
+	for _, name := range slices.Sorted(maps.Keys(resp.Profiles)) {
+		p := resp.Profiles[name]
+		var desc []string
+		if name == resp.Default {
+			desc = append(desc, "(default)")
+		}
+		if len(p.Command) > 0 {
+			desc = append(desc, "runs "+strings.Join(p.Command, " "))
+		} else if p.Shell != "" {
+			desc = append(desc, "shell "+p.Shell)
+		}
+		if p.Login {
+			desc = append(desc, "login")
+		}
+		if p.Cwd != "" {
+			desc = append(desc, "in "+p.Cwd)
+		}
+		fmt.Printf("%s\t%s\n", name, strings.Join(desc, " "))
+	}
+	return nil
+}
+
+func cmdWorkspace(host string, args []string) error {
+	if len(args) == 0 || args[0] == "ls" || args[0] == "list" {
+		body, err := apiGet(host, "/api/workspaces")
+		if err != nil {
+			return err
+		}
+		var workspaces []struct {
+			Name    string `json:"name"`
+			File    string `json:"file"`
+			Running int    `json:"running"`
+		}
+		if err := json.Unmarshal(body, &workspaces); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+		if len(workspaces) == 0 {
+			fmt.Println("No workspaces")
+			return nil
+		}
+		for _, ws := range workspaces {
+			file := ws.File
+			if file == "" {
+				file = "-"
+			}
+			fmt.Printf("%s\t%d running\t%s\n", ws.Name, ws.Running, file)
+		}
+		return nil
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("usage: wm workspace up <file|name> | down <name> | ls")
+	}
+
+	switch args[0] {
+	case "up":
+		// A path is sent as source text, anything else names a saved workspace
+		req := map[string]string{"name": args[1]}
+		if data, err := os.ReadFile(args[1]); err == nil {
+			req = map[string]string{
+				"source": string(data),
+				"name":   strings.TrimSuffix(filepath.Base(args[1]), filepath.Ext(args[1])),
+			}
+		} else if strings.ContainsRune(args[1], os.PathSeparator) {
+			return err
+		}
+		body, err := apiPost(host, "/api/workspaces/apply", req)
+		if err != nil {
+			return err
+		}
+		var result struct {
+			Workspace string `json:"workspace"`
+			Created   []struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"created"`
+			Existing []string `json:"existing"`
+			Failed   []struct {
+				Name  string `json:"name"`
+				Error string `json:"error"`
+			} `json:"failed"`
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+		for _, s := range result.Created {
+			fmt.Printf("Created session: %s (%s)\n", s.Name, s.ID)
+		}
+		if len(result.Existing) > 0 {
+			fmt.Printf("Already running: %s\n", strings.Join(result.Existing, ", "))
+		}
+		for _, f := range result.Failed {
+			fmt.Fprintf(os.Stderr, "Failed: %s: %s\n", f.Name, f.Error)
+		}
+		if len(result.Failed) > 0 {
+			return fmt.Errorf("%d session(s) of workspace %s failed", len(result.Failed), result.Workspace)
+		}
+		return nil
+	case "down":
+		body, err := apiPost(host, "/api/workspaces/down", map[string]string{"name": args[1]})
+		if err != nil {
+			return err
+		}
+		var result struct {
+			Closed int `json:"closed"`
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+		fmt.Printf("Closed %d session(s)\n", result.Closed)
+		return nil
+	default:
+		return fmt.Errorf("unknown workspace command: %s", args[0])
+	}
+}
+
 func cmdClose(host string, args []string) error {
 	if len(args) < 1 {
 		return fmt.Errorf("usage: wm close <session-id>")
@@ -392,14 +984,14 @@ func cmdUpload(host string, args []string) error {
 		f.Close()
 		writer.Close()
 
-		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%s/api/upload", host), body)
+		req, err := newRequest(http.MethodPost, apiURL(host, "/api/upload"), body)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Skipping %s: %v\n", file, err)
 			continue
 		}
 		req.Header.Set("Content-Type", writer.FormDataContentType())
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := apiClient.Do(req)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Skipping %s: %v\n", file, err)
 			continue
@@ -572,6 +1164,215 @@ func cmdMark(host string, args []string) error {
 	}
 }
 
+func cmdShare(host string, args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "ls", "list":
+			body, err := apiGet(host, "/api/shares")
+			if err != nil {
+				return err
+			}
+			var resp struct {
+				Shares []struct {
+					ID        string    `json:"id"`
+					SessionID string    `json:"sessionId"`
+					ExpiresAt time.Time `json:"expiresAt"`
+				} `json:"shares"`
+			}
+			if err := json.Unmarshal(body, &resp); err != nil {
+				return fmt.Errorf("failed to parse response: %w", err)
+			}
+			if len(resp.Shares) == 0 {
+				fmt.Println("No active shares")
+				return nil
+			}
+			for _, s := range resp.Shares {
+				fmt.Printf("%s\t%s\texpires %s\n", s.ID, s.SessionID, s.ExpiresAt.Local().Format("2006-01-02 15:04"))
+			}
+			return nil
+
+		case "revoke", "rm":
+			if len(args) < 2 {
+				return fmt.Errorf("usage: wm share revoke <share-id>")
+			}
+			if err := apiDelete(host, "/api/shares/"+args[1]); err != nil {
+				return err
+			}
+			fmt.Printf("Revoked share: %s\n", args[1])
+			return nil
+		}
+	}
+
+	// Create a share for the given (or current) session
+	expiresIn := ""
+	if len(args) >= 2 && (args[0] == "-e" || args[0] == "--expires") {
+		expiresIn = args[1]
+		args = args[2:]
+	}
+	sessionID := os.Getenv("WEBMUX_SESSION")
+	if len(args) > 0 {
+		sessionID = args[0]
+	}
+	if sessionID == "" {
+		return fmt.Errorf("usage: wm share [-e duration] <session-id> (or run inside a webmux terminal)")
+	}
+
+	body, err := apiPost(host, "/api/shares", map[string]string{"sessionId": sessionID, "expiresIn": expiresIn})
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Share struct {
+			ID        string    `json:"id"`
+			ExpiresAt time.Time `json:"expiresAt"`
+		} `json:"share"`
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	fmt.Println(resp.URL)
+	fmt.Fprintf(os.Stderr, "Read-only share %s for %s, expires %s\n",
+		resp.Share.ID, sessionID, resp.Share.ExpiresAt.Local().Format("2006-01-02 15:04"))
+	return nil
+}
+
+// cmdACL shows or changes which other users may view or control a session
+func cmdACL(host string, args []string) error {
+	sessionID := os.Getenv("WEBMUX_SESSION")
+	if len(args) > 0 && !strings.Contains(args[0], "=") {
+		sessionID = args[0]
+		args = args[1:]
+	}
+	if sessionID == "" {
+		return fmt.Errorf("usage: wm acl <session-id> [user=view|control|none]... (or run inside a webmux terminal)")
+	}
+
+	body, err := apiGet(host, "/api/sessions")
+	if err != nil {
+		return err
+	}
+	var sessions []struct {
+		ID    string            `json:"id"`
+		Owner string            `json:"owner"`
+		ACL   map[string]string `json:"acl"`
+	}
+	if err := json.Unmarshal(body, &sessions); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	acl := map[string]string{}
+	found := false
+	for _, s := range sessions {
+		if s.ID == sessionID {
+			found = true
+			for user, access := range s.ACL {
+				acl[user] = access
+			}
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	if len(args) == 0 {
+		if len(acl) == 0 {
+			fmt.Println("No other users have access")
+			return nil
+		}
+		for user, access := range acl {
+			fmt.Printf("%s\t%s\n", user, access)
+		}
+		return nil
+	}
+
+	for _, arg := range args {
+		user, access, ok := strings.Cut(arg, "=")
+		if !ok || user == "" {
+			return fmt.Errorf("invalid grant %q: use user=view, user=control or user=none", arg)
+		}
+		if access == "none" {
+			delete(acl, user)
+			continue
+		}
+		acl[user] = access
+	}
+	if err := apiPatch(host, "/api/sessions/"+sessionID, map[string]any{"acl": acl}); err != nil {
+		return err
+	}
+	fmt.Printf("Updated access to %s\n", sessionID)
+	return nil
+}
+
+// cmdResurrect lists, recreates or discards sessions saved before their tmux server went away
+func cmdResurrect(host string, args []string) error {
+	if len(args) > 0 && (args[0] == "ls" || args[0] == "list") {
+		body, err := apiGet(host, "/api/resurrect")
+		if err != nil {
+			return err
+		}
+		var saved []struct {
+			ID      string   `json:"id"`
+			Name    string   `json:"name"`
+			Cwd     string   `json:"cwd"`
+			Command []string `json:"command"`
+			Rerun   bool     `json:"rerun"`
+		}
+		if err := json.Unmarshal(body, &saved); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+		if len(saved) == 0 {
+			fmt.Println("No saved sessions")
+			return nil
+		}
+		for _, s := range saved {
+			command := "-"
+			if len(s.Command) > 0 {
+				command = strings.Join(s.Command, " ")
+				if s.Rerun {
+					command += " (re-run)"
+				}
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\n", s.ID, s.Name, s.Cwd, command)
+		}
+		return nil
+	}
+
+	if len(args) > 0 && args[0] == "discard" {
+		query := url.Values{"id": args[1:]}
+		path := "/api/resurrect"
+		if len(args) > 1 {
+			path += "?" + query.Encode()
+		}
+		if err := apiDelete(host, path); err != nil {
+			return err
+		}
+		fmt.Println("Discarded saved sessions")
+		return nil
+	}
+
+	body, err := apiPost(host, "/api/resurrect", map[string][]string{"ids": args})
+	if err != nil {
+		return err
+	}
+	var sessions []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(body, &sessions); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(sessions) == 0 {
+		fmt.Println("No saved sessions to recreate")
+		return nil
+	}
+	for _, s := range sessions {
+		fmt.Printf("Recreated session: %s (%s)\n", s.Name, s.ID)
+	}
+	return nil
+}
+
 // cmdInit outputs shell code to set up the wm wrapper function
 // This is automatically injected by webmux; users don't need to call this manually
 func cmdInit() error {
@@ -609,22 +1410,16 @@ func cmdCopy(args []string) error {
 		return fmt.Errorf("nothing to copy")
 	}
 
-	// Determine host from environment
-	host := os.Getenv("WEBMUX_HOST")
-	if host == "" {
-		port := os.Getenv("WEBMUX_PORT")
-		if port == "" {
-			port = "8080"
-		}
-		host = "localhost:" + port
-	}
+	host := serverHost()
 
 	// POST to clipboard API
-	resp, err := http.Post(
-		fmt.Sprintf("http://%s/api/clipboard", host),
-		"text/plain",
-		strings.NewReader(text),
-	)
+	req, err := newRequest(http.MethodPost, apiURL(host, "/api/clipboard"), strings.NewReader(text))
+	if err != nil {
+		return fmt.Errorf("failed to set clipboard: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain")
+
+	resp, err := apiClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to set clipboard: %w", err)
 	}
@@ -641,16 +1436,14 @@ func cmdCopy(args []string) error {
 // cmdPaste reads from the server-side clipboard via HTTP API
 // Outputs the clipboard contents to stdout
 func cmdPaste() error {
-	host := os.Getenv("WEBMUX_HOST")
-	if host == "" {
-		port := os.Getenv("WEBMUX_PORT")
-		if port == "" {
-			port = "8080"
-		}
-		host = "localhost:" + port
+	host := serverHost()
+
+	req, err := newRequest(http.MethodGet, apiURL(host, "/api/clipboard"), nil)
+	if err != nil {
+		return fmt.Errorf("failed to get clipboard: %w", err)
 	}
 
-	resp, err := http.Get(fmt.Sprintf("http://%s/api/clipboard", host))
+	resp, err := apiClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to get clipboard: %w", err)
 	}
@@ -0,0 +1,149 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SECTION: CSRF
+
+const (
+	// Double-submit cookie read by the UI and echoed in csrfHeaderName
+	csrfCookieName = "webmux_csrf"
+	csrfHeaderName = "X-CSRF-Token"
+)
+
+// OriginGuard rejects cross-origin state-changing requests and WebSocket upgrades.
+// Same-origin is always allowed; reverse-proxy hostnames are added via -allowed-origins.
+type OriginGuard struct {
+	origins map[string]bool // full origins, e.g. "https://webmux.example.com"
+	hosts   map[string]bool // bare host[:port] entries, any scheme
+}
+
+// NewOriginGuard parses a comma-separated allowlist of origins or hosts
+func NewOriginGuard(allowed string) (*OriginGuard, error) {
+	g := &OriginGuard{
+		origins: make(map[string]bool),
+		hosts:   make(map[string]bool),
+	}
+	for entry := range strings.SplitSeq(allowed, ",") {
+		entry = strings.TrimSpace(strings.ToLower(entry))
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "://") {
+			g.hosts[entry] = true
+			continue
+		}
+		u, err := url.Parse(entry)
+		if err != nil || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return nil, fmt.Errorf("invalid origin %q (expected scheme://host[:port])", entry)
+		}
+		g.origins[u.Scheme+"://"+u.Host] = true
+	}
+	return g, nil
+}
+
+// isStateChanging reports whether a request can change server state
+func isStateChanging(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+	}
+	return true
+}
+
+// isBrowserRequest reports whether a request looks like it came from a browser
+// (as opposed to wm, curl or scripts, which cannot be driven by another site)
+func isBrowserRequest(r *http.Request) bool {
+	return r.Header.Get("Origin") != "" || r.Header.Get("Referer") != "" ||
+		r.Header.Get("Sec-Fetch-Site") != "" || r.Header.Get("Cookie") != ""
+}
+
+// allowed reports whether origin (scheme://host[:port]) may drive this server
+func (g *OriginGuard) allowed(origin string, r *http.Request) bool {
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if u.Host == strings.ToLower(r.Host) {
+		return true
+	}
+	return g.origins[u.Scheme+"://"+u.Host] || g.hosts[u.Host]
+}
+
+// check returns why a state-changing request is rejected, or "" if it may proceed
+func (g *OriginGuard) check(r *http.Request) string {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// Older browsers omit Origin on some requests; fall back to Referer
+		if ref, err := url.Parse(r.Header.Get("Referer")); err == nil && ref.Host != "" {
+			origin = ref.Scheme + "://" + ref.Host
+		}
+	}
+	if origin != "" {
+		if !g.allowed(origin, r) {
+			return "cross-origin request from " + origin
+		}
+	} else if r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		return "cross-site request"
+	}
+
+	// WebSocket upgrades cannot carry custom headers; Origin is the check for them
+	if r.Method == http.MethodGet || !isBrowserRequest(r) {
+		return ""
+	}
+	cookie, err := r.Cookie(csrfCookieName)
+	token := r.Header.Get(csrfHeaderName)
+	if err != nil || cookie.Value == "" || token == "" ||
+		subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(token)) != 1 {
+		return "missing or invalid CSRF token"
+	}
+	return ""
+}
+
+// Middleware enforces the origin policy and hands browsers a CSRF cookie
+func (g *OriginGuard) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isStateChanging(r) {
+			if reason := g.check(r); reason != "" {
+				log.Printf("Rejected %s %s from %s: %s", r.Method, r.URL.Path, clientDescription(r), reason)
+				http.Error(w, "Forbidden: "+reason, http.StatusForbidden)
+				return
+			}
+		}
+
+		if _, err := r.Cookie(csrfCookieName); err != nil && r.Method == http.MethodGet {
+			http.SetCookie(w, &http.Cookie{
+				Name:     csrfCookieName,
+				Value:    randomToken(16),
+				Path:     "/",
+				Secure:   isSecureRequest(r),
+				SameSite: http.SameSiteStrictMode,
+			})
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
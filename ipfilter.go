@@ -0,0 +1,95 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// SECTION: IP FILTER
+
+// Rejected addresses remembered for logging before the set is reset
+const ipFilterMaxLogged = 1024
+
+// ipFilter admits clients by address before any routing. Deny entries win over
+// allow entries; an empty allow list admits every address that is not denied.
+type ipFilter struct {
+	allow  []*net.IPNet
+	deny   []*net.IPNet
+	logged map[string]bool // rejected addresses already logged
+	mu     sync.Mutex
+}
+
+// newIPFilter parses comma-separated allow and deny lists (nil when both are empty)
+func newIPFilter(allow, deny string) (*ipFilter, error) {
+	allowNets, err := parseCIDRList(allow)
+	if err != nil {
+		return nil, fmt.Errorf("-allow-ips: %w", err)
+	}
+	denyNets, err := parseCIDRList(deny)
+	if err != nil {
+		return nil, fmt.Errorf("-deny-ips: %w", err)
+	}
+	if len(allowNets) == 0 && len(denyNets) == 0 {
+		return nil, nil
+	}
+	return &ipFilter{allow: allowNets, deny: denyNets, logged: make(map[string]bool)}, nil
+}
+
+// Allowed reports whether a client at ip may connect
+func (f *ipFilter) Allowed(ip net.IP) bool {
+	if ip == nil || ipInNets(ip, f.deny) {
+		return false
+	}
+	return len(f.allow) == 0 || ipInNets(ip, f.allow)
+}
+
+// Middleware rejects requests from addresses the filter does not admit
+func (f *ipFilter) Middleware(next http.Handler) http.Handler {
+	if f == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := remoteIP(r)
+		if !f.Allowed(ip) {
+			f.logRejected(r.RemoteAddr, ip)
+			http.Error(w, "Forbidden: client address not allowed", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// logRejected logs the first rejection of each address
+func (f *ipFilter) logRejected(remoteAddr string, ip net.IP) {
+	key := ip.String()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.logged[key] {
+		return
+	}
+	if len(f.logged) >= ipFilterMaxLogged {
+		clear(f.logged)
+	}
+	f.logged[key] = true
+	log.Printf("Rejected connection from %s: address not allowed", remoteAddr)
+}
@@ -20,15 +20,19 @@ package main
 import (
 	"archive/zip"
 	"compress/gzip"
+	"context"
 	"crypto/sha256"
+	"crypto/tls"
 	"embed"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"net"
 	"net/http"
 	"net/http/httputil"
@@ -37,6 +41,7 @@ import (
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"regexp"
 	"slices"
 	"strconv"
 	"strings"
@@ -86,6 +91,10 @@ func (w *RotatingLogWriter) Write(p []byte) (n int, err error) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
+	// Log lines quote terminal output and user input; mask secrets in both copies
+	n = len(p)
+	p = []byte(redactor.Redact(string(p)))
+
 	// Always write to stdout
 	os.Stdout.Write(p)
 
@@ -109,7 +118,7 @@ func (w *RotatingLogWriter) Write(p []byte) (n int, err error) {
 	}
 
 	// Write to file
-	n, err = w.file.Write(p)
+	_, err = w.file.Write(p)
 	w.lineCount += newLines
 	return n, err
 }
@@ -169,13 +178,105 @@ func (w *RotatingLogWriter) Close() error {
 
 // Session represents a terminal session backed by tmux + ttyd
 type Session struct {
-	ID             string    `json:"id"`
-	Name           string    `json:"name"`
-	Port           int       `json:"port"`
-	CreatedAt      time.Time `json:"createdAt"`
-	CurrentProcess string    `json:"currentProcess,omitempty"`
-	tmuxSession    string    // tmux session name (e.g., "mux-7701")
-	ttydCmd        *exec.Cmd // current ttyd process (restarts if it exits while tmux persists)
+	ID             string            `json:"id"`
+	Name           string            `json:"name"`
+	Port           int               `json:"port"`
+	CreatedAt      time.Time         `json:"createdAt"`
+	CurrentProcess string            `json:"currentProcess,omitempty"`
+	OSC52Policy    string            `json:"osc52Policy,omitempty"` // "" = server default (-osc52)
+	Owner          string            `json:"owner,omitempty"`       // user whose namespace the session is in
+	ACL            SessionACL        `json:"acl,omitempty"`         // other users' access, granted by the owner
+	Profile        string            `json:"profile,omitempty"`     // profile the session was started with
+	Workspace      string            `json:"workspace,omitempty"`   // workspace that started the session
+	KeepOnExit     bool              `json:"keepOnExit,omitempty"`  // pane stays open after its command exits
+	tmuxSession    string            // tmux session name (e.g., "mux-7701")
+	tmuxSocket     string            // owner's tmux server socket
+	ttydCmd        *exec.Cmd         // current ttyd process (restarts if it exits while tmux persists)
+	viewPort       int               // port of the read-only ttyd for viewers (0 until first needed)
+	viewCmd        *exec.Cmd         // read-only ttyd for viewers, started on demand
+	tokenHash      string            // hash of the session's WEBMUX_TOKEN, kept in tmux to survive restarts
+	theme          map[string]string // terminal color overrides from the profile
+}
+
+// SessionOptions customizes a new session; the zero value gives the defaults
+type SessionOptions struct {
+	Cwd        string            // Starting directory (default: the server's directory, or the owner's home)
+	Env        map[string]string // Extra environment variables for the shell
+	Command    []string          // Program to run instead of the shell
+	Shell      string            // Shell binary (default: -shell)
+	Login      bool              // Start the shell as a login shell
+	Cols       int               // Initial size (default: 200x50)
+	Rows       int
+	Theme      map[string]string // Terminal color overrides (base00-base17)
+	Profile    string            // Profile the options came from
+	Workspace  string            // Workspace starting the session
+	KeepOnExit bool              // Keep the pane and its output when the command or shell exits
+
+	replay string // File printed (then removed) before the shell starts
+}
+
+// validEnvName matches environment variable names a session may set
+var validEnvName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// optionsError reports session options that fail validation (a client error)
+type optionsError struct {
+	err error
+}
+
+func (e *optionsError) Error() string { return e.err.Error() }
+func (e *optionsError) Unwrap() error { return e.err }
+
+// tmuxEscape keeps tmux from reading an argument that ends in ";" as the end of its command
+func tmuxEscape(arg string) string {
+	if strings.HasSuffix(arg, ";") {
+		return arg[:len(arg)-1] + `\;`
+	}
+	return arg
+}
+
+// validate checks the options before a session is started
+func (o SessionOptions) validate() error {
+	if o.Cwd != "" {
+		if !filepath.IsAbs(o.Cwd) {
+			return fmt.Errorf("working directory must be an absolute path: %s", o.Cwd)
+		}
+		if info, err := os.Stat(o.Cwd); err != nil || !info.IsDir() {
+			return fmt.Errorf("working directory does not exist: %s", o.Cwd)
+		}
+	}
+	for key := range o.Env {
+		if !validEnvName.MatchString(key) {
+			return fmt.Errorf("invalid environment variable name %q", key)
+		}
+		if managedEnvVar(key) {
+			return fmt.Errorf("environment variable %s is set by webmux", key)
+		}
+	}
+	if len(o.Command) > 0 {
+		if o.Command[0] == "" {
+			return fmt.Errorf("command must not be empty")
+		}
+		if _, err := exec.LookPath(o.Command[0]); err != nil {
+			return fmt.Errorf("command not found: %s", o.Command[0])
+		}
+	}
+	if o.Shell != "" {
+		if !filepath.IsAbs(o.Shell) {
+			return fmt.Errorf("shell must be an absolute path: %s", o.Shell)
+		}
+		if info, err := os.Stat(o.Shell); err != nil || info.IsDir() || info.Mode()&0111 == 0 {
+			return fmt.Errorf("shell is not an executable file: %s", o.Shell)
+		}
+	}
+	if o.Cols != 0 && (o.Cols < 10 || o.Cols > 1000) || o.Rows != 0 && (o.Rows < 5 || o.Rows > 500) {
+		return fmt.Errorf("size must be 10-1000 columns by 5-500 rows")
+	}
+	for key, color := range o.Theme {
+		if !validThemeKey.MatchString(key) || !validThemeColor.MatchString(color) {
+			return fmt.Errorf("invalid theme color %s=%q (use base00-base17 and #rrggbb)", key, color)
+		}
+	}
+	return nil
 }
 
 // Settings represents user-configurable settings
@@ -186,6 +287,13 @@ type Settings struct {
 	Terminal TerminalColors `json:"terminal"`
 	// Keybar configuration
 	Keybar KeybarSettings `json:"keybar"`
+	// Extra secret patterns masked in logs and captured output
+	Redaction RedactionSettings `json:"redaction"`
+}
+
+// RedactionSettings holds user-defined redaction patterns (Go regular expressions)
+type RedactionSettings struct {
+	Patterns []string `json:"patterns"`
 }
 
 // KeybarSettings represents keybar button configuration
@@ -304,8 +412,7 @@ func xdgDataHome() string {
 }
 
 // xdgStateHome returns XDG_STATE_HOME or ~/.local/state
-// _ for now to silence unused function warning
-func _() string {
+func xdgStateHome() string {
 	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
 		return dir
 	}
@@ -313,14 +420,17 @@ func _() string {
 	return filepath.Join(home, ".local", "state")
 }
 
-// settingsFilePath returns the path to the settings file
-func settingsFilePath() string {
+// settingsFilePath returns the path to a user's settings file ("" = the default user)
+func settingsFilePath(user string) string {
+	if user != "" {
+		return filepath.Join(xdgConfigHome(), "webmux", "users", user, "settings.json")
+	}
 	return filepath.Join(xdgConfigHome(), "webmux", "settings.json")
 }
 
-// LoadSettings loads settings from disk or returns defaults
-func LoadSettings() *Settings {
-	path := settingsFilePath()
+// LoadSettings loads a user's settings from disk or returns defaults
+func LoadSettings(user string) *Settings {
+	path := settingsFilePath(user)
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return DefaultSettings()
@@ -449,9 +559,9 @@ func mergeWithDefaults(s *Settings) {
 	}
 }
 
-// SaveSettings saves settings to disk
-func SaveSettings(settings *Settings) error {
-	path := settingsFilePath()
+// SaveSettings saves a user's settings to disk
+func SaveSettings(user string, settings *Settings) error {
+	path := settingsFilePath(user)
 
 	// Ensure directory exists
 	dir := filepath.Dir(path)
@@ -485,10 +595,18 @@ type SessionManager struct {
 	shell           string
 	workDir         string // Starting directory for new sessions
 	tmuxConfigPath  string
-	wmBinDir        string           // Directory containing wm binary (added to PATH)
-	getSettings     func() *Settings // Function to get current settings
-	serverPort      string           // HTTP server port for WEBMUX_PORT env var
-	onSessionClosed func(string)     // Callback when a session is closed/dies
+	wmBinDir        string                       // Directory containing wm binary (added to PATH)
+	getSettings     func(string) *Settings       // Returns a user's current settings
+	serverPort      string                       // HTTP server port for WEBMUX_PORT env var
+	issueToken      func(string, string) string  // Returns the WEBMUX_TOKEN for a new session and owner (empty if auth is off)
+	restoreToken    func(string, string, string) // Re-registers a reattached session's token hash for its owner
+	keepOnShutdown  bool                         // Leave tmux sessions running on exit (-shutdown keep)
+	closed          bool                         // Set by Cleanup
+	unixUsers       bool                         // Run each owner's tmux server as the Unix user of that name (-unix-users)
+	readOnly        bool                         // Start ttyd without --writable (-readonly)
+	viewerMu        sync.Mutex                   // Serializes starting viewers' read-only ttyds
+	tlsCAPath       string                       // CA/cert file wm should trust (WEBMUX_TLS_CA env var), empty without TLS
+	onSessionClosed func(string)                 // Callback when a session is closed/dies
 }
 
 // NewSessionManager creates a new session manager
@@ -523,12 +641,17 @@ func NewSessionManager(startPort int, shell, workDir, serverPort string) *Sessio
 	if err != nil {
 		log.Printf("Warning: could not read embedded wm binary: %v", err)
 	} else {
-		tmpDir, err := os.MkdirTemp("", "webmux-bin-*")
+		tmpDir, err := wmBinDirPath()
+		if err != nil {
+			log.Printf("Warning: %v, using a new temp dir for wm", err)
+			tmpDir, err = os.MkdirTemp("", "webmux-bin-*")
+		}
 		if err != nil {
 			log.Printf("Warning: could not create temp dir for wm: %v", err)
 		} else {
+			// Replaced, not rewritten: kept sessions may be running the old binary
 			wmPath := filepath.Join(tmpDir, "wm")
-			if err := os.WriteFile(wmPath, wmBin, 0755); err != nil {
+			if err := writeFileAtomic(wmPath, wmBin, 0755); err != nil {
 				log.Printf("Warning: could not write wm binary: %v", err)
 				os.RemoveAll(tmpDir)
 			} else {
@@ -727,8 +850,11 @@ fi
 	return sm
 }
 
-// tmuxSocketPath returns the path to our dedicated tmux socket
-func (sm *SessionManager) tmuxSocketPath() string {
+// tmuxSocketPath returns the path to the tmux socket for a user's sessions ("" = the default user)
+func (sm *SessionManager) tmuxSocketPath(user string) string {
+	if user != "" {
+		return sm.userSocketPath(user)
+	}
 	// Use XDG_DATA_HOME (~/.local/share) for the socket to avoid issues with
 	// XDG_RUNTIME_DIR being cleaned up by systemd when user has no active sessions
 	// (which happens when accessing webmux only via web/VPN without a local login)
@@ -738,6 +864,28 @@ func (sm *SessionManager) tmuxSocketPath() string {
 	return filepath.Join(socketDir, "tmux.sock")
 }
 
+// wmBinDirPath returns the directory for the wm helper and shell init scripts.
+// It is stable per user and data directory, so sessions kept by -shutdown keep
+// go on using it after a restart instead of every start leaving a temp dir behind.
+// It stays in the temp dir so -unix-users shells can reach it.
+func wmBinDirPath() (string, error) {
+	sum := sha256.Sum256([]byte(xdgDataHome()))
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("webmux-bin-%d-%x", os.Getuid(), sum[:4]))
+	if err := os.Mkdir(dir, 0700); err != nil && !errors.Is(err, os.ErrExist) {
+		return "", err
+	}
+	// The name is predictable, so refuse a directory someone else planted
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !info.IsDir() || !ok || int(stat.Uid) != os.Getuid() || info.Mode().Perm()&0022 != 0 {
+		return "", fmt.Errorf("%s is not a private directory owned by this user", dir)
+	}
+	return dir, nil
+}
+
 // sessionEnvArgs returns tmux -e arguments for setting session environment variables
 func (sm *SessionManager) sessionEnvArgs() []string {
 	var args []string
@@ -745,6 +893,11 @@ func (sm *SessionManager) sessionEnvArgs() []string {
 	// Add WEBMUX_PORT so wm CLI knows which server to talk to
 	args = append(args, "-e", "WEBMUX_PORT="+sm.serverPort)
 
+	// Tell wm to use HTTPS and which certificate to trust
+	if sm.tlsCAPath != "" {
+		args = append(args, "-e", "WEBMUX_SCHEME=https", "-e", "WEBMUX_TLS_CA="+sm.tlsCAPath)
+	}
+
 	// Set _wm_bin env var to the path of the wm binary (used by shell wrapper)
 	if sm.wmBinDir != "" {
 		args = append(args, "-e", "_wm_bin="+filepath.Join(sm.wmBinDir, "wm"))
@@ -753,8 +906,11 @@ func (sm *SessionManager) sessionEnvArgs() []string {
 	return args
 }
 
-// CreateSession spawns a new tmux session with ttyd attached
-func (sm *SessionManager) CreateSession(name string) (*Session, error) {
+// CreateSession spawns a new tmux session with ttyd attached in owner's namespace
+func (sm *SessionManager) CreateSession(name, owner string, opts SessionOptions) (*Session, error) {
+	if err := opts.validate(); err != nil {
+		return nil, &optionsError{err}
+	}
 	port := int(atomic.AddInt32(&sm.nextPort, 1))
 	id := fmt.Sprintf("session-%d", port)
 	tmuxSession := fmt.Sprintf("mux-%d", port)
@@ -764,6 +920,9 @@ func (sm *SessionManager) CreateSession(name string) (*Session, error) {
 		sm.mu.RLock()
 		maxNum := 0
 		for _, s := range sm.sessions {
+			if s.Owner != owner {
+				continue
+			}
 			if num, err := strconv.Atoi(s.Name); err == nil && num > maxNum {
 				maxNum = num
 			}
@@ -772,20 +931,58 @@ func (sm *SessionManager) CreateSession(name string) (*Session, error) {
 		name = strconv.Itoa(maxNum + 1)
 	}
 
-	tmuxSocket := sm.tmuxSocketPath()
+	tmuxSocket := sm.tmuxSocketPath(owner)
+	workDir := sm.workDir
+	var account *unixAccount
+	if sm.unixUsers && owner != "" {
+		var err error
+		if account, err = lookupUnixAccount(owner); err != nil {
+			return nil, err
+		}
+		if err := account.checkOptions(opts); err != nil {
+			return nil, &optionsError{err}
+		}
+		workDir = account.home
+	}
+	if opts.Cwd != "" {
+		workDir = opts.Cwd
+	}
 
 	// Build tmux command with our custom config
 	// -S: socket path, -f: config file, -d: detached, -s: session name, -x/-y: initial size, -c: start dir
 	// -e: environment variables for the session
 	tmuxArgs := []string{"-S", tmuxSocket}
+	if account != nil {
+		// Let tmux create and check its per-uid socket directory as the owner
+		tmuxArgs = []string{"-L", filepath.Base(tmuxSocket)}
+	}
 	if sm.tmuxConfigPath != "" {
 		tmuxArgs = append(tmuxArgs, "-f", sm.tmuxConfigPath)
 	}
-	tmuxArgs = append(tmuxArgs, "new-session", "-d", "-s", tmuxSession, "-x", "200", "-y", "50")
+	cols, rows := 200, 50
+	if opts.Cols > 0 {
+		cols = opts.Cols
+	}
+	if opts.Rows > 0 {
+		rows = opts.Rows
+	}
+	commandStart := len(tmuxArgs)
+	tmuxArgs = append(tmuxArgs, "new-session", "-d", "-s", tmuxSession, "-x", strconv.Itoa(cols), "-y", strconv.Itoa(rows))
 	// Add environment variables (-e must come after new-session)
+	for _, key := range slices.Sorted(maps.Keys(opts.Env)) {
+		tmuxArgs = append(tmuxArgs, "-e", key+"="+opts.Env[key])
+	}
 	tmuxArgs = append(tmuxArgs, sm.sessionEnvArgs()...)
 	// Add session ID so wm CLI knows which session it's in
 	tmuxArgs = append(tmuxArgs, "-e", "WEBMUX_SESSION="+id)
+	// Add a session-scoped API token so wm can authenticate when login is required
+	var tokenHash string
+	if sm.issueToken != nil {
+		if token := sm.issueToken(id, owner); token != "" {
+			tmuxArgs = append(tmuxArgs, "-e", "WEBMUX_TOKEN="+token)
+			tokenHash = hashToken(token)
+		}
+	}
 	// Signal that OSC 52 clipboard is supported (webmux intercepts and handles it)
 	// Apps can check this to enable OSC 52 clipboard integration
 	tmuxArgs = append(tmuxArgs, "-e", "WEBMUX_CLIPBOARD=osc52")
@@ -803,11 +1000,17 @@ func (sm *SessionManager) CreateSession(name string) (*Session, error) {
 		initPath := filepath.Join(sm.wmBinDir, "init.sh")
 		tmuxArgs = append(tmuxArgs, "-e", "WEBMUX_INIT="+initPath)
 	}
-	if sm.workDir != "" {
-		tmuxArgs = append(tmuxArgs, "-c", sm.workDir)
+	if workDir != "" {
+		tmuxArgs = append(tmuxArgs, "-c", workDir)
 	}
 	// Determine how to inject our init based on shell type
-	shellBase := filepath.Base(sm.shell)
+	shell := sm.shell
+	if opts.Shell != "" {
+		shell = opts.Shell
+	}
+	shellBase := filepath.Base(shell)
+	shellCmd := []string{shell}
+	loginFlag := opts.Login
 	if sm.wmBinDir != "" {
 		initPath := filepath.Join(sm.wmBinDir, "init.sh")
 		switch shellBase {
@@ -817,8 +1020,20 @@ func (sm *SessionManager) CreateSession(name string) (*Session, error) {
 			rcContent := fmt.Sprintf(`[ -f ~/.bashrc ] && . ~/.bashrc
 . %s
 `, initPath)
+			if opts.Login {
+				// A login bash ignores --rcfile, so read the login files from it instead
+				rcPath = filepath.Join(sm.wmBinDir, "bash_login")
+				rcContent = fmt.Sprintf(`[ -f /etc/profile ] && . /etc/profile
+if [ -f ~/.bash_profile ]; then . ~/.bash_profile
+elif [ -f ~/.bash_login ]; then . ~/.bash_login
+elif [ -f ~/.profile ]; then . ~/.profile
+fi
+. %s
+`, initPath)
+				loginFlag = false
+			}
 			os.WriteFile(rcPath, []byte(rcContent), 0644)
-			tmuxArgs = append(tmuxArgs, sm.shell, "--rcfile", rcPath)
+			shellCmd = append(shellCmd, "--rcfile", rcPath)
 		case "zsh":
 			// zsh: use ZDOTDIR with custom rc files that source user's config then our init
 			zdotdir := filepath.Join(sm.wmBinDir, "zsh")
@@ -837,18 +1052,39 @@ func (sm *SessionManager) CreateSession(name string) (*Session, error) {
 `, initPath)
 			os.WriteFile(filepath.Join(zdotdir, ".zshrc"), []byte(zshrcContent), 0644)
 			tmuxArgs = append(tmuxArgs, "-e", "ZDOTDIR="+zdotdir)
-			tmuxArgs = append(tmuxArgs, sm.shell)
 		default:
 			// Other shells: set ENV for POSIX compliance
 			tmuxArgs = append(tmuxArgs, "-e", "ENV="+initPath)
-			tmuxArgs = append(tmuxArgs, sm.shell)
 		}
-	} else {
-		tmuxArgs = append(tmuxArgs, sm.shell)
+	}
+	if loginFlag {
+		shellCmd = append(shellCmd, "-l")
+	}
+	if len(opts.Command) > 0 {
+		shellCmd = opts.Command
+	}
+	if opts.replay != "" {
+		// Print the restored scrollback before the shell starts
+		if account != nil {
+			os.Chown(opts.replay, int(account.uid), int(account.gid))
+		}
+		shellCmd = append([]string{"/bin/sh", "-c", `cat -- "$0"; rm -f -- "$0"; exec "$@"`, opts.replay}, shellCmd...)
+	}
+	tmuxArgs = append(tmuxArgs, shellCmd...)
+	for i := commandStart; i < len(tmuxArgs); i++ {
+		tmuxArgs[i] = tmuxEscape(tmuxArgs[i])
+	}
+	if opts.KeepOnExit {
+		// Run in the same command queue, so even a command that exits at once is kept
+		tmuxArgs = append(tmuxArgs, ";", "set-option", "-w", "-t", tmuxSession, "remain-on-exit", "on")
 	}
 
 	tmuxCmd := exec.Command("tmux", tmuxArgs...)
 	tmuxCmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if account != nil {
+		// The tmux server (and every shell it starts) runs as the owner
+		account.apply(tmuxCmd)
+	}
 
 	if out, err := tmuxCmd.CombinedOutput(); err != nil {
 		return nil, fmt.Errorf("failed to create tmux session: %w: %s", err, string(out))
@@ -868,8 +1104,17 @@ func (sm *SessionManager) CreateSession(name string) (*Session, error) {
 		Name:        name,
 		Port:        port,
 		CreatedAt:   time.Now(),
+		Owner:       owner,
 		tmuxSession: tmuxSession,
+		tmuxSocket:  tmuxSocket,
+		tokenHash:   tokenHash,
+		Profile:     opts.Profile,
+		Workspace:   opts.Workspace,
+		KeepOnExit:  opts.KeepOnExit,
+		theme:       opts.Theme,
 	}
+	// Record the session in tmux so a restarted server can reattach to it
+	sm.tagTmuxSession(session)
 
 	// Start ttyd attached to the tmux session (must be called without lock)
 	if err := sm.startTtyd(session); err != nil {
@@ -890,19 +1135,134 @@ func (sm *SessionManager) CreateSession(name string) (*Session, error) {
 	return session, nil
 }
 
+// CloneOptions returns options that start a session where another session's
+// pane is: in its current directory and, with env, with the variables set on it
+func (sm *SessionManager) CloneOptions(id string, env bool) (SessionOptions, error) {
+	var opts SessionOptions
+	session, ok := sm.GetSession(id)
+	if !ok {
+		return opts, fmt.Errorf("session not found: %s", id)
+	}
+	out, err := exec.Command("tmux", "-S", session.tmuxSocket, "display-message", "-p", "-t", session.tmuxSession,
+		"#{pane_current_path}").Output()
+	if err != nil {
+		return opts, fmt.Errorf("failed to read the directory of %s: %w", id, err)
+	}
+	// A directory removed since falls back to the default one
+	cwd := strings.TrimSuffix(string(out), "\n")
+	if info, err := os.Stat(cwd); err == nil && info.IsDir() {
+		opts.Cwd = cwd
+	}
+	if env {
+		opts.Env = sm.sessionEnvOverrides(session)
+	}
+	return opts, nil
+}
+
 // startTtyd starts a ttyd process attached to the session's tmux session
 // NOTE: This must be called WITHOUT holding sm.mu lock
 func (sm *SessionManager) startTtyd(session *Session) error {
-	tmuxSocket := sm.tmuxSocketPath()
+	cmd := exec.Command("ttyd", sm.ttydArgs(session, session.Port, !sm.readOnly)...)
+	// Don't inherit stdout/stderr to avoid echoing to parent terminal
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ttyd: %w", err)
+	}
+
+	session.ttydCmd = cmd
+	sm.setTmuxOption(session, tmuxOptTtydPid, strconv.Itoa(cmd.Process.Pid))
+
+	// Monitor ttyd process and restart when client disconnects
+	go sm.handleTtydExit(session, cmd)
+
+	waitForPort(session.Port)
+	return nil
+}
+
+// ViewerPort returns the port of the session's read-only ttyd, starting it on
+// first use. Viewers never reach the writable ttyd, so they cannot type even if
+// a frame slips past the proxy's filter.
+func (sm *SessionManager) ViewerPort(session *Session) (int, error) {
+	if sm.readOnly {
+		return session.Port, nil
+	}
+	sm.viewerMu.Lock()
+	defer sm.viewerMu.Unlock()
+
+	sm.mu.RLock()
+	_, open := sm.sessions[session.ID]
+	port, running := session.viewPort, session.viewCmd != nil
+	sm.mu.RUnlock()
+	if !open {
+		return 0, fmt.Errorf("session not found: %s", session.ID)
+	}
+	if running {
+		return port, nil
+	}
+
+	if port == 0 {
+		port = int(atomic.AddInt32(&sm.nextPort, 1))
+	}
+	cmd := exec.Command("ttyd", sm.ttydArgs(session, port, false)...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start viewer ttyd: %w", err)
+	}
+	sm.mu.Lock()
+	session.viewPort, session.viewCmd = port, cmd
+	sm.mu.Unlock()
+	log.Printf("Session %s: started read-only ttyd for viewers on port %d", session.ID, port)
+
+	// Started again by the next viewer if it exits
+	go func() {
+		cmd.Wait()
+		sm.mu.Lock()
+		if session.viewCmd == cmd {
+			session.viewCmd = nil
+		}
+		sm.mu.Unlock()
+	}()
+
+	waitForPort(port)
+	return port, nil
+}
+
+// stopViewer kills the session's read-only ttyd, if running
+// Must be called with sm.mu held
+func (session *Session) stopViewer() {
+	if session.viewCmd != nil && session.viewCmd.Process != nil {
+		session.viewCmd.Process.Kill()
+	}
+	session.viewCmd = nil
+}
+
+// waitForPort waits briefly for a freshly started ttyd to accept connections
+func waitForPort(port int) {
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	for range 50 {
+		conn, err := net.DialTimeout("tcp", addr, 10*time.Millisecond)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// ttydArgs builds the ttyd command line attaching to the session's tmux session
+func (sm *SessionManager) ttydArgs(session *Session, port int, writable bool) []string {
+	tmuxSocket := session.tmuxSocket
 	tmuxSession := session.tmuxSession
 
-	// Get terminal colors from settings
+	// Get terminal colors from the owner's settings
 	var termColors TerminalColors
 	if sm.getSettings != nil {
-		termColors = sm.getSettings().Terminal
+		termColors = sm.getSettings(session.Owner).Terminal
 	} else {
 		termColors = DefaultSettings().Terminal
 	}
+	termColors = applyTheme(termColors, session.theme)
 
 	// Build theme JSON for ttyd using Base24 mapping
 	// ttyd xterm.js theme format -> Base24 mapping:
@@ -920,17 +1280,23 @@ func (sm *SessionManager) startTtyd(session *Session) error {
 
 	// No --once: ttyd stays running and each client connection runs tmux attach
 	// Multiple tmux attach calls to the same session share the view
+	// ttyd is only reached through the proxy, so keep it off external interfaces
 	args := []string{
-		"--port", strconv.Itoa(session.Port),
-		"--writable",
+		"--interface", "127.0.0.1",
+		"--port", strconv.Itoa(port),
+	}
+	if writable {
+		args = append(args, "--writable")
+	}
+	args = append(args,
 		"--client-option", "fontSize=14",
 		"--client-option", "fontFamily=JetBrains Mono,Fira Code,SF Mono,Menlo,Monaco,Courier New,monospace",
-		"--client-option", "theme=" + themeJSON,
+		"--client-option", "theme="+themeJSON,
 		"--client-option", "disableLeaveAlert=true",
 		"--client-option", "scrollback=50000",
 		"--client-option", "allowProposedApi=true",
 		"--client-option", "rightClickSelectsWord=true",
-	}
+	)
 
 	// Build tmux attach command with our config
 	tmuxArgs := []string{"-S", tmuxSocket}
@@ -940,32 +1306,7 @@ func (sm *SessionManager) startTtyd(session *Session) error {
 	tmuxArgs = append(tmuxArgs, "attach-session", "-t", tmuxSession)
 
 	args = append(args, "tmux")
-	args = append(args, tmuxArgs...)
-
-	cmd := exec.Command("ttyd", args...)
-	// Don't inherit stdout/stderr to avoid echoing to parent terminal
-	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
-
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start ttyd: %w", err)
-	}
-
-	session.ttydCmd = cmd
-
-	// Monitor ttyd process and restart when client disconnects
-	go sm.handleTtydExit(session, cmd)
-
-	// Wait for ttyd to be ready (port accepting connections)
-	addr := fmt.Sprintf("127.0.0.1:%d", session.Port)
-	for range 50 {
-		conn, err := net.DialTimeout("tcp", addr, 10*time.Millisecond)
-		if err == nil {
-			conn.Close()
-			break
-		}
-		time.Sleep(10 * time.Millisecond)
-	}
-	return nil
+	return append(args, tmuxArgs...)
 }
 
 // handleTtydExit handles ttyd process exit and restarts for reconnection
@@ -983,8 +1324,7 @@ func (sm *SessionManager) handleTtydExit(session *Session, cmd *exec.Cmd) {
 	}
 
 	// Check if tmux session still exists
-	tmuxSocket := sm.tmuxSocketPath()
-	checkCmd := exec.Command("tmux", "-S", tmuxSocket, "has-session", "-t", session.tmuxSession)
+	checkCmd := exec.Command("tmux", "-S", session.tmuxSocket, "has-session", "-t", session.tmuxSession)
 	if err := checkCmd.Run(); err != nil {
 		// tmux session is gone, clean up
 		log.Printf("Session %s: tmux session %s no longer exists, cleaning up", session.ID, session.tmuxSession)
@@ -1016,7 +1356,7 @@ func (sm *SessionManager) handleTtydExit(session *Session, cmd *exec.Cmd) {
 // monitorSession watches the tmux session to detect when the shell exits
 // and updates the current foreground process
 func (sm *SessionManager) monitorSession(session *Session) {
-	tmuxSocket := sm.tmuxSocketPath()
+	tmuxSocket := session.tmuxSocket
 	startTime := time.Now()
 	checkCount := 0
 
@@ -1053,7 +1393,7 @@ func (sm *SessionManager) monitorSession(session *Session) {
 		}
 
 		// Update current foreground process
-		proc := sm.getForegroundProcess(tmuxSession)
+		proc := sm.getForegroundProcess(tmuxSocket, tmuxSession)
 		sm.mu.Lock()
 		if s, ok := sm.sessions[session.ID]; ok {
 			s.CurrentProcess = proc
@@ -1065,9 +1405,7 @@ func (sm *SessionManager) monitorSession(session *Session) {
 }
 
 // getForegroundProcess returns the name of the foreground process in the terminal
-func (sm *SessionManager) getForegroundProcess(tmuxSession string) string {
-	tmuxSocket := sm.tmuxSocketPath()
-
+func (sm *SessionManager) getForegroundProcess(tmuxSocket, tmuxSession string) string {
 	// Use tmux to get the current command in the pane
 	out, err := exec.Command("tmux", "-S", tmuxSocket, "display-message", "-p", "-t", tmuxSession, "#{pane_current_command}").Output()
 	if err != nil {
@@ -1116,8 +1454,7 @@ func (sm *SessionManager) CloseSession(id string) error {
 
 	// Kill tmux session
 	if session.tmuxSession != "" {
-		tmuxSocket := sm.tmuxSocketPath()
-		exec.Command("tmux", "-S", tmuxSocket, "kill-session", "-t", session.tmuxSession).Run()
+		exec.Command("tmux", "-S", session.tmuxSocket, "kill-session", "-t", session.tmuxSession).Run()
 	}
 
 	sm.deleteSession(id)
@@ -1141,6 +1478,9 @@ func (sm *SessionManager) resetCounters() {
 // deleteSession removes a session from the map and notifies the callback
 // Must be called with sm.mu held
 func (sm *SessionManager) deleteSession(id string) {
+	if session, ok := sm.sessions[id]; ok {
+		session.stopViewer()
+	}
 	delete(sm.sessions, id)
 	if sm.onSessionClosed != nil {
 		// Call outside of lock to avoid deadlock
@@ -1159,6 +1499,7 @@ func (sm *SessionManager) RenameSession(id, name string) error {
 	}
 
 	session.Name = name
+	sm.setTmuxOption(session, tmuxOptName, name)
 	return nil
 }
 
@@ -1247,6 +1588,7 @@ func (sm *SessionManager) SendKeys(id string, req *KeysRequest) error {
 		return fmt.Errorf("session not found: %s", id)
 	}
 	tmuxSession := session.tmuxSession
+	tmuxSocket := session.tmuxSocket
 	sm.mu.RUnlock()
 
 	// Validate tmux session name format (defense in depth)
@@ -1255,8 +1597,6 @@ func (sm *SessionManager) SendKeys(id string, req *KeysRequest) error {
 		return fmt.Errorf("invalid tmux session name")
 	}
 
-	tmuxSocket := sm.tmuxSocketPath()
-
 	// Build the sequence of steps to execute
 	var steps []KeyStep
 
@@ -1327,26 +1667,47 @@ func (sm *SessionManager) SendKeys(id string, req *KeysRequest) error {
 	return nil
 }
 
-// Cleanup terminates all sessions
+// Cleanup terminates all sessions, or with -shutdown keep only their ttyd
+// processes, leaving tmux running for the next start to reattach
 func (sm *SessionManager) Cleanup() {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
+	sm.closed = true
 
-	tmuxSocket := sm.tmuxSocketPath()
+	if sm.keepOnShutdown {
+		for id, session := range sm.sessions {
+			if session.ttydCmd != nil && session.ttydCmd.Process != nil {
+				session.ttydCmd.Process.Kill()
+			}
+			session.stopViewer()
+			log.Printf("Detached session %s (tmux session %s kept)", id, session.tmuxSession)
+		}
+		sm.sessions = make(map[string]*Session)
+		// The surviving shells still use the extracted wm helper and init scripts
+		if sm.tmuxConfigPath != "" {
+			os.Remove(sm.tmuxConfigPath)
+		}
+		return
+	}
 
+	sockets := map[string]bool{sm.tmuxSocketPath(""): true}
 	for id, session := range sm.sessions {
 		if session.ttydCmd != nil && session.ttydCmd.Process != nil {
 			session.ttydCmd.Process.Kill()
 		}
+		session.stopViewer()
 		if session.tmuxSession != "" {
-			exec.Command("tmux", "-S", tmuxSocket, "kill-session", "-t", session.tmuxSession).Run()
+			exec.Command("tmux", "-S", session.tmuxSocket, "kill-session", "-t", session.tmuxSession).Run()
 		}
+		sockets[session.tmuxSocket] = true
 		log.Printf("Cleaned up session %s", id)
 	}
 	sm.sessions = make(map[string]*Session)
 
-	// Kill the entire tmux server on our socket
-	exec.Command("tmux", "-S", tmuxSocket, "kill-server").Run()
+	// Kill the entire tmux server on each of our sockets
+	for socket := range sockets {
+		exec.Command("tmux", "-S", socket, "kill-server").Run()
+	}
 
 	// Clean up temp files
 	if sm.tmuxConfigPath != "" {
@@ -1357,6 +1718,13 @@ func (sm *SessionManager) Cleanup() {
 	}
 }
 
+// Closed reports whether Cleanup has run
+func (sm *SessionManager) Closed() bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.closed
+}
+
 // MarkedFile represents a file or directory marked for download
 type MarkedFile struct {
 	Path    string `json:"path"`
@@ -1385,6 +1753,7 @@ type UIState struct {
 	GroupCounter     int       `json:"groupCounter"`
 	SidebarCollapsed bool      `json:"sidebarCollapsed"`
 	CustomNames      []string  `json:"customNames"` // session IDs with custom names
+	Revision         int64     `json:"revision"`    // bumped when the server changes the layout itself
 }
 
 // SECTION: SERVER
@@ -1392,6 +1761,20 @@ type UIState struct {
 // Server holds the HTTP server and session manager
 type Server struct {
 	manager          *SessionManager
+	auth             *AuthManager
+	files            *FileSandbox       // Allowed roots and denied paths for file handlers
+	shares           *ShareManager      // Read-only share links
+	audit            *AuditLog          // Append-only audit log (nil if disabled)
+	store            *StateStore        // Persisted state, encrypted with -encrypt-state
+	resurrect        *Resurrector       // Saved session definitions (nil with -resurrect off)
+	snapshots        *Snapshotter       // Scrollback snapshots (nil with -snapshot-interval 0)
+	limiter          *RateLimiter       // Per-client rate limits on expensive routes
+	readOnly         bool               // Reject state changes and terminal input (-readonly)
+	multiUser        bool               // Give each user their own namespace (-multi-user)
+	user             string             // User this server's state belongs to ("" = the default user)
+	tenants          map[string]*Server // Per-user state in -multi-user mode (default server only)
+	tenantsMu        sync.Mutex
+	root             *Server // The default server, for tenants (nil on the default server)
 	uploadDir        string
 	settings         *Settings
 	settingsMu       sync.RWMutex
@@ -1403,11 +1786,21 @@ type Server struct {
 	markedMu         sync.RWMutex
 	markedSubs       map[chan string]struct{} // SSE subscribers for marked files
 	markedSubMu      sync.Mutex
-	uiState          *UIState // UI layout state (groups, order, etc.)
+	uiState          *UIState          // UI layout state (groups, order, etc.)
+	uiHistory        []UIStateSnapshot // Previous layouts for undo, oldest first
+	uiStateChangedAt time.Time         // Last layout change, to coalesce undo steps
+	uiStateWritten   []byte            // Last state saved to ui-state.json
 	uiStateMu        sync.RWMutex
+	workspaceMu      sync.Mutex   // Serializes applying workspaces
 	clipboard        string       // Server-side clipboard for wm CLI
 	clipboardVersion uint64       // Increments on each clipboard change
-	clipboardMu      sync.RWMutex // Protects clipboard and clipboardVersion
+	clipboardPolicy  string       // Default OSC 52 policy (-osc52)
+	pendingVersion   uint64       // Increments when clipboardPending changes
+	clipboardMu      sync.RWMutex // Protects clipboard, clipboardVersion, clipboardPending and osc52Recent
+	// OSC 52 writes waiting for approval (-osc52 confirm)
+	clipboardPending []*ClipboardRequest
+	// Last OSC 52 write handled per session, so each is handled once across tabs
+	osc52Recent map[string]osc52Write
 }
 
 // NewServer creates a new server instance
@@ -1415,24 +1808,36 @@ func NewServer(manager *SessionManager, uploadDir string) *Server {
 	s := &Server{
 		manager:     manager,
 		uploadDir:   uploadDir,
-		settings:    LoadSettings(),
+		settings:    LoadSettings(""),
 		scratchSubs: make(map[chan string]struct{}),
 		markedFiles: make([]MarkedFile, 0),
 		markedSubs:  make(map[chan string]struct{}),
+		shares:      NewShareManager(),
 		uiState: &UIState{
 			Groups:     make([]UIGroup, 0),
 			GroupOrder: make([]string, 0),
 		},
 	}
+	s.applyRedactionSettings()
 	// Wire up settings getter for session manager
-	manager.getSettings = func() *Settings {
-		s.settingsMu.RLock()
-		defer s.settingsMu.RUnlock()
-		return s.settings
+	manager.getSettings = func(user string) *Settings {
+		t := s.tenant(user)
+		t.settingsMu.RLock()
+		defer t.settingsMu.RUnlock()
+		return t.settings
 	}
 	// Wire up session cleanup callback
 	manager.onSessionClosed = func(sessionID string) {
-		s.removeSessionFromUIState(sessionID)
+		s.eachTenant(func(t *Server) {
+			t.removeSessionFromUIState(sessionID)
+			t.dropPendingClipboard(sessionID)
+		})
+		s.shares.RevokeSession(sessionID)
+		s.resurrect.requestSave()
+		s.pruneSnapshots()
+		if s.auth != nil {
+			s.auth.tokens.RevokeSessionTokens(sessionID)
+		}
 	}
 	return s
 }
@@ -1443,7 +1848,7 @@ func NewServer(manager *SessionManager, uploadDir string) *Server {
 func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	sessions := s.manager.ListSessions()
+	sessions := s.manager.ListSessionsFor(s.user)
 
 	json.NewEncoder(w).Encode(map[string]any{
 		"workDir":      s.manager.workDir,
@@ -1451,7 +1856,14 @@ func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
 		"shell":        s.manager.shell,
 		"port":         s.manager.serverPort,
 		"sessionCount": len(sessions),
-		"tmuxSocket":   s.manager.tmuxSocketPath(),
+		"tmuxSocket":   s.manager.tmuxSocketPath(s.user),
+		"authEnabled":  s.auth != nil && s.auth.Enabled(),
+		"tls":          s.manager.tlsCAPath != "",
+		"user":         requestUser(r),
+		"readOnly":     s.readOnly,
+		"multiUser":    s.multiUser,
+		"rateLimits":   s.limiter.Stats(),
+		"osc52Policy":  s.clipboardPolicy,
 	})
 }
 
@@ -1464,6 +1876,10 @@ func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if !isAdmin(r, s.multiUser) {
+		http.Error(w, "Forbidden: server logs are admin only", http.StatusForbidden)
+		return
+	}
 
 	// Prevent caching of logs
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
@@ -1651,14 +2067,20 @@ func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
 		// Merge with defaults to fill in any missing values
 		mergeWithDefaults(&settings)
 
+		if err := redactor.SetCustom(s.user, settings.Redaction.Patterns); err != nil {
+			http.Error(w, "Invalid settings: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		s.settingsMu.Lock()
 		s.settings = &settings
 		s.settingsMu.Unlock()
 
-		if err := SaveSettings(&settings); err != nil {
+		if err := SaveSettings(s.user, &settings); err != nil {
 			http.Error(w, "Failed to save settings: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
+		s.audit.Record(r, AuditSettingsWrite, "", nil)
 
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]string{"status": "saved"})
@@ -1698,10 +2120,8 @@ func (s *Server) handleClipboard(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Failed to read body: "+err.Error(), http.StatusBadRequest)
 			return
 		}
-		s.clipboardMu.Lock()
-		s.clipboard = string(body)
-		s.clipboardVersion++
-		s.clipboardMu.Unlock()
+		s.setClipboard(string(body))
+		s.audit.Record(r, AuditClipboardWrite, "", map[string]any{"source": "api", "bytes": len(body)})
 		w.WriteHeader(http.StatusOK)
 
 	default:
@@ -1718,7 +2138,10 @@ func (s *Server) handleClipboardVersion(w http.ResponseWriter, r *http.Request)
 	}
 	s.clipboardMu.RLock()
 	v := s.clipboardVersion
+	pending := s.pendingVersion
 	s.clipboardMu.RUnlock()
+	// Lets polling browsers notice OSC 52 writes waiting for approval
+	w.Header().Set("X-Clipboard-Pending", strconv.FormatUint(pending, 10))
 	w.Header().Set("Content-Type", "text/plain")
 	w.Header().Set("Cache-Control", "no-cache, no-store")
 	fmt.Fprintf(w, "%d", v)
@@ -1744,13 +2167,21 @@ func (s *Server) handleUIState(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Invalid state: "+err.Error(), http.StatusBadRequest)
 			return
 		}
+		// Don't let a browser that missed a server-side change (a restored or
+		// applied workspace, an undo) save its older layout over it
+		s.uiStateMu.RLock()
+		current := s.uiState
+		s.uiStateMu.RUnlock()
+		if current != nil && state.Revision != 0 && state.Revision < current.Revision {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(s.validateUIState(current))
+			return
+		}
 
 		// Validate against current sessions
+		sanitizeUIState(&state)
 		validState := s.validateUIState(&state)
-
-		s.uiStateMu.Lock()
-		s.uiState = validState
-		s.uiStateMu.Unlock()
+		s.setUIState(validState)
 
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(validState)
@@ -1771,7 +2202,7 @@ func (s *Server) validateUIState(state *UIState) *UIState {
 	}
 
 	// Get current valid session IDs
-	sessions := s.manager.ListSessions()
+	sessions := s.manager.ListSessionsFor(s.user)
 	validSessionIDs := make(map[string]bool)
 	for _, sess := range sessions {
 		validSessionIDs[sess.ID] = true
@@ -1857,6 +2288,7 @@ func (s *Server) validateUIState(state *UIState) *UIState {
 		GroupCounter:     groupCounter,
 		SidebarCollapsed: state.SidebarCollapsed,
 		CustomNames:      validCustomNames,
+		Revision:         state.Revision,
 	}
 }
 
@@ -1864,7 +2296,13 @@ func (s *Server) validateUIState(state *UIState) *UIState {
 func (s *Server) removeSessionFromUIState(sessionID string) {
 	s.uiStateMu.Lock()
 	defer s.uiStateMu.Unlock()
+	s.removeSessionsFromUIStateLocked(map[string]bool{sessionID: true})
+	s.saveUIStateLocked()
+}
 
+// removeSessionsFromUIStateLocked takes sessions out of their groups and
+// custom names (uiStateMu must be held)
+func (s *Server) removeSessionsFromUIStateLocked(ids map[string]bool) {
 	if s.uiState == nil {
 		return
 	}
@@ -1877,7 +2315,7 @@ func (s *Server) removeSessionFromUIState(sessionID string) {
 		originalCount := len(group.SessionIDs)
 		newSessionIDs := make([]string, 0)
 		for _, sid := range group.SessionIDs {
-			if sid != sessionID {
+			if !ids[sid] {
 				newSessionIDs = append(newSessionIDs, sid)
 			}
 		}
@@ -1916,7 +2354,7 @@ func (s *Server) removeSessionFromUIState(sessionID string) {
 	// Remove from custom names
 	newCustomNames := make([]string, 0)
 	for _, sid := range s.uiState.CustomNames {
-		if sid != sessionID {
+		if !ids[sid] {
 			newCustomNames = append(newCustomNames, sid)
 		}
 	}
@@ -1961,35 +2399,111 @@ func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodGet:
-		// List all sessions
-		sessions := s.manager.ListSessions()
+		// List the sessions this user owns or was granted
+		sessions := s.manager.ListSessionsFor(s.user)
 		json.NewEncoder(w).Encode(sessions)
 
 	case http.MethodPost:
-		// Create new session
+		// Create new session; the fields below override the profile's
 		var req struct {
-			Name string `json:"name"`
+			Name       string            `json:"name"`
+			Profile    string            `json:"profile"` // Default: the user's default profile, if any
+			Cwd        string            `json:"cwd"`     // Absolute, or starting with ~
+			Command    []string          `json:"command"` // Argv run instead of the shell
+			Env        map[string]string `json:"env"`
+			Shell      string            `json:"shell"`
+			Cols       int               `json:"cols"`
+			Rows       int               `json:"rows"`
+			KeepOnExit *bool             `json:"keepOnExit"`
+			CloneFrom  string            `json:"cloneFrom"` // Start in this session's current directory
+			CloneEnv   bool              `json:"cloneEnv"`  // and with its environment variables
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts, err := s.profileOptions(req.Profile)
+		if err != nil {
+			http.Error(w, "Invalid profile: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.CloneFrom != "" {
+			switch s.sessionAccess(req.CloneFrom) {
+			case "":
+				http.Error(w, "session not found: "+req.CloneFrom, http.StatusNotFound)
+				return
+			case AccessView:
+				http.Error(w, "Cloning a session requires control access", http.StatusForbidden)
+				return
+			}
+			clone, err := s.manager.CloneOptions(req.CloneFrom, req.CloneEnv)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if clone.Cwd != "" {
+				opts.Cwd = clone.Cwd
+			}
+			if len(clone.Env) > 0 {
+				if opts.Env == nil {
+					opts.Env = make(map[string]string)
+				}
+				maps.Copy(opts.Env, clone.Env)
+			}
+		}
+		if req.Cwd != "" {
+			opts.Cwd = expandCwd(req.Cwd, s.manager.homeDir(s.user))
+		}
+		if len(req.Command) > 0 {
+			opts.Command = req.Command
+		}
+		if len(req.Env) > 0 {
+			if opts.Env == nil {
+				opts.Env = make(map[string]string)
+			}
+			maps.Copy(opts.Env, req.Env)
+		}
+		if req.Shell != "" {
+			opts.Shell = req.Shell
+		}
+		if req.Cols != 0 || req.Rows != 0 {
+			opts.Cols, opts.Rows = req.Cols, req.Rows
+		}
+		if req.KeepOnExit != nil {
+			opts.KeepOnExit = *req.KeepOnExit
 		}
-		json.NewDecoder(r.Body).Decode(&req)
 
 		// Log session creation with origin info for debugging
 		origin := r.Header.Get("Origin")
 		if origin == "" {
 			origin = r.Header.Get("Referer")
 		}
-		remoteAddr := r.RemoteAddr
-		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
-			remoteAddr = fwd
-		}
-		log.Printf("Session create request from %s (origin: %s)", remoteAddr, origin)
+		log.Printf("Session create request from %s (origin: %s)", clientDescription(r), origin)
 
-		session, err := s.manager.CreateSession(req.Name)
+		session, err := s.manager.CreateSession(req.Name, s.user, opts)
+		var optErr *optionsError
+		if errors.As(err, &optErr) {
+			http.Error(w, "Invalid session options: "+err.Error(), http.StatusBadRequest)
+			return
+		}
 		if err != nil {
 			log.Printf("Session create failed: %v", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		log.Printf("Session %s created successfully", session.ID)
+		details := map[string]any{"name": session.Name}
+		if session.Profile != "" {
+			details["profile"] = session.Profile
+		}
+		if len(req.Command) > 0 {
+			details["command"] = req.Command[0]
+		}
+		if req.CloneFrom != "" {
+			details["cloneFrom"] = req.CloneFrom
+		}
+		s.audit.Record(r, AuditSessionCreate, session.ID, details)
+		s.resurrect.requestSave()
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(session)
 
@@ -2013,6 +2527,21 @@ func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
 		s.handleSessionKeys(w, r)
 		return
 	}
+	if len(parts) >= 5 && parts[4] == "snapshots" {
+		s.handleSessionSnapshots(w, r, sessionID, parts[5:])
+		return
+	}
+
+	// Closing and changing a session is up to its owner
+	switch s.sessionAccess(sessionID) {
+	case "":
+		http.Error(w, "session not found: "+sessionID, http.StatusNotFound)
+		return
+	case AccessOwner:
+	default:
+		http.Error(w, "Forbidden: only the session owner can change it", http.StatusForbidden)
+		return
+	}
 
 	switch r.Method {
 	case http.MethodDelete:
@@ -2021,29 +2550,59 @@ func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
 		if origin == "" {
 			origin = r.Header.Get("Referer")
 		}
-		remoteAddr := r.RemoteAddr
-		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
-			remoteAddr = fwd
-		}
-		log.Printf("Session DELETE request for %s from %s (origin: %s)", sessionID, remoteAddr, origin)
+		log.Printf("Session DELETE request for %s from %s (origin: %s)", sessionID, clientDescription(r), origin)
 
 		if err := s.manager.CloseSession(sessionID); err != nil {
 			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
+		s.audit.Record(r, AuditSessionClose, sessionID, nil)
 		w.WriteHeader(http.StatusNoContent)
 
 	case http.MethodPatch:
 		var req struct {
-			Name string `json:"name"`
+			Name        *string     `json:"name"`
+			OSC52Policy *string     `json:"osc52Policy"`
+			ACL         *SessionACL `json:"acl"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		if err := s.manager.RenameSession(sessionID, req.Name); err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
+		if req.OSC52Policy != nil {
+			// Programs inside a session must not loosen their own clipboard policy
+			if sessionBoundToken(r) {
+				http.Error(w, "Forbidden: session tokens cannot change OSC 52 policy", http.StatusForbidden)
+				return
+			}
+			if err := s.manager.SetClipboardPolicy(sessionID, *req.OSC52Policy); err != nil {
+				code := http.StatusNotFound
+				if strings.HasPrefix(err.Error(), "invalid") {
+					code = http.StatusBadRequest
+				}
+				http.Error(w, err.Error(), code)
+				return
+			}
+			log.Printf("Session %s OSC 52 policy set to %q by %s", sessionID, *req.OSC52Policy, clientDescription(r))
+		}
+		if req.ACL != nil {
+			if err := s.manager.SetSessionACL(sessionID, *req.ACL); err != nil {
+				code := http.StatusNotFound
+				if strings.HasPrefix(err.Error(), "invalid") {
+					code = http.StatusBadRequest
+				}
+				http.Error(w, err.Error(), code)
+				return
+			}
+			log.Printf("Session %s access list changed by %s", sessionID, clientDescription(r))
+			s.audit.Record(r, AuditSessionACL, sessionID, map[string]any{"acl": *req.ACL})
+		}
+		if req.Name != nil {
+			if err := s.manager.RenameSession(sessionID, *req.Name); err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			s.audit.Record(r, AuditSessionRename, sessionID, map[string]any{"name": *req.Name})
 		}
 		w.WriteHeader(http.StatusOK)
 
@@ -2077,6 +2636,15 @@ func (s *Server) handleSessionKeys(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	switch s.sessionAccess(sessionID) {
+	case "":
+		http.Error(w, "session not found: "+sessionID, http.StatusNotFound)
+		return
+	case AccessView:
+		http.Error(w, "Forbidden: view-only access to "+sessionID, http.StatusForbidden)
+		return
+	}
+
 	// Limit request body size to prevent abuse
 	r.Body = http.MaxBytesReader(w, r.Body, maxKeysRequestSize)
 
@@ -2105,6 +2673,8 @@ func (s *Server) handleSessionKeys(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	// Record how much was sent, not the keys themselves (they may contain secrets)
+	s.audit.Record(r, AuditKeysSend, sessionID, map[string]any{"keys": len(req.Keys), "steps": len(req.Sequence)})
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -2131,6 +2701,11 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 	if targetDir == "" {
 		targetDir = s.uploadDir
 	}
+	targetDir, err := s.files.Resolve(targetDir)
+	if err != nil {
+		writeFileError(w, err)
+		return
+	}
 
 	// Ensure target directory exists
 	if err := os.MkdirAll(targetDir, 0755); err != nil {
@@ -2151,7 +2726,11 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 
 		// Sanitize filename to prevent path traversal
 		filename := filepath.Base(fileHeader.Filename)
-		destPath := filepath.Join(targetDir, filename)
+		destPath, err := s.files.Resolve(filepath.Join(targetDir, filename))
+		if err != nil {
+			writeFileError(w, err)
+			return
+		}
 
 		// Avoid overwriting existing files by appending a number suffix
 		if _, err := os.Stat(destPath); err == nil {
@@ -2179,6 +2758,7 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 
 		uploaded = append(uploaded, destPath)
 		log.Printf("Uploaded file: %s", destPath)
+		s.audit.Record(r, AuditFileUpload, "", map[string]any{"path": destPath, "size": fileHeader.Size})
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -2208,8 +2788,11 @@ func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Clean the path to prevent directory traversal
-	filePath = filepath.Clean(filePath)
+	filePath, err = s.files.Resolve(filePath)
+	if err != nil {
+		writeFileError(w, err)
+		return
+	}
 
 	info, err := os.Stat(filePath)
 	if os.IsNotExist(err) {
@@ -2223,9 +2806,11 @@ func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
 
 	if info.IsDir() {
 		// Download directory as zip
+		s.audit.Record(r, AuditFileDownload, "", map[string]any{"path": filePath, "zip": true})
 		s.downloadDirAsZip(w, filePath)
 		return
 	}
+	s.audit.Record(r, AuditFileDownload, "", map[string]any{"path": filePath, "size": info.Size()})
 
 	// Regular file - direct download
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(filePath)))
@@ -2254,6 +2839,14 @@ func (s *Server) downloadDirAsZip(w http.ResponseWriter, dirPath string) {
 			return nil
 		}
 
+		// Leave out denied files and directories
+		if relPath != "." && !s.files.Allowed(path) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
 		if fi.IsDir() {
 			if relPath != "." {
 				header := &zip.FileHeader{
@@ -2387,16 +2980,33 @@ func (s *Server) handleTerminalProxy(w http.ResponseWriter, r *http.Request) {
 	sessionID := parts[0]
 
 	session, ok := s.manager.GetSession(sessionID)
-	if !ok {
+	access := s.sessionAccess(sessionID)
+	if !ok || access == "" {
 		http.Error(w, "session not found", http.StatusNotFound)
 		return
 	}
 
-	targetHost := fmt.Sprintf("127.0.0.1:%d", session.Port)
+	s.proxyTerminal(w, r, session, parts, s.readOnly || access == AccessView)
+}
+
+// proxyTerminal forwards a request to the session's ttyd. parts[1] (if present)
+// is the path below the terminal prefix. viewOnly connects to the session's
+// read-only ttyd and also drops terminal input frames.
+func (s *Server) proxyTerminal(w http.ResponseWriter, r *http.Request, session *Session, parts []string, viewOnly bool) {
+	port := session.Port
+	if viewOnly {
+		var err error
+		if port, err = s.manager.ViewerPort(session); err != nil {
+			log.Printf("Session %s: %v", session.ID, err)
+			http.Error(w, "terminal unavailable", http.StatusBadGateway)
+			return
+		}
+	}
+	targetHost := fmt.Sprintf("127.0.0.1:%d", port)
 
 	// Check if this is a WebSocket upgrade request
 	if r.Header.Get("Upgrade") == "websocket" {
-		s.proxyWebSocket(w, r, targetHost, parts)
+		s.proxyWebSocket(w, r, session, targetHost, parts, viewOnly)
 		return
 	}
 
@@ -2421,6 +3031,8 @@ func (s *Server) handleTerminalProxy(w http.ResponseWriter, r *http.Request) {
 		}
 		req.URL.RawPath = ""
 		req.Host = targetURL.Host
+		// ttyd has no use for our login cookie
+		stripAuthCookie(req.Header)
 	}
 
 	// For HTML responses (the ttyd index), inject our clipboard script
@@ -2503,8 +3115,10 @@ func (s *Server) handleTerminalProxy(w http.ResponseWriter, r *http.Request) {
 
 // proxyWebSocket handles WebSocket connections by proxying to ttyd
 // It intercepts OSC 52 clipboard sequences from terminal output and broadcasts
-// them via the server's clipboard SSE mechanism.
-func (s *Server) proxyWebSocket(w http.ResponseWriter, r *http.Request, targetHost string, parts []string) {
+// them via the session owner's clipboard SSE mechanism. With viewOnly, input and
+// resize messages from the client are dropped and OSC 52 is left to the owner's
+// own connections.
+func (s *Server) proxyWebSocket(w http.ResponseWriter, r *http.Request, session *Session, targetHost string, parts []string, viewOnly bool) {
 	// Build target WebSocket path
 	targetPath := "/"
 	if len(parts) > 1 {
@@ -2537,8 +3151,10 @@ func (s *Server) proxyWebSocket(w http.ResponseWriter, r *http.Request, targetHo
 	upgradeReq := fmt.Sprintf("%s %s HTTP/1.1\r\n", r.Method, targetPath)
 	upgradeReq += fmt.Sprintf("Host: %s\r\n", targetHost)
 
-	// Copy relevant headers (but not Host)
-	for key, values := range r.Header {
+	// Copy relevant headers (but not Host or our login cookie)
+	header := r.Header.Clone()
+	stripAuthCookie(header)
+	for key, values := range header {
 		if key == "Host" {
 			continue
 		}
@@ -2555,8 +3171,24 @@ func (s *Server) proxyWebSocket(w http.ResponseWriter, r *http.Request, targetHo
 		return
 	}
 
-	// Create OSC 52 scanner for backend -> client direction
-	osc52Scanner := newOSC52Scanner(s)
+	// Create OSC 52 scanner for backend -> client direction; clipboard writes
+	// belong to the session's owner, whoever is watching
+	var osc52Scanner *osc52Scanner
+	if !viewOnly {
+		osc52Scanner = newOSC52Scanner(s.userServer(session.Owner), r, session.ID)
+	}
+
+	// Close both ends when the request context ends (e.g. the user logs out)
+	proxyDone := make(chan struct{})
+	defer close(proxyDone)
+	go func() {
+		select {
+		case <-r.Context().Done():
+			clientConn.Close()
+			targetConn.Close()
+		case <-proxyDone:
+		}
+	}()
 
 	// Bidirectionally copy data between client and backend
 	var wg sync.WaitGroup
@@ -2575,7 +3207,9 @@ func (s *Server) proxyWebSocket(w http.ResponseWriter, r *http.Request, targetHo
 				// Scan for OSC 52 in the data stream
 				// Note: This scans raw WebSocket frame data which includes frame headers,
 				// but OSC 52 sequences are in the payload so this should still work
-				osc52Scanner.Scan(buf[:n])
+				if osc52Scanner != nil {
+					osc52Scanner.Scan(buf[:n])
+				}
 
 				// Forward all data to client (we don't strip OSC 52 to avoid breaking frames)
 				if _, err := clientConn.Write(buf[:n]); err != nil {
@@ -2588,14 +3222,20 @@ func (s *Server) proxyWebSocket(w http.ResponseWriter, r *http.Request, targetHo
 		}
 	}()
 
-	// Client -> Backend (ttyd) - pass through unchanged
+	// Client -> Backend (ttyd) - pass through unchanged, or filtered for viewers
 	go func() {
 		defer wg.Done()
-		// First flush any buffered data from the hijacked connection
-		if clientBuf.Reader.Buffered() > 0 {
-			io.CopyN(targetConn, clientBuf, int64(clientBuf.Reader.Buffered()))
+		if viewOnly {
+			if err := copyViewerFrames(targetConn, clientBuf.Reader); err != nil && err != io.EOF {
+				log.Printf("Viewer connection closed: %v", err)
+			}
+		} else {
+			// First flush any buffered data from the hijacked connection
+			if clientBuf.Reader.Buffered() > 0 {
+				io.CopyN(targetConn, clientBuf, int64(clientBuf.Reader.Buffered()))
+			}
+			io.Copy(targetConn, clientConn)
 		}
-		io.Copy(targetConn, clientConn)
 		if tc, ok := targetConn.(*net.TCPConn); ok {
 			tc.CloseWrite()
 		}
@@ -2615,8 +3255,10 @@ func (s *Server) proxyWebSocket(w http.ResponseWriter, r *http.Request, targetHo
 //   - Direct OSC 52: \x1b]52;c;<base64>\x1b\\ (ST terminator)
 //   - Tmux passthrough: \x1bPtmux;\x1b\x1b]52;c;<base64>\x07\x1b\\
 type osc52Scanner struct {
-	server *Server
-	buf    []byte
+	server    *Server
+	req       *http.Request // Terminal connection, for audit records
+	sessionID string
+	buf       []byte
 }
 
 const (
@@ -2626,8 +3268,8 @@ const (
 	osc52MaxClipboardSize = 10 * 1024 * 1024
 )
 
-func newOSC52Scanner(s *Server) *osc52Scanner {
-	return &osc52Scanner{server: s}
+func newOSC52Scanner(s *Server, r *http.Request, sessionID string) *osc52Scanner {
+	return &osc52Scanner{server: s, req: r, sessionID: sessionID}
 }
 
 // Scan processes incoming data looking for OSC 52 sequences.
@@ -2644,10 +3286,7 @@ func (o *osc52Scanner) Scan(data []byte) {
 		}
 
 		if clipboardText != "" && len(clipboardText) <= osc52MaxClipboardSize {
-			o.server.clipboardMu.Lock()
-			o.server.clipboard = clipboardText
-			o.server.clipboardVersion++
-			o.server.clipboardMu.Unlock()
+			o.server.handleOSC52Write(o.req, o.sessionID, clipboardText)
 		}
 
 		o.buf = remaining
@@ -2847,7 +3486,7 @@ func (s *Server) handleBrowse(w http.ResponseWriter, r *http.Request) {
 
 	dirPath := r.URL.Query().Get("path")
 	if dirPath == "" {
-		dirPath, _ = os.UserHomeDir()
+		dirPath = s.files.DefaultDir()
 	}
 
 	// Decode URL-encoded path
@@ -2857,7 +3496,11 @@ func (s *Server) handleBrowse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dirPath = filepath.Clean(dirPath)
+	dirPath, err = s.files.Resolve(dirPath)
+	if err != nil {
+		writeFileError(w, err)
+		return
+	}
 
 	entries, err := os.ReadDir(dirPath)
 	if err != nil {
@@ -2876,8 +3519,8 @@ func (s *Server) handleBrowse(w http.ResponseWriter, r *http.Request) {
 
 	files := make([]FileInfo, 0, len(entries))
 
-	// Add parent directory entry if not at root
-	if dirPath != "/" {
+	// Add parent directory entry if not at root (or a sandbox root)
+	if dirPath != "/" && s.files.Allowed(filepath.Dir(dirPath)) {
 		files = append(files, FileInfo{
 			Name:  "..",
 			Path:  filepath.Dir(dirPath),
@@ -2891,9 +3534,15 @@ func (s *Server) handleBrowse(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
+		// Hide entries the sandbox would refuse
+		entryPath := filepath.Join(dirPath, entry.Name())
+		if !s.files.Allowed(entryPath) {
+			continue
+		}
+
 		fi := FileInfo{
 			Name:      entry.Name(),
-			Path:      filepath.Join(dirPath, entry.Name()),
+			Path:      entryPath,
 			IsDir:     entry.IsDir(),
 			IsRegular: info.Mode().IsRegular(),
 			Size:      info.Size(),
@@ -2912,10 +3561,16 @@ func (s *Server) handleBrowse(w http.ResponseWriter, r *http.Request) {
 		files = append(files, fi)
 	}
 
+	// Let the browser offer the project's sessions (see handleProject)
+	manifest := filepath.Join(dirPath, projectManifestName)
+	_, err = os.Stat(manifest)
+	hasProject := err == nil && s.files.Allowed(manifest)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
-		"path":  dirPath,
-		"files": files,
+		"path":    dirPath,
+		"files":   files,
+		"project": hasProject,
 	})
 }
 
@@ -2940,7 +3595,11 @@ func (s *Server) handleMarked(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Clean and validate path
-		filePath := filepath.Clean(req.Path)
+		filePath, err := s.files.Resolve(req.Path)
+		if err != nil {
+			writeFileError(w, err)
+			return
+		}
 		info, err := os.Stat(filePath)
 		if err != nil {
 			http.Error(w, "File not found: "+err.Error(), http.StatusNotFound)
@@ -3138,6 +3797,14 @@ func (s *Server) handleMarkedDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Re-check marked paths, since symlinks may have changed since they were marked
+	for _, f := range files {
+		if _, err := s.files.Resolve(f.Path); err != nil {
+			writeFileError(w, err)
+			return
+		}
+	}
+
 	// Single regular file - direct download (no zip needed)
 	if len(files) == 1 && !files[0].IsDir {
 		file := files[0]
@@ -3153,6 +3820,7 @@ func (s *Server) handleMarkedDownload(w http.ResponseWriter, r *http.Request) {
 		s.markedFiles = newFiles
 		s.markedMu.Unlock()
 		s.notifyMarkedSubscribers()
+		s.audit.Record(r, AuditMarkedDownload, "", map[string]any{"paths": []string{file.Path}})
 
 		// Serve file
 		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Name))
@@ -3233,6 +3901,14 @@ func (s *Server) handleMarkedDownload(w http.ResponseWriter, r *http.Request) {
 			}
 			zipPath := filepath.Join(baseInZip, relPath)
 
+			// Leave out denied files and directories
+			if relPath != "." && !s.files.Allowed(path) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
 			if info.IsDir() {
 				// Add directory entry (with trailing slash)
 				if relPath != "." {
@@ -3322,6 +3998,7 @@ func (s *Server) handleMarkedDownload(w http.ResponseWriter, r *http.Request) {
 	s.markedFiles = newFiles
 	s.markedMu.Unlock()
 	s.notifyMarkedSubscribers()
+	s.audit.Record(r, AuditMarkedDownload, "", map[string]any{"paths": addedPaths, "zip": zipName})
 }
 
 func main() {
@@ -3349,6 +4026,40 @@ func main() {
 	port := flag.String("port", "8080", "HTTP server port")
 	shell := flag.String("shell", defaultShell, "Shell to spawn in terminals")
 	uploadDir := flag.String("upload-dir", defaultUploadDir, "Directory for uploaded files")
+	fileRoots := flag.String("file-roots", "", "Comma-separated directories the file browser, downloads, uploads and marks are limited to (empty = whole filesystem; the upload dir is always included)")
+	fileDeny := flag.String("file-deny", "", "Comma-separated globs the file handlers refuse (e.g. ~/.ssh,*.pem)")
+	authEnabled := flag.Bool("auth", false, "Require password login (set the password with -set-password)")
+	setPassword := flag.Bool("set-password", false, "Set the login password and exit")
+	resetTOTP := flag.Bool("reset-totp", false, "Remove two-factor (TOTP) enrollment and recovery codes, then exit")
+	addUser := flag.String("add-user", "", "Add a named login account (or set its password) and exit")
+	removeUser := flag.String("remove-user", "", "Remove a named login account and exit")
+	multiUser := flag.Bool("multi-user", false, "Give each user (login account, proxy identity or token user) their own sessions, tmux socket, settings, UI state, scratch pad, marked files and clipboard")
+	unixUsers := flag.Bool("unix-users", false, "With -multi-user, run each user's shells as the Unix account of the same name (requires root)")
+	createToken := flag.String("create-token", "", "Create a named API token, print its secret and exit")
+	tokenScopes := flag.String("token-scopes", strings.Join(sessionTokenScopes, ","), "Comma-separated scopes for -create-token")
+	encryptState := flag.String("encrypt-state", StateEncryptionOff, "Encrypt persisted state with AES-GCM: off, keyfile (key in the config dir) or passphrase ($"+statePassphraseEnv+" or a prompt)")
+	reEncrypt := flag.Bool("re-encrypt", false, "Re-encrypt persisted state with a new key for -encrypt-state (also turns encryption on or off), then exit")
+	resurrectMode := flag.String("resurrect", ResurrectAsk, "Save session definitions and recreate them after the tmux server is gone: off, ask (from the UI, API or wm resurrect) or auto (at startup)")
+	resurrectCommands := flag.String("resurrect-commands", "", "Comma-separated programs (e.g. vim,less,tail) re-run in recreated sessions that had them in the foreground")
+	snapshotInterval := flag.Duration("snapshot-interval", time.Minute, "How often to snapshot each session's scrollback for replay into recreated sessions (0 = off)")
+	snapshotMaxMB := flag.Int("snapshot-max-mb", 4, "Compressed snapshot storage per session in MiB; older scrollback is dropped beyond it")
+	workspaceFile := flag.String("workspace", "", "Workspace file (JSON or YAML) whose sessions and groups to start with, unless they are already running")
+	shutdownMode := flag.String("shutdown", ShutdownKill, "What happens to tmux sessions when webmux exits: kill, or keep them running to reattach on the next start")
+	tokenUser := flag.String("token-user", "", "User the -create-token token acts as (for -multi-user)")
+	proxyUserHeader := flag.String("proxy-user-header", "", "Trust this header (e.g. X-Forwarded-User) from -trusted-proxies as the user identity and reject requests without it")
+	trustedProxies := flag.String("trusted-proxies", defaultTrustedProxies, "Comma-separated CIDRs of reverse proxies allowed to set -proxy-user-header, X-Forwarded-Proto and X-Forwarded-For")
+	auditLog := flag.String("audit-log", auditLogPath(), "Append-only JSON-lines audit log of session, key, file, settings and clipboard actions (empty = disabled)")
+	osc52Policy := flag.String("osc52", ClipboardAllow, "Default policy for OSC 52 clipboard writes from terminals: allow, deny or confirm (approve in the browser)")
+	rateLimits := flag.String("rate-limits", "", "Per-client limits as class=N/period, e.g. sessions=5/1m,keys=off (classes: sessions, keys, uploads, clipboard; default "+defaultRateLimits+")")
+	readOnly := flag.Bool("readonly", false, "Monitoring mode: terminals are view-only and all state-changing API requests are rejected")
+	allowIPs := flag.String("allow-ips", "", "Comma-separated CIDRs or addresses allowed to connect (empty = any address not in -deny-ips)")
+	denyIPs := flag.String("deny-ips", "", "Comma-separated CIDRs or addresses refused before routing; takes precedence over -allow-ips")
+	adminListen := flag.String("admin-listen", "", "Serve logs, audit log, settings writes and token management only on this extra listener (host:port, :port for loopback, or unix:/path)")
+	allowedOrigins := flag.String("allowed-origins", "", "Comma-separated extra origins (e.g. https://webmux.example.com) or hosts allowed to make state-changing requests; same-origin is always allowed")
+	tokenExpires := flag.String("token-expires", "", "Lifetime for -create-token (e.g. 720h); empty = never")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file (PEM); enables HTTPS, reloaded when changed")
+	tlsKey := flag.String("tls-key", "", "TLS private key file (PEM) for -tls-cert")
+	tlsSelfSigned := flag.Bool("tls-self-signed", false, "Serve HTTPS with a generated self-signed CA and certificate cached in the data dir")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: webmux [options] [directory]\n\n")
@@ -3358,6 +4069,120 @@ func main() {
 	}
 	flag.Parse()
 
+	if *setPassword {
+		if err := runSetPassword(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *resetTOTP {
+		if err := runResetTOTP(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if !validStateEncryption(*encryptState) {
+		fmt.Fprintf(os.Stderr, "Error: -encrypt-state: invalid mode %q (use off, keyfile or passphrase)\n", *encryptState)
+		os.Exit(1)
+	}
+
+	if *reEncrypt {
+		if err := runReEncrypt(*encryptState); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *addUser != "" {
+		if err := runAddUser(*addUser); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *removeUser != "" {
+		if err := runRemoveUser(*removeUser); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *createToken != "" {
+		if err := runCreateToken(*createToken, *tokenScopes, *tokenExpires, *tokenUser); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *unixUsers {
+		if !*multiUser {
+			log.Fatal("-unix-users requires -multi-user")
+		}
+		if os.Geteuid() != 0 {
+			log.Fatal("-unix-users requires running webmux as root")
+		}
+	}
+
+	auth, err := NewAuthManager(*authEnabled)
+	if err != nil {
+		log.Fatalf("Auth setup failed: %v", err)
+	}
+	if trustedProxyNets, err = parseCIDRList(*trustedProxies); err != nil {
+		log.Fatalf("-trusted-proxies: %v", err)
+	}
+	if auth.proxy, err = newProxyIdentity(*proxyUserHeader, *trustedProxies); err != nil {
+		log.Fatalf("Auth setup failed: %v", err)
+	}
+	auth.multiUser = *multiUser
+	originGuard, err := NewOriginGuard(*allowedOrigins)
+	if err != nil {
+		log.Fatalf("-allowed-origins: %v", err)
+	}
+	ipFilter, err := newIPFilter(*allowIPs, *denyIPs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var admin *adminListener
+	if *adminListen != "" {
+		if admin, err = parseAdminListen(*adminListen); err != nil {
+			log.Fatalf("-admin-listen: %v", err)
+		}
+	}
+
+	// TLS: explicit cert/key or a generated self-signed pair
+	var certs *certReloader
+	var tlsCAPath string
+	switch {
+	case *tlsCert != "" || *tlsKey != "":
+		if *tlsCert == "" || *tlsKey == "" {
+			log.Fatal("-tls-cert and -tls-key must be used together")
+		}
+		if *tlsSelfSigned {
+			log.Fatal("-tls-self-signed cannot be combined with -tls-cert")
+		}
+		tlsCAPath, _ = filepath.Abs(*tlsCert)
+		if certs, err = newCertReloader(*tlsCert, *tlsKey); err != nil {
+			log.Fatalf("TLS setup failed: %v", err)
+		}
+	case *tlsSelfSigned:
+		certPath, keyPath, caPath, err := ensureSelfSignedCert()
+		if err != nil {
+			log.Fatalf("TLS setup failed: %v", err)
+		}
+		tlsCAPath = caPath
+		if certs, err = newCertReloader(certPath, keyPath); err != nil {
+			log.Fatalf("TLS setup failed: %v", err)
+		}
+	}
+
 	// Get starting directory from first positional argument, default to current dir
 	workDir, _ := os.Getwd()
 	if flag.NArg() > 0 {
@@ -3388,7 +4213,57 @@ func main() {
 
 	// Initialize session manager (ttyd sessions start at port 7700)
 	manager := NewSessionManager(7700, *shell, workDir, *port)
+	manager.issueToken = auth.IssueSessionToken
+	manager.tlsCAPath = tlsCAPath
+	manager.readOnly = *readOnly
+	manager.unixUsers = *unixUsers
+	if !validShutdownMode(*shutdownMode) {
+		log.Fatalf("-shutdown: invalid mode %q (use kill or keep)", *shutdownMode)
+	}
+	manager.keepOnShutdown = *shutdownMode == ShutdownKeep
+	manager.restoreToken = auth.RestoreSessionToken
+	if *unixUsers {
+		// Other users' tmux servers read the config and init scripts
+		if manager.wmBinDir != "" {
+			os.Chmod(manager.wmBinDir, 0755)
+		}
+		if manager.tmuxConfigPath != "" {
+			os.Chmod(manager.tmuxConfigPath, 0644)
+		}
+	}
 	server := NewServer(manager, *uploadDir)
+	server.auth = auth
+	server.readOnly = *readOnly
+	server.multiUser = *multiUser
+	if server.files, err = NewFileSandbox(*fileRoots, *fileDeny, *uploadDir); err != nil {
+		log.Fatalf("File sandbox setup failed: %v", err)
+	}
+	if !validClipboardPolicy(*osc52Policy) {
+		log.Fatalf("-osc52: invalid policy %q (use allow, deny or confirm)", *osc52Policy)
+	}
+	server.clipboardPolicy = *osc52Policy
+	if server.limiter, err = NewRateLimiter(*rateLimits); err != nil {
+		log.Fatalf("-rate-limits: %v", err)
+	}
+	if server.store, err = OpenStateStore(*encryptState); err != nil {
+		log.Fatalf("State store: %v", err)
+	}
+	if server.resurrect, err = NewResurrector(*resurrectMode, *resurrectCommands); err != nil {
+		log.Fatalf("-resurrect: %v", err)
+	}
+	if server.snapshots, err = NewSnapshotter(server.store, *snapshotInterval, *snapshotMaxMB); err != nil {
+		log.Fatalf("-snapshot-interval: %v", err)
+	}
+	var workspace *Workspace
+	if *workspaceFile != "" {
+		if workspace, err = loadWorkspaceFile(*workspaceFile); err != nil {
+			log.Fatalf("-workspace: %v", err)
+		}
+	}
+	if server.audit, err = NewAuditLog(*auditLog); err != nil {
+		log.Fatalf("Audit log setup failed: %v", err)
+	}
+	defer server.audit.Close()
 
 	// Cleanup on exit
 	defer manager.Cleanup()
@@ -3399,43 +4274,165 @@ func main() {
 	go func() {
 		<-sigChan
 		log.Println("Shutting down...")
+		if server.snapshots != nil {
+			server.snapshots.TakeAll(manager)
+		}
 		manager.Cleanup()
 		os.Exit(0)
 	}()
 
+	// Pick up sessions left running by a previous server
+	if n := manager.Reattach(); n > 0 {
+		log.Printf("Reattached %d surviving session(s)", n)
+	}
+	// Restore the sidebar layout of the sessions that are still there
+	server.loadUIStates()
+
+	// Recreate sessions whose tmux server is gone (e.g. after a reboot)
+	if server.resurrect != nil {
+		server.loadSavedSessions()
+		if server.resurrect.mode == ResurrectAuto {
+			server.resurrectAll()
+		}
+		go server.runSessionSaver()
+	}
+	if server.snapshots != nil {
+		server.pruneSnapshots()
+		go server.snapshots.run(manager)
+	}
+	if workspace != nil {
+		go server.applyWorkspace(context.Background(), workspace, nil)
+	}
+
 	// Set up routes
 	mux := http.NewServeMux()
 
 	// API routes
-	mux.HandleFunc("/api/info", server.handleInfo)
-	mux.HandleFunc("/api/logs", server.handleLogs)
-	mux.HandleFunc("/api/sessions", server.handleSessions)
-	mux.HandleFunc("/api/sessions/", server.handleSession)
-	mux.HandleFunc("/api/upload", server.handleUpload)
-	mux.HandleFunc("/api/download", server.handleDownload)
-	mux.HandleFunc("/api/browse", server.handleBrowse)
-	mux.HandleFunc("/api/settings", server.handleSettings)
-	mux.HandleFunc("/api/ui-state", server.handleUIState)
-	mux.HandleFunc("/api/scratch", server.handleScratch)
-	mux.HandleFunc("/api/scratch/events", server.handleScratchEvents)
-	mux.HandleFunc("/api/marked", server.handleMarked)
-	mux.HandleFunc("/api/marked/events", server.handleMarkedEvents)
-	mux.HandleFunc("/api/marked/download", server.handleMarkedDownload)
-	mux.HandleFunc("/api/clipboard", server.handleClipboard)
-	mux.HandleFunc("/api/clipboard/version", server.handleClipboardVersion)
+	mux.HandleFunc("/api/info", server.forUser((*Server).handleInfo))
+	mux.HandleFunc("/api/sessions", server.forUser((*Server).handleSessions))
+	mux.HandleFunc("/api/sessions/", server.forUser((*Server).handleSession))
+	mux.HandleFunc("/api/resurrect", server.forUser((*Server).handleResurrect))
+	mux.HandleFunc("/api/profiles", server.forUser((*Server).handleProfiles))
+	mux.HandleFunc("/api/workspaces", server.forUser((*Server).handleWorkspaces))
+	mux.HandleFunc("/api/workspaces/apply", server.forUser((*Server).handleWorkspaceApply))
+	mux.HandleFunc("/api/workspaces/down", server.forUser((*Server).handleWorkspaceDown))
+	mux.HandleFunc("/api/project", server.forUser((*Server).handleProject))
+	mux.HandleFunc("/api/project/trust", server.forUser((*Server).handleProjectTrust))
+	mux.HandleFunc("/api/project/open", server.forUser((*Server).handleProjectOpen))
+	mux.HandleFunc("/api/upload", server.forUser((*Server).handleUpload))
+	mux.HandleFunc("/api/download", server.forUser((*Server).handleDownload))
+	mux.HandleFunc("/api/browse", server.forUser((*Server).handleBrowse))
+	mux.HandleFunc("/api/ui-state", server.forUser((*Server).handleUIState))
+	mux.HandleFunc("/api/ui-state/history", server.forUser((*Server).handleUIStateHistory))
+	mux.HandleFunc("/api/ui-state/undo", server.forUser((*Server).handleUIStateUndo))
+	mux.HandleFunc("/api/scratch", server.forUser((*Server).handleScratch))
+	mux.HandleFunc("/api/scratch/events", server.forUser((*Server).handleScratchEvents))
+	mux.HandleFunc("/api/marked", server.forUser((*Server).handleMarked))
+	mux.HandleFunc("/api/marked/events", server.forUser((*Server).handleMarkedEvents))
+	mux.HandleFunc("/api/marked/download", server.forUser((*Server).handleMarkedDownload))
+	mux.HandleFunc("/api/clipboard", server.forUser((*Server).handleClipboard))
+	mux.HandleFunc("/api/clipboard/version", server.forUser((*Server).handleClipboardVersion))
+	mux.HandleFunc("/api/clipboard/pending", server.forUser((*Server).handleClipboardPending))
+	mux.HandleFunc("/api/clipboard/pending/", server.forUser((*Server).handleClipboardDecision))
+	mux.HandleFunc("/api/auth/login", auth.handleLogin)
+	mux.HandleFunc("/api/auth/logout", auth.handleLogout)
+	mux.HandleFunc("/api/auth/status", auth.handleAuthStatus)
+	mux.HandleFunc("/api/auth/totp", auth.handleTOTP)
+	mux.HandleFunc("/api/auth/totp/setup", auth.handleTOTPSetup)
+	mux.HandleFunc("/api/auth/totp/confirm", auth.handleTOTPConfirm)
+	mux.HandleFunc("/api/shares", server.forUser((*Server).handleShares))
+	mux.HandleFunc("/api/shares/", server.forUser((*Server).handleShare))
+
+	// Admin routes - on their own listener with -admin-listen, where the public
+	// listener only serves settings reads
+	adminMux := mux
+	if admin != nil {
+		adminMux = http.NewServeMux()
+		mux.HandleFunc("/api/logs", adminOnly)
+		mux.HandleFunc("/api/audit", adminOnly)
+		mux.HandleFunc("/api/settings", server.forUser((*Server).handlePublicSettings))
+		mux.HandleFunc("/api/tokens", adminOnly)
+		mux.HandleFunc("/api/tokens/", adminOnly)
+	}
+	adminMux.HandleFunc("/api/logs", server.handleLogs)
+	adminMux.HandleFunc("/api/audit", server.handleAudit)
+	adminMux.HandleFunc("/api/settings", server.forUser((*Server).handleSettings))
+	adminMux.HandleFunc("/api/tokens", auth.handleTokens)
+	adminMux.HandleFunc("/api/tokens/", auth.handleToken)
 
 	// Terminal proxy - forwards requests to ttyd instances
-	mux.HandleFunc("/t/", server.handleTerminalProxy)
+	mux.HandleFunc("/t/", server.forUser((*Server).handleTerminalProxy))
+
+	// Read-only share links - the token in the path is the credential
+	mux.HandleFunc("/s/", server.handleShareView)
 
 	// Static files (dev mode handled by build tag)
 	mux.Handle("/", InitDevMode(mux, server))
 
-	log.Printf("Starting server on http://localhost:%s", *port)
+	scheme := "http"
+	if certs != nil {
+		scheme = "https"
+	}
+	log.Printf("Starting server on %s://localhost:%s", scheme, *port)
 	log.Printf("Working directory: %s", workDir)
 	log.Printf("Upload directory: %s", *uploadDir)
+	if server.files.Restricted() {
+		log.Printf("File access limited to: %s", strings.Join(server.files.roots, ", "))
+	}
 	log.Printf("Default shell: %s", *shell)
+	if server.audit != nil {
+		log.Printf("Audit log: %s", server.audit.path)
+	}
+	if server.store.Encrypted() {
+		log.Printf("Persisted state in %s is encrypted (%s, key %s)", server.store.dir, *encryptState, server.store.keys.current)
+	}
+	if auth.Enabled() {
+		log.Printf("Login required (password file: %s)", authFilePath())
+	}
+	if server.readOnly {
+		log.Printf("Read-only mode: terminals are view-only and API changes are rejected")
+	}
+	if *multiUser && !*unixUsers {
+		log.Printf("Warning: -multi-user without -unix-users does not isolate files; all users' shells and the file browser share this account")
+	}
+	if auth.proxy != nil {
+		log.Printf("Trusting %s from proxies %s", auth.proxy.header, *trustedProxies)
+	}
+	if ipFilter != nil {
+		log.Printf("Client addresses: allow %q, deny %q", *allowIPs, *denyIPs)
+	}
 
-	if err := http.ListenAndServe(":"+*port, mux); err != nil {
+	if admin != nil {
+		listener, err := admin.Listen()
+		if err != nil {
+			log.Fatalf("Admin listener failed: %v", err)
+		}
+		adminServer := &http.Server{
+			Handler: originGuard.Middleware(auth.Middleware(server.ReadOnlyMiddleware(server.limiter.Middleware(adminMux)))),
+		}
+		go func() {
+			if err := adminServer.Serve(listener); err != nil {
+				log.Fatalf("Admin listener failed: %v", err)
+			}
+		}()
+		log.Printf("Admin endpoints served on %s", admin)
+	}
+
+	httpServer := &http.Server{
+		Addr:    ":" + *port,
+		Handler: ipFilter.Middleware(originGuard.Middleware(auth.Middleware(server.ReadOnlyMiddleware(server.limiter.Middleware(mux))))),
+	}
+	if certs != nil {
+		log.Printf("TLS certificate: %s (trust %s in browsers and clients)", certs.certPath, tlsCAPath)
+		httpServer.TLSConfig = &tls.Config{
+			GetCertificate: certs.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		}
+		err = httpServer.ListenAndServeTLS("", "")
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+	if err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
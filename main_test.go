@@ -0,0 +1,120 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSessionOptionsValidate(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		opts SessionOptions
+		ok   bool
+	}{
+		{"empty", SessionOptions{}, true},
+		{"cwd", SessionOptions{Cwd: dir}, true},
+		{"relative cwd", SessionOptions{Cwd: "src"}, false},
+		{"missing cwd", SessionOptions{Cwd: filepath.Join(dir, "missing")}, false},
+		{"cwd is a file", SessionOptions{Cwd: file}, false},
+		{"env", SessionOptions{Env: map[string]string{"EDITOR": "vim", "_X1": ""}}, true},
+		{"bad env name", SessionOptions{Env: map[string]string{"1X": "y"}}, false},
+		{"env with =", SessionOptions{Env: map[string]string{"A=B": "c"}}, false},
+		{"webmux env", SessionOptions{Env: map[string]string{"WEBMUX_TOKEN": "x"}}, false},
+		{"managed env", SessionOptions{Env: map[string]string{"ZDOTDIR": "/tmp"}}, false},
+		{"command on PATH", SessionOptions{Command: []string{"sh", "-c", "true"}}, true},
+		{"command path", SessionOptions{Command: []string{"/bin/sh"}}, true},
+		{"empty command", SessionOptions{Command: []string{""}}, false},
+		{"missing command", SessionOptions{Command: []string{"webmux-no-such-command"}}, false},
+		{"shell", SessionOptions{Shell: "/bin/sh"}, true},
+		{"relative shell", SessionOptions{Shell: "sh"}, false},
+		{"shell is a directory", SessionOptions{Shell: dir}, false},
+		{"shell not executable", SessionOptions{Shell: file}, false},
+		{"size", SessionOptions{Cols: 80, Rows: 24}, true},
+		{"cols only", SessionOptions{Cols: 120}, true},
+		{"too narrow", SessionOptions{Cols: 9, Rows: 24}, false},
+		{"too tall", SessionOptions{Cols: 80, Rows: 501}, false},
+		{"bad theme key", SessionOptions{Theme: map[string]string{"base00": "#000000", "base1F": "#ffffff"}}, false},
+		{"theme ok", SessionOptions{Theme: map[string]string{"base0A": "#000000", "base17": "#FFFFFF"}}, true},
+		{"theme color", SessionOptions{Theme: map[string]string{"base00": "black"}}, false},
+	}
+	for _, tt := range tests {
+		err := tt.opts.validate()
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: validate() = %v, want ok = %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestExpandCwd(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{"", ""},
+		{"~", "/home/alice"},
+		{"~/src/app", "/home/alice/src/app"},
+		{"/srv/app", "/srv/app"},
+		{"~bob/src", "~bob/src"},
+	}
+	for _, tt := range tests {
+		if got := expandCwd(tt.path, "/home/alice"); got != tt.want {
+			t.Errorf("expandCwd(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestUnixAccountCheckOptions(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("needs root to run checks as another account")
+	}
+	account, err := lookupUnixAccount("nobody")
+	if err != nil {
+		t.Skip(err)
+	}
+	private := t.TempDir() // 0700, owned by root
+	script := filepath.Join(private, "run")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		opts SessionOptions
+		ok   bool
+	}{
+		{"empty", SessionOptions{}, true},
+		{"cwd", SessionOptions{Cwd: "/"}, true},
+		{"private cwd", SessionOptions{Cwd: private}, false},
+		{"command", SessionOptions{Command: []string{"sh", "-c", "true"}}, true},
+		{"private command", SessionOptions{Command: []string{script}}, false},
+		{"shell", SessionOptions{Shell: "/bin/sh"}, true},
+		{"private shell", SessionOptions{Shell: script}, false},
+	}
+	for _, tt := range tests {
+		err := account.checkOptions(tt.opts)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: checkOptions() = %v, want ok = %v", tt.name, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+// SECTION: PROFILES
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const profilesFileName = "profiles.json"
+
+// SessionProfile is a named set of options for new sessions, defined in
+// profiles.json in the config dir
+type SessionProfile struct {
+	Cwd     string            `json:"cwd,omitempty"`     // Start directory; ~ is the owner's home
+	Command []string          `json:"command,omitempty"` // Program run instead of the shell
+	Env     map[string]string `json:"env,omitempty"`
+	Shell   string            `json:"shell,omitempty"` // Shell binary instead of -shell
+	Login   bool              `json:"login,omitempty"` // Start the shell as a login shell
+	Cols    int               `json:"cols,omitempty"`  // Initial size (default 200x50)
+	Rows    int               `json:"rows,omitempty"`
+	Theme   map[string]string `json:"theme,omitempty"` // Terminal color overrides, e.g. {"base00": "#200000"}
+}
+
+// ProfilesConfig is the contents of profiles.json
+type ProfilesConfig struct {
+	Default  string                     `json:"default,omitempty"` // Profile for sessions that don't name one
+	Profiles map[string]*SessionProfile `json:"profiles"`
+}
+
+var (
+	validProfileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+	validThemeKey    = regexp.MustCompile(`^base(0[0-9A-F]|1[0-7])$`)
+	validThemeColor  = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+)
+
+// profilesFilePath returns where a user's profiles are defined
+func profilesFilePath(user string) string {
+	if user != "" {
+		return filepath.Join(xdgConfigHome(), "webmux", "users", user, profilesFileName)
+	}
+	return filepath.Join(xdgConfigHome(), "webmux", profilesFileName)
+}
+
+// LoadProfiles reads the shared profiles and, for a named user, their own,
+// which add to and override the shared ones. Missing files are not an error.
+func LoadProfiles(user string) (*ProfilesConfig, error) {
+	config := &ProfilesConfig{Profiles: make(map[string]*SessionProfile)}
+	paths := []string{profilesFilePath("")}
+	if user != "" {
+		paths = append(paths, profilesFilePath(user))
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var file ProfilesConfig
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for name, profile := range file.Profiles {
+			if !validProfileName.MatchString(name) || profile == nil {
+				return nil, fmt.Errorf("%s: invalid profile name %q", path, name)
+			}
+			config.Profiles[name] = profile
+		}
+		if file.Default != "" {
+			config.Default = file.Default
+		}
+	}
+	if config.Default != "" && config.Profiles[config.Default] == nil {
+		return nil, fmt.Errorf("default profile %q is not defined", config.Default)
+	}
+	return config, nil
+}
+
+// Resolve returns the named profile, or the default one when name is empty
+// (nil if there is no default)
+func (c *ProfilesConfig) Resolve(name string) (string, *SessionProfile, error) {
+	if name == "" {
+		name = c.Default
+		if name == "" {
+			return "", nil, nil
+		}
+	}
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown profile %q", name)
+	}
+	return name, profile, nil
+}
+
+// expandCwd resolves a leading ~ in a session's working directory to home
+func expandCwd(path, home string) string {
+	if path == "~" {
+		return home
+	}
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		return filepath.Join(home, rest)
+	}
+	return path
+}
+
+// options turns a profile into session options for an owner with the given home
+func (p *SessionProfile) options(name, home string) SessionOptions {
+	return SessionOptions{
+		Cwd:     expandCwd(p.Cwd, home),
+		Env:     maps.Clone(p.Env),
+		Command: slices.Clone(p.Command),
+		Shell:   p.Shell,
+		Login:   p.Login,
+		Cols:    p.Cols,
+		Rows:    p.Rows,
+		Theme:   maps.Clone(p.Theme),
+		Profile: name,
+	}
+}
+
+// applyTheme returns colors with a session's overrides applied
+func applyTheme(colors TerminalColors, theme map[string]string) TerminalColors {
+	if len(theme) == 0 {
+		return colors
+	}
+	var merged map[string]string
+	data, _ := json.Marshal(colors)
+	json.Unmarshal(data, &merged)
+	maps.Copy(merged, theme)
+	data, _ = json.Marshal(merged)
+	json.Unmarshal(data, &colors)
+	return colors
+}
+
+// homeDir returns the home directory of a user's shells
+func (sm *SessionManager) homeDir(owner string) string {
+	if sm.unixUsers && owner != "" {
+		if account, err := lookupUnixAccount(owner); err == nil {
+			return account.home
+		}
+	}
+	home, _ := os.UserHomeDir()
+	return home
+}
+
+// profileOptions returns the options of this user's profile name, or of their
+// default profile when name is empty
+func (s *Server) profileOptions(name string) (SessionOptions, error) {
+	profiles, err := LoadProfiles(s.user)
+	if err != nil {
+		return SessionOptions{}, err
+	}
+	name, profile, err := profiles.Resolve(name)
+	if err != nil || profile == nil {
+		return SessionOptions{}, err
+	}
+	return profile.options(name, s.manager.homeDir(s.user)), nil
+}
+
+// handleProfiles lists the profiles new sessions can use
+// GET /api/profiles
+func (s *Server) handleProfiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	profiles, err := LoadProfiles(s.user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Env values may hold secrets; list only their names
+	type listing struct {
+		SessionProfile
+		Env []string `json:"env,omitempty"`
+	}
+	list := make(map[string]listing, len(profiles.Profiles))
+	for name, profile := range profiles.Profiles {
+		list[name] = listing{SessionProfile: *profile, Env: slices.Sorted(maps.Keys(profile.Env))}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"default": profiles.Default, "profiles": list})
+}
@@ -0,0 +1,392 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+// SECTION: PROJECTS
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	projectManifestName = ".webmux.json"
+	projectTrustFile    = "trusted-projects.json"
+	maxManifestBytes    = 256 << 10
+)
+
+// projectTrustMu serializes updates to the trusted-projects files
+var projectTrustMu sync.Mutex
+
+// ProjectManifest describes a project's terminals and tasks, checked into
+// its repository as .webmux.json
+type ProjectManifest struct {
+	Name     string            `json:"name,omitempty"`
+	Env      map[string]string `json:"env,omitempty"`      // Added to every session of the project
+	Sessions []ProjectSession  `json:"sessions,omitempty"` // Terminals, opened together by default
+	Tasks    []ProjectSession  `json:"tasks,omitempty"`    // Commands typed into a new shell on request
+}
+
+// ProjectSession is a terminal or task of a project
+type ProjectSession struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Cwd         string            `json:"cwd,omitempty"`     // Relative to the project root
+	Command     []string          `json:"command,omitempty"` // Sessions: run instead of the shell; tasks: required
+	Env         map[string]string `json:"env,omitempty"`
+}
+
+// Project is a manifest found on disk, identified by its content hash so
+// trust is lost when the file changes
+type Project struct {
+	Root     string           `json:"root"`
+	File     string           `json:"file"`
+	Hash     string           `json:"hash"`
+	Trusted  bool             `json:"trusted"`
+	Manifest *ProjectManifest `json:"manifest"`
+}
+
+// findProject looks for a manifest in dir (resolved by the file sandbox) and
+// its parents, as far up as the sandbox allows
+func (s *Server) findProject(dir string) (*Project, error) {
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	for {
+		file := filepath.Join(dir, projectManifestName)
+		if info, err := os.Stat(file); err == nil && info.Mode().IsRegular() && s.files.Allowed(file) {
+			return s.loadProject(file)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir || !s.files.Allowed(parent) {
+			return nil, fmt.Errorf("no %s found: %w", projectManifestName, fs.ErrNotExist)
+		}
+		dir = parent
+	}
+}
+
+// loadProject reads and checks a manifest
+func (s *Server) loadProject(file string) (*Project, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxManifestBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxManifestBytes {
+		return nil, fmt.Errorf("%s: larger than %d KiB", file, maxManifestBytes>>10)
+	}
+	var manifest ProjectManifest
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if err := manifest.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	sum := sha256.Sum256(data)
+	project := &Project{
+		Root:     filepath.Dir(file),
+		File:     file,
+		Hash:     hex.EncodeToString(sum[:]),
+		Manifest: &manifest,
+	}
+	if manifest.Name == "" {
+		manifest.Name = filepath.Base(project.Root)
+	}
+	project.Trusted = s.trustedProjects()[file] == project.Hash
+	return project, nil
+}
+
+// validate checks a manifest's names, directories and environment
+func (m *ProjectManifest) validate() error {
+	checkEnv := func(env map[string]string) error {
+		for key := range env {
+			if !validEnvName.MatchString(key) || managedEnvVar(key) {
+				return fmt.Errorf("invalid environment variable %q", key)
+			}
+		}
+		return nil
+	}
+	if err := checkEnv(m.Env); err != nil {
+		return err
+	}
+	names := make(map[string]bool)
+	for i, list := range [][]ProjectSession{m.Sessions, m.Tasks} {
+		for _, sess := range list {
+			if strings.TrimSpace(sess.Name) == "" {
+				return fmt.Errorf("every session and task needs a name")
+			}
+			if names[sess.Name] {
+				return fmt.Errorf("duplicate name %q", sess.Name)
+			}
+			names[sess.Name] = true
+			if sess.Cwd != "" && !filepath.IsLocal(sess.Cwd) {
+				return fmt.Errorf("%s: cwd must be a relative path inside the project", sess.Name)
+			}
+			if i == 1 && len(sess.Command) == 0 {
+				return fmt.Errorf("task %s has no command", sess.Name)
+			}
+			if err := checkEnv(sess.Env); err != nil {
+				return fmt.Errorf("%s: %w", sess.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// trustedProjects returns the user's trusted manifests, by path, with the
+// hash of the content that was trusted
+func (s *Server) trustedProjects() map[string]string {
+	trusted := make(map[string]string)
+	if s.store == nil {
+		return trusted
+	}
+	data, err := s.store.ReadFile(userStateFile(s.user, projectTrustFile))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Projects: %v", err)
+		}
+		return trusted
+	}
+	if err := json.Unmarshal(data, &trusted); err != nil {
+		log.Printf("Projects: %s: %v", projectTrustFile, err)
+	}
+	return trusted
+}
+
+// setProjectTrust trusts a manifest at the given hash, or forgets it when hash is empty
+func (s *Server) setProjectTrust(file, hash string) error {
+	if s.store == nil {
+		return fmt.Errorf("no state directory to record trust in")
+	}
+	projectTrustMu.Lock()
+	defer projectTrustMu.Unlock()
+	trusted := s.trustedProjects()
+	if hash == "" {
+		delete(trusted, file)
+	} else {
+		trusted[file] = hash
+	}
+	// Forget manifests that are gone
+	for path := range trusted {
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			delete(trusted, path)
+		}
+	}
+	data, err := json.MarshalIndent(trusted, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.store.WriteFile(userStateFile(s.user, projectTrustFile), data)
+}
+
+// openProject starts the named sessions and tasks of a trusted project, or
+// all its sessions when none are named (a plain shell if it has none)
+func (s *Server) openProject(project *Project, names []string, r *http.Request) ([]*Session, error) {
+	m := project.Manifest
+	var picked []ProjectSession
+	tasks := make(map[string]bool)
+	if len(names) == 0 {
+		picked = m.Sessions
+		if len(picked) == 0 {
+			picked = []ProjectSession{{Name: m.Name}}
+		}
+	}
+	for _, name := range names {
+		if i := slices.IndexFunc(m.Sessions, func(p ProjectSession) bool { return p.Name == name }); i >= 0 {
+			picked = append(picked, m.Sessions[i])
+		} else if i := slices.IndexFunc(m.Tasks, func(p ProjectSession) bool { return p.Name == name }); i >= 0 {
+			picked = append(picked, m.Tasks[i])
+			tasks[name] = true
+		} else {
+			return nil, fmt.Errorf("project %s has no session or task %q", m.Name, name)
+		}
+	}
+
+	created := make([]*Session, 0, len(picked))
+	for _, p := range picked {
+		opts := SessionOptions{Cwd: filepath.Join(project.Root, p.Cwd), Env: maps.Clone(m.Env)}
+		if len(p.Env) > 0 && opts.Env == nil {
+			opts.Env = make(map[string]string)
+		}
+		maps.Copy(opts.Env, p.Env)
+		if !tasks[p.Name] {
+			opts.Command = p.Command
+		}
+		if err := s.chargeSession(r); err != nil {
+			return created, err
+		}
+		session, err := s.manager.CreateSession(p.Name, s.user, opts)
+		if err != nil {
+			return created, fmt.Errorf("%s: %w", p.Name, err)
+		}
+		if tasks[p.Name] {
+			// Typed into the shell so its output stays on screen when it exits
+			steps := []KeyStep{{Type: "text", Value: shellJoin(p.Command)}, {Type: "key", Value: "Enter"}}
+			if err := s.manager.SendKeys(session.ID, &KeysRequest{Sequence: steps}); err != nil {
+				log.Printf("Project %s: task %s: %v", m.Name, p.Name, err)
+			}
+		}
+		created = append(created, session)
+		s.audit.Record(r, AuditSessionCreate, session.ID, map[string]any{"name": session.Name, "project": project.File})
+	}
+	s.resurrect.requestSave()
+	return created, nil
+}
+
+// handleProject reports the manifest that applies to a directory
+// GET /api/project?path=DIR
+func (s *Server) handleProject(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	project, ok := s.requestProject(w, r.URL.Query().Get("path"))
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(project)
+}
+
+// requestProject finds the manifest for a request's path, writing the error if there is none
+func (s *Server) requestProject(w http.ResponseWriter, path string) (*Project, bool) {
+	if path == "" {
+		http.Error(w, "path is required", http.StatusBadRequest)
+		return nil, false
+	}
+	dir, err := s.files.Resolve(path)
+	if err != nil {
+		writeFileError(w, err)
+		return nil, false
+	}
+	project, err := s.findProject(dir)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	case err != nil:
+		http.Error(w, "Invalid project manifest: "+err.Error(), http.StatusUnprocessableEntity)
+		return nil, false
+	}
+	return project, true
+}
+
+// handleProjectTrust trusts the manifest for a path as it was shown (by its
+// hash), or withdraws trust
+// POST /api/project/trust {"path": ..., "hash": ...}
+// DELETE /api/project/trust?path=DIR
+func (s *Server) handleProjectTrust(w http.ResponseWriter, r *http.Request) {
+	var path, hash string
+	switch r.Method {
+	case http.MethodPost:
+		var req struct {
+			Path string `json:"path"`
+			Hash string `json:"hash"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Hash == "" {
+			http.Error(w, "path and hash are required", http.StatusBadRequest)
+			return
+		}
+		path, hash = req.Path, req.Hash
+	case http.MethodDelete:
+		path = r.URL.Query().Get("path")
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	project, ok := s.requestProject(w, path)
+	if !ok {
+		return
+	}
+	if hash != "" && hash != project.Hash {
+		http.Error(w, "The manifest changed since it was shown; review it again", http.StatusConflict)
+		return
+	}
+	if err := s.setProjectTrust(project.File, hash); err != nil {
+		http.Error(w, "Failed to save trust: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.audit.Record(r, AuditProjectTrust, "", map[string]any{"file": project.File, "trusted": hash != ""})
+	project.Trusted = hash != ""
+	log.Printf("Project manifest %s trusted=%v by %s", project.File, project.Trusted, clientDescription(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(project)
+}
+
+// handleProjectOpen starts sessions or tasks of a trusted project
+// POST /api/project/open {"path": DIR, "names": [...]}
+func (s *Server) handleProjectOpen(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Path  string   `json:"path"`
+		Names []string `json:"names"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	project, ok := s.requestProject(w, req.Path)
+	if !ok {
+		return
+	}
+	if !project.Trusted {
+		http.Error(w, "Project manifest "+project.File+" is not trusted; review and trust it first", http.StatusForbidden)
+		return
+	}
+
+	created, err := s.openProject(project, req.Names, r)
+	var limited *rateLimitError
+	if errors.As(err, &limited) && len(created) == 0 {
+		writeRateLimited(w, limited)
+		return
+	}
+	if err != nil && len(created) == 0 {
+		http.Error(w, "Failed to open project: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Project %s: %v", project.Manifest.Name, err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
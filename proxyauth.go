@@ -0,0 +1,177 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// SECTION: PROXY IDENTITY
+
+// Default proxy addresses trusted to set the identity header (a proxy on the same host)
+const defaultTrustedProxies = "127.0.0.1/32,::1/128"
+
+// trustedProxyNets are the -trusted-proxies networks, whose X-Forwarded-* headers are believed
+var trustedProxyNets []*net.IPNet
+
+// userContextKey is the context key for the authenticated user name
+type userContextKey struct{}
+
+// proxyIdentity trusts a user header set by an authenticating reverse proxy
+type proxyIdentity struct {
+	header  string       // e.g. X-Forwarded-User
+	trusted []*net.IPNet // proxy addresses allowed to set the header
+	seen    map[string]bool
+	mu      sync.Mutex
+}
+
+// parseCIDRList parses a comma-separated list of CIDRs or bare IP addresses
+func parseCIDRList(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for entry := range strings.SplitSeq(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", entry)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// remoteIP returns the IP of the directly connected peer
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// ipInNets reports whether ip is inside any of the networks
+func ipInNets(ip net.IP, nets []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// fromTrustedProxy reports whether the request arrived directly from a trusted proxy
+func fromTrustedProxy(r *http.Request) bool {
+	return ipInNets(remoteIP(r), trustedProxyNets)
+}
+
+// newProxyIdentity returns a proxy identity checker, or nil when header is empty
+func newProxyIdentity(header, trustedProxies string) (*proxyIdentity, error) {
+	if header == "" {
+		return nil, nil
+	}
+	trusted, err := parseCIDRList(trustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("-trusted-proxies: %w", err)
+	}
+	if len(trusted) == 0 {
+		return nil, fmt.Errorf("-trusted-proxies must list at least one proxy address")
+	}
+	return &proxyIdentity{
+		header:  http.CanonicalHeaderKey(header),
+		trusted: trusted,
+		seen:    make(map[string]bool),
+	}, nil
+}
+
+// user returns the identity set by a trusted proxy, or "" if the request did
+// not come from one or carries no usable identity. Names are checked here, once,
+// because they become path components of the user's state and sockets.
+func (p *proxyIdentity) user(r *http.Request) string {
+	user := strings.TrimSpace(r.Header.Get(p.header))
+	if user == "" {
+		return ""
+	}
+	if !ipInNets(remoteIP(r), p.trusted) {
+		log.Printf("Ignoring %s header from untrusted address %s", p.header, r.RemoteAddr)
+		return ""
+	}
+	if !validUserName(user) {
+		log.Printf("Rejecting invalid user name %q in %s header from %s", user, p.header, r.RemoteAddr)
+		return ""
+	}
+
+	p.mu.Lock()
+	if !p.seen[user] {
+		p.seen[user] = true
+		log.Printf("Proxy user %s connected via %s", user, r.RemoteAddr)
+	}
+	p.mu.Unlock()
+	return user
+}
+
+// requestUser returns the authenticated user name for a request ("" if unknown)
+func requestUser(r *http.Request) string {
+	user, _ := r.Context().Value(userContextKey{}).(string)
+	return user
+}
+
+// withUser returns a context carrying the authenticated user name
+func withUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userContextKey{}, user)
+}
+
+// clientAddr returns the client's address: X-Forwarded-For when set by a trusted
+// proxy, otherwise the connecting peer
+func clientAddr(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" && fromTrustedProxy(r) {
+		return fwd
+	}
+	return r.RemoteAddr
+}
+
+// clientDescription describes the client for log lines: forwarded address and user, if known
+func clientDescription(r *http.Request) string {
+	remoteAddr := clientAddr(r)
+	if user := requestUser(r); user != "" {
+		return user + " (" + remoteAddr + ")"
+	}
+	return remoteAddr
+}
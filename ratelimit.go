@@ -0,0 +1,280 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SECTION: RATE LIMITING
+
+// Route classes that are rate limited
+const (
+	RateSessions  = "sessions"  // each session started (a tmux + ttyd pair)
+	RateKeys      = "keys"      // POST /api/sessions/{id}/keys
+	RateUploads   = "uploads"   // POST /api/upload
+	RateClipboard = "clipboard" // POST /api/clipboard and OSC 52 writes
+)
+
+// defaultRateLimits allows interactive use and wm scripts but stops runaway loops
+const defaultRateLimits = "sessions=20/1m,keys=50/1s,uploads=60/1m,clipboard=20/1s"
+
+// rateLimitIdle is how long an untouched client bucket is kept before it is pruned
+const rateLimitIdle = 10 * time.Minute
+
+// rateBucket is one client's token bucket for one route class
+type rateBucket struct {
+	tokens   float64
+	last     time.Time
+	limiting bool // currently rejecting; used to log once per burst
+}
+
+// rateClass is the limit and counters for one route class
+type rateClass struct {
+	burst   float64 // bucket capacity
+	rate    float64 // tokens per second
+	spec    string  // as configured, e.g. "20/1m"
+	allowed uint64
+	limited uint64
+	buckets map[string]*rateBucket
+}
+
+// RateLimiter applies per-client token buckets to route classes
+type RateLimiter struct {
+	classes   map[string]*rateClass
+	lastPrune time.Time
+	mu        sync.Mutex
+}
+
+// NewRateLimiter parses a comma-separated list of class=N/period limits,
+// e.g. "sessions=20/1m,keys=50/1s". A class set to "off" is not limited;
+// classes not mentioned keep their defaults.
+func NewRateLimiter(spec string) (*RateLimiter, error) {
+	rl := &RateLimiter{classes: make(map[string]*rateClass), lastPrune: time.Now()}
+	for _, list := range []string{defaultRateLimits, spec} {
+		for _, item := range splitList(list) {
+			name, limit, ok := strings.Cut(item, "=")
+			name = strings.TrimSpace(name)
+			limit = strings.TrimSpace(limit)
+			if !ok {
+				return nil, fmt.Errorf("invalid rate limit %q (want class=N/period)", item)
+			}
+			switch name {
+			case RateSessions, RateKeys, RateUploads, RateClipboard:
+			default:
+				return nil, fmt.Errorf("unknown rate limit class %q", name)
+			}
+			if limit == "off" {
+				delete(rl.classes, name)
+				continue
+			}
+			class, err := parseRateSpec(limit)
+			if err != nil {
+				return nil, fmt.Errorf("rate limit %s: %w", name, err)
+			}
+			rl.classes[name] = class
+		}
+	}
+	return rl, nil
+}
+
+// parseRateSpec parses "N/period" (period like 1s, 1m, 1h) into a class
+// whose bucket holds N requests and refills fully once per period
+func parseRateSpec(spec string) (*rateClass, error) {
+	count, period, ok := strings.Cut(spec, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid limit %q (want N/period, e.g. 20/1m)", spec)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid count in %q", spec)
+	}
+	// Allow "s", "m" and "h" as shorthand for one unit
+	if period == "s" || period == "m" || period == "h" {
+		period = "1" + period
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("invalid period in %q", spec)
+	}
+	return &rateClass{
+		burst:   float64(n),
+		rate:    float64(n) / d.Seconds(),
+		spec:    spec,
+		buckets: make(map[string]*rateBucket),
+	}, nil
+}
+
+// rateClassFor returns the route class of a request, or "" if it is not limited.
+// Routes that start several sessions (resurrect, workspaces, projects) are not
+// classed here; they charge each session with chargeSession.
+func rateClassFor(r *http.Request) string {
+	if r.Method != http.MethodPost {
+		return ""
+	}
+	path := r.URL.Path
+	switch {
+	case path == "/api/sessions",
+		strings.HasPrefix(path, "/api/sessions/") && strings.HasSuffix(path, "/snapshots"):
+		return RateSessions
+	case strings.HasPrefix(path, "/api/sessions/") && strings.HasSuffix(path, "/keys"):
+		return RateKeys
+	case path == "/api/upload":
+		return RateUploads
+	case path == "/api/clipboard":
+		return RateClipboard
+	}
+	return ""
+}
+
+// rateClientKey identifies the client a request is charged to: the
+// authenticated user, else the API token, else the remote IP
+func rateClientKey(r *http.Request) string {
+	if user := requestUser(r); user != "" {
+		return "user:" + user
+	}
+	if token, ok := r.Context().Value(tokenContextKey{}).(*APIToken); ok {
+		return "token:" + token.ID
+	}
+	if ip := remoteIP(r); ip != nil {
+		return "ip:" + ip.String()
+	}
+	return "addr:" + r.RemoteAddr
+}
+
+// Allow takes one token from the client's bucket for class. If the bucket is
+// empty it returns false and how long until a token is available.
+func (rl *RateLimiter) Allow(class, client string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	c, ok := rl.classes[class]
+	if !ok {
+		return true, 0
+	}
+	now := time.Now()
+	if now.Sub(rl.lastPrune) > rateLimitIdle {
+		rl.prune(now)
+	}
+
+	b, ok := c.buckets[client]
+	if !ok {
+		b = &rateBucket{tokens: c.burst, last: now}
+		c.buckets[client] = b
+	}
+	b.tokens = min(c.burst, b.tokens+now.Sub(b.last).Seconds()*c.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.limiting = false
+		c.allowed++
+		return true, 0
+	}
+	c.limited++
+	if !b.limiting {
+		b.limiting = true
+		log.Printf("Rate limit %s (%s) reached by %s", class, c.spec, client)
+	}
+	return false, time.Duration((1 - b.tokens) / c.rate * float64(time.Second))
+}
+
+// prune drops buckets that have been idle long enough to be full again.
+// Must be called with rl.mu held.
+func (rl *RateLimiter) prune(now time.Time) {
+	for _, c := range rl.classes {
+		for key, b := range c.buckets {
+			if now.Sub(b.last) > rateLimitIdle {
+				delete(c.buckets, key)
+			}
+		}
+	}
+	rl.lastPrune = now
+}
+
+// Stats returns each class's limit and counters for /api/info
+func (rl *RateLimiter) Stats() map[string]any {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	stats := make(map[string]any, len(rl.classes))
+	for name, c := range rl.classes {
+		stats[name] = map[string]any{
+			"limit":   c.spec,
+			"allowed": c.allowed,
+			"limited": c.limited,
+			"clients": len(c.buckets),
+		}
+	}
+	return stats
+}
+
+// Middleware rejects requests over their class limit with 429 and Retry-After.
+// It must run after authentication so clients are keyed by user or token.
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if class := rateClassFor(r); class != "" {
+			if ok, wait := rl.Allow(class, rateClientKey(r)); !ok {
+				writeRateLimited(w, &rateLimitError{class: class, wait: wait})
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitError reports a request, or part of one, refused by a rate limit
+type rateLimitError struct {
+	class string
+	wait  time.Duration // until the client's bucket has a token again
+}
+
+func (e *rateLimitError) Error() string {
+	return fmt.Sprintf("%s rate limit exceeded", e.class)
+}
+
+// retryAfter returns the Retry-After header value in whole seconds
+func (e *rateLimitError) retryAfter() string {
+	return strconv.Itoa(int(math.Ceil(e.wait.Seconds())))
+}
+
+// writeRateLimited responds 429 with Retry-After
+func writeRateLimited(w http.ResponseWriter, e *rateLimitError) {
+	w.Header().Set("Retry-After", e.retryAfter())
+	http.Error(w, "Too many requests: "+e.Error(), http.StatusTooManyRequests)
+}
+
+// chargeSession takes a sessions token for one session a request is about to
+// start, so routes starting several sessions pay for each of them. Sessions the
+// server starts itself (r is nil) are not limited.
+func (s *Server) chargeSession(r *http.Request) error {
+	if r == nil {
+		return nil
+	}
+	if ok, wait := s.limiter.Allow(RateSessions, rateClientKey(r)); !ok {
+		return &rateLimitError{class: RateSessions, wait: wait}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseRateSpec(t *testing.T) {
+	tests := []struct {
+		spec  string
+		burst float64
+		rate  float64 // per second; 0 means an error is expected
+	}{
+		{"20/1m", 20, 20.0 / 60},
+		{"50/1s", 50, 50},
+		{"5/s", 5, 5},
+		{"60/m", 60, 1},
+		{"7200/h", 7200, 2},
+		{"10/500ms", 10, 20},
+		{"20", 0, 0},
+		{"0/1m", 0, 0},
+		{"-1/1m", 0, 0},
+		{"x/1m", 0, 0},
+		{"20/0s", 0, 0},
+		{"20/bad", 0, 0},
+		{"20/", 0, 0},
+	}
+	for _, tt := range tests {
+		c, err := parseRateSpec(tt.spec)
+		if tt.rate == 0 {
+			if err == nil {
+				t.Errorf("parseRateSpec(%q) = %+v, want an error", tt.spec, c)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseRateSpec(%q): %v", tt.spec, err)
+			continue
+		}
+		if c.burst != tt.burst || c.rate != tt.rate || c.spec != tt.spec {
+			t.Errorf("parseRateSpec(%q) = burst %v rate %v spec %q, want %v %v",
+				tt.spec, c.burst, c.rate, c.spec, tt.burst, tt.rate)
+		}
+	}
+}
+
+func TestNewRateLimiterDefaults(t *testing.T) {
+	rl, err := NewRateLimiter("keys=off,sessions=2/1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rl.classes[RateKeys]; ok {
+		t.Error("keys=off left the class limited")
+	}
+	if c := rl.classes[RateSessions]; c == nil || c.burst != 2 {
+		t.Errorf("sessions override not applied: %+v", c)
+	}
+	for _, class := range []string{RateUploads, RateClipboard} {
+		if rl.classes[class] == nil {
+			t.Errorf("default limit for %s missing", class)
+		}
+	}
+	for _, spec := range []string{"bogus=1/s", "sessions", "sessions=1/x"} {
+		if _, err := NewRateLimiter(spec); err == nil {
+			t.Errorf("NewRateLimiter(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestRateClassFor(t *testing.T) {
+	tests := []struct {
+		method, path string
+		want         string
+	}{
+		{"POST", "/api/sessions", RateSessions},
+		{"GET", "/api/sessions", ""},
+		{"POST", "/api/sessions/session-1/snapshots", RateSessions},
+		{"POST", "/api/sessions/session-1/keys", RateKeys},
+		{"POST", "/api/upload", RateUploads},
+		{"POST", "/api/clipboard", RateClipboard},
+		// Charged per session by the handlers
+		{"POST", "/api/resurrect", ""},
+		{"POST", "/api/workspaces/apply", ""},
+		{"POST", "/api/project/open", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := rateClassFor(r); got != tt.want {
+			t.Errorf("rateClassFor(%s %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestChargeSession(t *testing.T) {
+	limiter, err := NewRateLimiter("sessions=2/1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{limiter: limiter}
+	r := httptest.NewRequest("POST", "/api/workspaces/apply", nil)
+	for i := range 2 {
+		if err := s.chargeSession(r); err != nil {
+			t.Fatalf("session %d: %v", i+1, err)
+		}
+	}
+	err = s.chargeSession(r)
+	limited, ok := err.(*rateLimitError)
+	if !ok || limited.class != RateSessions || limited.retryAfter() == "0" {
+		t.Errorf("third session: got %v, want a sessions rate limit error", err)
+	}
+	// Sessions the server starts itself are not charged
+	if err := s.chargeSession(nil); err != nil {
+		t.Errorf("server-started session: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"net/http"
+)
+
+// SECTION: READ-ONLY MODE
+
+// readOnlyExempt are state-changing endpoints that still work in -readonly mode
+var readOnlyExempt = map[string]bool{
+	"/api/auth/login":  true,
+	"/api/auth/logout": true,
+}
+
+// ReadOnlyMiddleware rejects state-changing requests when the server runs with -readonly.
+// Terminal input is dropped separately by the WebSocket proxy.
+func (s *Server) ReadOnlyMiddleware(next http.Handler) http.Handler {
+	if !s.readOnly {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if !readOnlyExempt[r.URL.Path] {
+				http.Error(w, "Forbidden: server is in read-only mode", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,303 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+// SECTION: REATTACH
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Shutdown modes (-shutdown): what happens to tmux sessions when webmux exits
+const (
+	ShutdownKill = "kill" // Close every session (default)
+	ShutdownKeep = "keep" // Stop ttyd but leave tmux running, to reattach on the next start
+)
+
+func validShutdownMode(mode string) bool {
+	return mode == ShutdownKill || mode == ShutdownKeep
+}
+
+// tmux user options holding a session's webmux state, read back by Reattach
+const (
+	tmuxOptID        = "@webmux-id"
+	tmuxOptName      = "@webmux-name"
+	tmuxOptCreated   = "@webmux-created"
+	tmuxOptOwner     = "@webmux-owner"
+	tmuxOptOSC52     = "@webmux-osc52"
+	tmuxOptACL       = "@webmux-acl"
+	tmuxOptTokenHash = "@webmux-token-hash"
+	tmuxOptTtydPid   = "@webmux-ttyd-pid"
+	tmuxOptProfile   = "@webmux-profile"
+	tmuxOptTheme     = "@webmux-theme"
+	tmuxOptWorkspace = "@webmux-workspace"
+	tmuxOptKeep      = "@webmux-keep-on-exit"
+)
+
+// setTmuxOption stores a user option on the session's tmux session (empty value unsets it)
+func (sm *SessionManager) setTmuxOption(session *Session, name, value string) {
+	args := []string{"-S", session.tmuxSocket, "set-option", "-q"}
+	if value == "" {
+		args = append(args, "-u", "-t", session.tmuxSession, name)
+	} else {
+		args = append(args, "-t", session.tmuxSession, name, value)
+	}
+	if out, err := exec.Command("tmux", args...).CombinedOutput(); err != nil {
+		log.Printf("Session %s: could not set tmux option %s: %v: %s", session.ID, name, err, strings.TrimSpace(string(out)))
+	}
+}
+
+// tagTmuxSession records everything Reattach needs to rebuild the session
+func (sm *SessionManager) tagTmuxSession(session *Session) {
+	sm.setTmuxOption(session, tmuxOptID, session.ID)
+	sm.setTmuxOption(session, tmuxOptName, session.Name)
+	sm.setTmuxOption(session, tmuxOptCreated, session.CreatedAt.Format(time.RFC3339Nano))
+	sm.setTmuxOption(session, tmuxOptOwner, session.Owner)
+	sm.setTmuxOption(session, tmuxOptOSC52, session.OSC52Policy)
+	sm.setTmuxOption(session, tmuxOptACL, encodeSessionACL(session.ACL))
+	sm.setTmuxOption(session, tmuxOptTokenHash, session.tokenHash)
+	sm.setTmuxOption(session, tmuxOptProfile, session.Profile)
+	sm.setTmuxOption(session, tmuxOptWorkspace, session.Workspace)
+	if session.KeepOnExit {
+		sm.setTmuxOption(session, tmuxOptKeep, "on")
+	}
+	if len(session.theme) > 0 {
+		theme, _ := json.Marshal(session.theme)
+		sm.setTmuxOption(session, tmuxOptTheme, string(theme))
+	}
+}
+
+func encodeSessionACL(acl SessionACL) string {
+	if len(acl) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(acl)
+	return string(data)
+}
+
+// tmuxOption reads a user option of a tmux session ("" if unset)
+func tmuxOption(socket, tmuxSession, name string) string {
+	out, err := exec.Command("tmux", "-S", socket, "show-options", "-qv", "-t", tmuxSession, name).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(string(out), "\n")
+}
+
+// survivingSockets returns the tmux sockets that may hold sessions from a
+// previous run, mapped to the user whose namespace each belongs to
+func (sm *SessionManager) survivingSockets() map[string]string {
+	sockets := map[string]string{sm.tmuxSocketPath(""): ""}
+
+	userSockets, _ := filepath.Glob(filepath.Join(xdgDataHome(), "webmux", "users", "*", "tmux.sock"))
+	for _, socket := range userSockets {
+		if name := filepath.Base(filepath.Dir(socket)); validUserName(name) {
+			sockets[socket] = name
+		}
+	}
+
+	if sm.unixUsers {
+		unixSockets, _ := filepath.Glob(filepath.Join("/tmp", "tmux-*", "webmux"))
+		for _, socket := range unixSockets {
+			uid := strings.TrimPrefix(filepath.Base(filepath.Dir(socket)), "tmux-")
+			u, err := user.LookupId(uid)
+			if err != nil || !validUserName(u.Username) {
+				continue
+			}
+			// Only trust the socket that user's sessions would use
+			if sm.userSocketPath(u.Username) == socket {
+				sockets[socket] = u.Username
+			}
+		}
+	}
+	return sockets
+}
+
+// Reattach adopts webmux tmux sessions that outlived the previous server
+// (see -shutdown keep, or a crash), restarting ttyd for each and resuming
+// monitoring. Returns the number of sessions adopted.
+func (sm *SessionManager) Reattach() int {
+	var found []*Session
+	seen := make(map[string]bool)
+	maxPort := int(atomic.LoadInt32(&sm.nextPort))
+
+	for socket, owner := range sm.survivingSockets() {
+		out, err := exec.Command("tmux", "-S", socket, "list-sessions", "-F", "#{session_name}\t#{session_created}").Output()
+		if err != nil {
+			continue // No server on this socket
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			tmuxSession, created, _ := strings.Cut(line, "\t")
+			port, err := strconv.Atoi(strings.TrimPrefix(tmuxSession, "mux-"))
+			if !strings.HasPrefix(tmuxSession, "mux-") || err != nil {
+				continue
+			}
+			session := sm.readTmuxSession(socket, tmuxSession, owner, port, created)
+			if session == nil {
+				continue
+			}
+			if _, exists := sm.GetSession(session.ID); exists || seen[session.ID] {
+				log.Printf("Reattach: skipping %s on %s, session %s already exists", tmuxSession, socket, session.ID)
+				continue
+			}
+			seen[session.ID] = true
+			if num, err := strconv.Atoi(strings.TrimPrefix(session.ID, "session-")); err == nil && num > maxPort {
+				maxPort = num
+			}
+			if port > maxPort {
+				maxPort = port
+			}
+			found = append(found, session)
+		}
+	}
+	if len(found) == 0 {
+		return 0
+	}
+
+	// New sessions take ports, IDs and tmux names above everything adopted
+	atomic.StoreInt32(&sm.nextPort, int32(maxPort))
+
+	adopted := 0
+	for _, session := range found {
+		sm.killStaleTtyd(session)
+		if !portFree(session.Port) {
+			session.Port = int(atomic.AddInt32(&sm.nextPort, 1))
+		}
+		if err := sm.startTtyd(session); err != nil {
+			log.Printf("Reattach: session %s: %v", session.ID, err)
+			continue
+		}
+
+		sm.mu.Lock()
+		sm.sessions[session.ID] = session
+		sm.mu.Unlock()
+
+		if session.tokenHash != "" && sm.restoreToken != nil {
+			sm.restoreToken(session.ID, session.Owner, session.tokenHash)
+		}
+		go sm.monitorSession(session)
+
+		log.Printf("Reattached session %s (%s) on port %d", session.ID, session.tmuxSession, session.Port)
+		adopted++
+	}
+	return adopted
+}
+
+// readTmuxSession rebuilds a Session from the user options of a surviving tmux session
+func (sm *SessionManager) readTmuxSession(socket, tmuxSession, owner string, port int, created string) *Session {
+	if recorded := tmuxOption(socket, tmuxSession, tmuxOptOwner); recorded != owner {
+		log.Printf("Reattach: skipping %s on %s, recorded owner %q does not match the socket", tmuxSession, socket, recorded)
+		return nil
+	}
+
+	session := &Session{
+		ID:          tmuxOption(socket, tmuxSession, tmuxOptID),
+		Name:        tmuxOption(socket, tmuxSession, tmuxOptName),
+		Port:        port,
+		Owner:       owner,
+		OSC52Policy: tmuxOption(socket, tmuxSession, tmuxOptOSC52),
+		tmuxSession: tmuxSession,
+		tmuxSocket:  socket,
+		tokenHash:   tmuxOption(socket, tmuxSession, tmuxOptTokenHash),
+		Profile:     tmuxOption(socket, tmuxSession, tmuxOptProfile),
+		Workspace:   tmuxOption(socket, tmuxSession, tmuxOptWorkspace),
+		KeepOnExit:  tmuxOption(socket, tmuxSession, tmuxOptKeep) == "on",
+	}
+	// Sessions from before these options existed keep tmux's own name and time
+	if !strings.HasPrefix(session.ID, "session-") || len(session.ID) > 20 {
+		session.ID = fmt.Sprintf("session-%d", port)
+	}
+	if session.Name == "" {
+		session.Name = tmuxSession
+	}
+	if t, err := time.Parse(time.RFC3339Nano, tmuxOption(socket, tmuxSession, tmuxOptCreated)); err == nil {
+		session.CreatedAt = t
+	} else if secs, err := strconv.ParseInt(created, 10, 64); err == nil {
+		session.CreatedAt = time.Unix(secs, 0)
+	} else {
+		session.CreatedAt = time.Now()
+	}
+	if session.OSC52Policy != "" && !validClipboardPolicy(session.OSC52Policy) {
+		session.OSC52Policy = ""
+	}
+	if acl := tmuxOption(socket, tmuxSession, tmuxOptACL); acl != "" {
+		if err := json.Unmarshal([]byte(acl), &session.ACL); err != nil {
+			log.Printf("Reattach: session %s: ignoring unreadable ACL: %v", session.ID, err)
+			session.ACL = nil
+		}
+	}
+	if theme := tmuxOption(socket, tmuxSession, tmuxOptTheme); theme != "" {
+		json.Unmarshal([]byte(theme), &session.theme)
+		if (SessionOptions{Theme: session.theme}).validate() != nil {
+			session.theme = nil
+		}
+	}
+	return session
+}
+
+// killStaleTtyd stops a ttyd left over from the previous server (e.g. after a
+// crash), identified by the pid recorded on the tmux session
+func (sm *SessionManager) killStaleTtyd(session *Session) {
+	pid, err := strconv.Atoi(tmuxOption(session.tmuxSocket, session.tmuxSession, tmuxOptTtydPid))
+	if err != nil || pid <= 0 {
+		return
+	}
+	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return
+	}
+	args := bytes.Split(bytes.TrimSuffix(cmdline, []byte{0}), []byte{0})
+	if len(args) == 0 || filepath.Base(string(args[0])) != "ttyd" ||
+		!bytes.Contains(cmdline, []byte(session.tmuxSocket)) ||
+		!bytes.Contains(cmdline, append([]byte(session.tmuxSession), 0)) {
+		return // pid reused by something else
+	}
+
+	log.Printf("Reattach: stopping stale ttyd (pid %d) for %s", pid, session.ID)
+	syscall.Kill(pid, syscall.SIGTERM)
+	for range 50 {
+		if syscall.Kill(pid, 0) != nil {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	syscall.Kill(pid, syscall.SIGKILL)
+}
+
+// portFree reports whether ttyd could listen on port
+func portFree(port int) bool {
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return false
+	}
+	ln.Close()
+	return true
+}
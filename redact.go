@@ -0,0 +1,237 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// SECTION: REDACTION
+
+const (
+	// Replacement for redacted secrets
+	redactMask = "[REDACTED]"
+	// Limits on user-defined patterns in settings
+	maxRedactPatterns   = 50
+	maxRedactPatternLen = 512
+	// A RedactWriter holds back at most this much of an unfinished line...
+	redactMaxLine = 64 * 1024
+	// ...and then keeps this much of it in case a secret straddles the cut
+	redactOverlap = 1024
+)
+
+// builtinRedactions match common credentials. When a pattern has a capture group,
+// only the group is masked, so "password=hunter2" becomes "password=[REDACTED]".
+var builtinRedactions = []*regexp.Regexp{
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),                                     // AWS access key ID
+	regexp.MustCompile(`(?i)aws_secret_access_key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})`), // AWS secret key
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,255}\b`),                                 // GitHub tokens
+	regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,255}\b`),                               // GitHub fine-grained tokens
+	regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`),   // JWTs
+	regexp.MustCompile(`\b` + apiTokenPrefix + `[0-9a-f]{64}\b`),                            // webmux API tokens
+	regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/-]{16,}=*)`),                         // Authorization headers
+	regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|secret|token|api[_-]?key)["']?\s*[:=]\s*["']?([^\s"'&;,]+)`),
+}
+
+// Redactor masks secrets in terminal-derived data before it is written to disk
+// or returned by the API: the built-in patterns plus regexes from each user's
+// settings. A user's patterns apply only to data from their own sessions; the
+// shared server and audit logs use the default user's, since that user
+// administers the server.
+type Redactor struct {
+	custom map[string][]*regexp.Regexp // by settings owner ("" = the default user)
+	mu     sync.RWMutex
+}
+
+// redactor is shared by the log writer, audit log, clipboard previews and captures
+var redactor = NewRedactor()
+
+// NewRedactor returns a redactor with only the built-in patterns
+func NewRedactor() *Redactor {
+	return &Redactor{custom: make(map[string][]*regexp.Regexp)}
+}
+
+// compileRedactPatterns validates and compiles user-defined patterns
+func compileRedactPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	if len(patterns) > maxRedactPatterns {
+		return nil, fmt.Errorf("too many redaction patterns (max %d)", maxRedactPatterns)
+	}
+	var compiled []*regexp.Regexp
+	for _, p := range patterns {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		if len(p) > maxRedactPatternLen {
+			return nil, fmt.Errorf("redaction pattern too long (max %d bytes)", maxRedactPatternLen)
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", p, err)
+		}
+		if re.MatchString("") {
+			return nil, fmt.Errorf("redaction pattern %q matches empty text", p)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// SetCustom replaces a user's patterns
+func (rd *Redactor) SetCustom(user string, patterns []string) error {
+	compiled, err := compileRedactPatterns(patterns)
+	if err != nil {
+		return err
+	}
+
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	if len(compiled) == 0 {
+		delete(rd.custom, user)
+	} else {
+		rd.custom[user] = compiled
+	}
+	return nil
+}
+
+// patterns returns the built-in patterns followed by user's
+func (rd *Redactor) patterns(user string) []*regexp.Regexp {
+	rd.mu.RLock()
+	defer rd.mu.RUnlock()
+	return append(builtinRedactions[:len(builtinRedactions):len(builtinRedactions)], rd.custom[user]...)
+}
+
+// Redact returns s with every secret masked, for the shared logs
+func (rd *Redactor) Redact(s string) string {
+	return rd.RedactFor("", s)
+}
+
+// RedactFor returns s with every secret masked, for data owned by user
+func (rd *Redactor) RedactFor(user, s string) string {
+	for _, re := range rd.patterns(user) {
+		s = redactMatches(re, s)
+	}
+	return s
+}
+
+// redactMatches masks the matches of re (or their first capture group) in s
+func redactMatches(re *regexp.Regexp, s string) string {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if len(m) >= 4 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(redactMask)
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// safeCut moves cut back to the start of any of user's matches that spans it
+func (rd *Redactor) safeCut(user, s string, cut int) int {
+	for _, re := range rd.patterns(user) {
+		for _, m := range re.FindAllStringIndex(s, -1) {
+			if m[0] < cut && cut < m[1] {
+				cut = m[0]
+			}
+		}
+	}
+	return cut
+}
+
+// applyRedactionSettings loads the server user's patterns from their settings file
+func (s *Server) applyRedactionSettings() {
+	s.settingsMu.RLock()
+	patterns := s.settings.Redaction.Patterns
+	s.settingsMu.RUnlock()
+	if err := redactor.SetCustom(s.user, patterns); err != nil {
+		log.Printf("Ignoring redaction patterns in %s: %v", settingsFilePath(s.user), err)
+	}
+}
+
+// RedactWriter redacts a stream before passing it on. Patterns match within a
+// line, so the unfinished last line is held back until its newline arrives (or
+// it grows past redactMaxLine) and secrets split across writes are still caught.
+type RedactWriter struct {
+	rd      *Redactor
+	user    string // whose patterns apply
+	w       io.Writer
+	pending []byte
+}
+
+// NewWriter returns a writer that redacts everything written to w with user's
+// patterns. Close (or Flush) must be called to write the held-back tail.
+func (rd *Redactor) NewWriter(user string, w io.Writer) *RedactWriter {
+	return &RedactWriter{rd: rd, user: user, w: w}
+}
+
+// Write buffers p and passes on every complete line, redacted
+func (rw *RedactWriter) Write(p []byte) (int, error) {
+	rw.pending = append(rw.pending, p...)
+	if err := rw.emit(false); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes the held-back tail
+func (rw *RedactWriter) Flush() error {
+	return rw.emit(true)
+}
+
+// Close flushes the tail (the underlying writer is left open)
+func (rw *RedactWriter) Close() error {
+	return rw.Flush()
+}
+
+// emit writes the part of the buffer no later data can change
+func (rw *RedactWriter) emit(final bool) error {
+	text := string(rw.pending)
+	cut := len(text)
+	if !final {
+		cut = strings.LastIndexByte(text, '\n') + 1
+		if cut == 0 {
+			if len(text) <= redactMaxLine {
+				return nil
+			}
+			cut = rw.rd.safeCut(rw.user, text, len(text)-redactOverlap)
+			if cut == 0 {
+				// One enormous match: mask what we have rather than hold it forever
+				cut = len(text)
+			}
+		}
+	}
+	if cut == 0 {
+		return nil
+	}
+	rw.pending = append(rw.pending[:0], text[cut:]...)
+	_, err := io.WriteString(rw.w, rw.rd.RedactFor(rw.user, text[:cut]))
+	return err
+}
@@ -0,0 +1,649 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+// SECTION: RESURRECT
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resurrect modes (-resurrect)
+const (
+	ResurrectOff  = "off"  // Don't save session definitions
+	ResurrectAsk  = "ask"  // Save them; recreate on request from the UI, API or wm resurrect (default)
+	ResurrectAuto = "auto" // Save them and recreate them at startup
+)
+
+// How often session definitions are saved, besides after creates and closes
+const resurrectSaveInterval = 30 * time.Second
+
+// Per-user state file holding session definitions
+const savedSessionsFile = "sessions.json"
+
+// Limit on a saved command line, so re-running it fits in one key request
+const maxSavedCommandLength = 1024
+
+// SessionDefinition describes a session well enough to recreate it once its
+// tmux server is gone, e.g. after a reboot
+type SessionDefinition struct {
+	ID          string            `json:"id"` // Session ID when it was saved
+	Name        string            `json:"name"`
+	CustomName  bool              `json:"customName,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	Cwd         string            `json:"cwd,omitempty"`
+	Command     []string          `json:"command,omitempty"` // Foreground program, if not the shell
+	Env         map[string]string `json:"env,omitempty"`     // Variables set on the session besides webmux's own
+	OSC52Policy string            `json:"osc52Policy,omitempty"`
+	Profile     string            `json:"profile,omitempty"`
+	Workspace   string            `json:"workspace,omitempty"`
+	Group       *SavedGroup       `json:"group,omitempty"`
+	Rerun       bool              `json:"rerun,omitempty"` // Command will be re-run (set in listings only)
+}
+
+// SavedGroup records the sidebar group a saved session was in
+type SavedGroup struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Layout     string    `json:"layout,omitempty"`
+	SplitRatio []float64 `json:"splitRatio,omitempty"`
+	Index      int       `json:"index"` // Position within the group
+	Size       int       `json:"size"`  // Sessions in the group
+}
+
+// savedSessions is the content of a user's sessions.json
+type savedSessions struct {
+	SavedAt  time.Time           `json:"savedAt"`
+	Sessions []SessionDefinition `json:"sessions"`
+}
+
+// Resurrector keeps session definitions in the state store and recreates the
+// sessions that did not survive a restart
+type Resurrector struct {
+	mode     string
+	commands map[string]bool // Programs that may be re-run (-resurrect-commands)
+	mu       sync.Mutex
+	pending  map[string][]SessionDefinition // Saved sessions that are not running, by user
+	written  map[string]string              // Last definitions written, by user
+	saveNow  chan struct{}
+}
+
+func validResurrectMode(mode string) bool {
+	return mode == ResurrectOff || mode == ResurrectAsk || mode == ResurrectAuto
+}
+
+// NewResurrector parses -resurrect and -resurrect-commands (nil when off)
+func NewResurrector(mode, commands string) (*Resurrector, error) {
+	if !validResurrectMode(mode) {
+		return nil, fmt.Errorf("invalid mode %q (use off, ask or auto)", mode)
+	}
+	if mode == ResurrectOff {
+		return nil, nil
+	}
+	r := &Resurrector{
+		mode:     mode,
+		commands: make(map[string]bool),
+		pending:  make(map[string][]SessionDefinition),
+		written:  make(map[string]string),
+		saveNow:  make(chan struct{}, 1),
+	}
+	for _, name := range strings.Split(commands, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if strings.ContainsAny(name, "/ \t") {
+			return nil, fmt.Errorf("invalid command %q (use program names such as vim or tail)", name)
+		}
+		r.commands[name] = true
+	}
+	return r, nil
+}
+
+// requestSave asks the saver to write definitions now rather than at the next tick
+func (r *Resurrector) requestSave() {
+	if r == nil {
+		return
+	}
+	select {
+	case r.saveNow <- struct{}{}:
+	default:
+	}
+}
+
+// rerunnable reports whether a saved command may be run again
+func (r *Resurrector) rerunnable(command []string) bool {
+	return len(command) > 0 && r.commands[filepath.Base(command[0])]
+}
+
+// pendingFor returns user's saved sessions that can be recreated
+func (r *Resurrector) pendingFor(user string) []SessionDefinition {
+	defs := make([]SessionDefinition, 0)
+	if r == nil {
+		return defs
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, def := range r.pending[user] {
+		def.Rerun = r.rerunnable(def.Command)
+		defs = append(defs, def)
+	}
+	return defs
+}
+
+// take removes and returns user's saved sessions matching ids (IDs or names;
+// all when empty)
+func (r *Resurrector) take(user string, ids []string) []SessionDefinition {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var taken, rest []SessionDefinition
+	for _, def := range r.pending[user] {
+		if len(ids) == 0 || slices.Contains(ids, def.ID) || slices.Contains(ids, def.Name) {
+			taken = append(taken, def)
+		} else {
+			rest = append(rest, def)
+		}
+	}
+	if len(rest) == 0 {
+		delete(r.pending, user)
+	} else {
+		r.pending[user] = rest
+	}
+	return taken
+}
+
+// loadSavedSessions reads every user's saved definitions, keeping those whose
+// session is not running (reattached sessions are already back)
+func (s *Server) loadSavedSessions() {
+	r := s.resurrect
+	if r == nil {
+		return
+	}
+	running := make(map[string]bool)
+	for _, session := range s.manager.ListSessions() {
+		running[session.ID] = true
+	}
+
+	users := []string{""}
+	paths, _ := filepath.Glob(filepath.Join(s.store.dir, "users", "*", savedSessionsFile))
+	for _, path := range paths {
+		if name := filepath.Base(filepath.Dir(path)); validUserName(name) {
+			users = append(users, name)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range users {
+		name := userStateFile(user, savedSessionsFile)
+		data, err := s.store.ReadFile(name)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				log.Printf("Resurrect: %v", err)
+			}
+			continue
+		}
+		var saved savedSessions
+		if err := json.Unmarshal(data, &saved); err != nil {
+			log.Printf("Resurrect: %s: %v", name, err)
+			continue
+		}
+		r.written[user] = ""
+		for _, def := range saved.Sessions {
+			if !running[def.ID] {
+				r.pending[user] = append(r.pending[user], def)
+			}
+		}
+		if n := len(r.pending[user]); n > 0 {
+			log.Printf("Resurrect: %d session(s) saved at %s can be recreated (%s)", n, saved.SavedAt.Format(time.RFC3339), name)
+		}
+	}
+}
+
+// runSessionSaver saves session definitions periodically and when asked to
+func (s *Server) runSessionSaver() {
+	ticker := time.NewTicker(resurrectSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.resurrect.saveNow:
+		}
+		s.saveSessionDefinitions()
+	}
+}
+
+// saveSessionDefinitions writes each user's running sessions, plus saved ones
+// still waiting to be recreated, to the state store
+func (s *Server) saveSessionDefinitions() {
+	r := s.resurrect
+	if r == nil {
+		return
+	}
+
+	byUser := make(map[string][]SessionDefinition)
+	for _, session := range s.manager.ListSessions() {
+		def := s.manager.sessionDefinition(session)
+		s.tenant(session.Owner).describeGroup(&def)
+		byUser[session.Owner] = append(byUser[session.Owner], def)
+	}
+	// Sessions disappear on shutdown; keep what was saved before it
+	if s.manager.Closed() {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for user, defs := range r.pending {
+		byUser[user] = append(byUser[user], defs...)
+	}
+	for user := range r.written {
+		if _, ok := byUser[user]; !ok {
+			byUser[user] = nil
+		}
+	}
+
+	for user, defs := range byUser {
+		name := userStateFile(user, savedSessionsFile)
+		if len(defs) == 0 {
+			if err := s.store.Remove(name); err != nil {
+				log.Printf("Resurrect: %v", err)
+			}
+			delete(r.written, user)
+			continue
+		}
+		slices.SortFunc(defs, func(a, b SessionDefinition) int { return a.CreatedAt.Compare(b.CreatedAt) })
+		key, _ := json.Marshal(defs)
+		if r.written[user] == string(key) {
+			continue
+		}
+		data, _ := json.MarshalIndent(savedSessions{SavedAt: time.Now(), Sessions: defs}, "", "  ")
+		if err := s.store.WriteFile(name, data); err != nil {
+			log.Printf("Resurrect: saving %s: %v", name, err)
+			continue
+		}
+		r.written[user] = string(key)
+	}
+}
+
+// describeGroup records the sidebar group holding def's session
+func (s *Server) describeGroup(def *SessionDefinition) {
+	s.uiStateMu.RLock()
+	defer s.uiStateMu.RUnlock()
+	if s.uiState == nil {
+		return
+	}
+	def.CustomName = slices.Contains(s.uiState.CustomNames, def.ID)
+	for _, g := range s.uiState.Groups {
+		if i := slices.Index(g.SessionIDs, def.ID); i >= 0 {
+			def.Group = &SavedGroup{
+				ID:         g.ID,
+				Name:       g.Name,
+				Layout:     g.Layout,
+				SplitRatio: g.SplitRatio,
+				Index:      i,
+				Size:       len(g.SessionIDs),
+			}
+			return
+		}
+	}
+}
+
+// resurrectAll recreates every user's saved sessions (-resurrect auto)
+func (s *Server) resurrectAll() {
+	s.resurrect.mu.Lock()
+	users := slices.Collect(maps.Keys(s.resurrect.pending))
+	s.resurrect.mu.Unlock()
+
+	for _, user := range users {
+		created, err := s.tenant(user).resurrectSessions(nil, nil)
+		if err != nil {
+			log.Printf("Resurrect: %v", err)
+		}
+		if len(created) > 0 {
+			log.Printf("Resurrected %d session(s)", len(created))
+		}
+	}
+}
+
+// resurrectSessions recreates this user's saved sessions matching ids (IDs or
+// names; all when empty), restoring their sidebar groups. r is the request
+// asking for them (nil at startup), charged for each session.
+func (s *Server) resurrectSessions(ids []string, r *http.Request) ([]*Session, error) {
+	rs := s.resurrect
+	if rs == nil {
+		return nil, fmt.Errorf("session resurrection is disabled (-resurrect off)")
+	}
+	defs := rs.take(s.user, ids)
+	if len(defs) == 0 && len(ids) > 0 {
+		return nil, fmt.Errorf("no saved session matches %s", strings.Join(ids, ", "))
+	}
+
+	var created []*Session
+	var firstErr error
+	newIDs := make(map[string]string)
+	for _, def := range defs {
+		err := s.chargeSession(r)
+		var session *Session
+		if err == nil {
+			session, err = s.resurrectSession(def)
+		}
+		if err != nil {
+			log.Printf("Resurrect: session %s (%s): %v", def.ID, def.Name, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			// Keep it saved so it can be retried
+			rs.mu.Lock()
+			rs.pending[s.user] = append(rs.pending[s.user], def)
+			rs.mu.Unlock()
+			continue
+		}
+		created = append(created, session)
+		newIDs[def.ID] = session.ID
+	}
+	s.restoreGroups(defs, newIDs)
+	rs.requestSave()
+
+	if len(created) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return created, nil
+}
+
+// resurrectSession starts a session from a saved definition
+func (s *Server) resurrectSession(def SessionDefinition) (*Session, error) {
+	// Start from its profile (shell, command, size, theme) if that still exists
+	var opts SessionOptions
+	if def.Profile != "" {
+		var err error
+		if opts, err = s.profileOptions(def.Profile); err != nil {
+			log.Printf("Resurrect: session %s: %v; using the defaults", def.ID, err)
+		}
+	}
+	opts.Cwd, opts.Env = def.Cwd, maps.Clone(def.Env)
+	opts.Workspace = def.Workspace
+	if info, err := os.Stat(opts.Cwd); opts.Cwd != "" && (err != nil || !info.IsDir()) {
+		log.Printf("Resurrect: session %s: %s is gone, starting in the default directory", def.ID, opts.Cwd)
+		opts.Cwd = ""
+	}
+	for key := range opts.Env {
+		if !validEnvName.MatchString(key) || managedEnvVar(key) {
+			delete(opts.Env, key)
+		}
+	}
+
+	// Replay the last snapshot of its scrollback into the new pane
+	key := snapshotKey(def.ID, def.CreatedAt)
+	opts.replay = s.snapshots.replayFile(key)
+
+	session, err := s.manager.CreateSession(def.Name, s.user, opts)
+	if err != nil {
+		if opts.replay != "" {
+			os.Remove(opts.replay)
+		}
+		return nil, err
+	}
+	s.snapshots.Remove(key)
+	if def.OSC52Policy != "" {
+		s.manager.SetClipboardPolicy(session.ID, def.OSC52Policy)
+	}
+	if len(opts.Command) == 0 && s.resurrect.rerunnable(def.Command) {
+		steps := []KeyStep{{Type: "text", Value: shellJoin(def.Command)}, {Type: "key", Value: "Enter"}}
+		if err := s.manager.SendKeys(session.ID, &KeysRequest{Sequence: steps}); err != nil {
+			log.Printf("Resurrect: session %s: could not re-run %s: %v", session.ID, def.Command[0], err)
+		}
+	}
+	log.Printf("Resurrected session %s (%s) as %s", def.ID, def.Name, session.ID)
+	return session, nil
+}
+
+// restoreGroups rebuilds the sidebar groups of recreated sessions
+func (s *Server) restoreGroups(defs []SessionDefinition, newIDs map[string]string) {
+	type member struct {
+		index int
+		id    string
+	}
+	members := make(map[string][]member)
+	groups := make(map[string]*SavedGroup)
+	var order, customNames []string
+	for _, def := range defs {
+		id, ok := newIDs[def.ID]
+		if !ok {
+			continue
+		}
+		if def.CustomName {
+			customNames = append(customNames, id)
+		}
+		if def.Group == nil {
+			continue
+		}
+		if _, seen := groups[def.Group.ID]; !seen {
+			groups[def.Group.ID] = def.Group
+			order = append(order, def.Group.ID)
+		}
+		members[def.Group.ID] = append(members[def.Group.ID], member{def.Group.Index, id})
+	}
+
+	s.uiStateMu.Lock()
+	defer s.uiStateMu.Unlock()
+	if s.uiState == nil {
+		s.uiState = &UIState{Groups: make([]UIGroup, 0), GroupOrder: make([]string, 0)}
+	}
+	s.uiState.CustomNames = append(s.uiState.CustomNames, customNames...)
+	for _, gid := range order {
+		saved := groups[gid]
+		list := members[gid]
+		slices.SortFunc(list, func(a, b member) int { return a.index - b.index })
+
+		s.uiState.GroupCounter++
+		group := UIGroup{
+			ID:         fmt.Sprintf("group-%d", s.uiState.GroupCounter),
+			Name:       saved.Name,
+			Layout:     saved.Layout,
+			SplitRatio: saved.SplitRatio,
+		}
+		for _, m := range list {
+			group.SessionIDs = append(group.SessionIDs, m.id)
+		}
+		// Only some of the group came back; start from the default layout
+		if len(list) != saved.Size || group.Layout == "" {
+			group.Layout = getDefaultLayout(len(list))
+			group.SplitRatio = getDefaultSplitRatio(len(list))
+		}
+		s.uiState.Groups = append(s.uiState.Groups, group)
+		s.uiState.GroupOrder = append(s.uiState.GroupOrder, group.ID)
+	}
+	s.changedUIStateLocked()
+}
+
+// handleResurrect lists, recreates or discards sessions saved before a restart
+// GET /api/resurrect, POST /api/resurrect {"ids": [...]}, DELETE /api/resurrect?id=...
+func (s *Server) handleResurrect(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(s.resurrect.pendingFor(s.user))
+
+	case http.MethodPost:
+		var req struct {
+			IDs []string `json:"ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		sessions, err := s.resurrectSessions(req.IDs, r)
+		var limited *rateLimitError
+		if errors.As(err, &limited) {
+			writeRateLimited(w, limited)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, session := range sessions {
+			s.audit.Record(r, AuditSessionCreate, session.ID, map[string]any{"name": session.Name, "resurrected": true})
+		}
+		if sessions == nil {
+			sessions = make([]*Session, 0)
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(sessions)
+
+	case http.MethodDelete:
+		if s.resurrect == nil {
+			http.Error(w, "Session resurrection is disabled", http.StatusBadRequest)
+			return
+		}
+		discarded := s.resurrect.take(s.user, r.URL.Query()["id"])
+		s.resurrect.requestSave()
+		json.NewEncoder(w).Encode(map[string]int{"discarded": len(discarded)})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// sessionDefinition captures what is needed to recreate a running session
+func (sm *SessionManager) sessionDefinition(session *Session) SessionDefinition {
+	def := SessionDefinition{
+		ID:          session.ID,
+		Name:        session.Name,
+		CreatedAt:   session.CreatedAt,
+		OSC52Policy: session.OSC52Policy,
+		Profile:     session.Profile,
+		Workspace:   session.Workspace,
+	}
+	out, err := exec.Command("tmux", "-S", session.tmuxSocket, "display-message", "-p", "-t", session.tmuxSession,
+		"#{pane_pid}\t#{pane_current_path}").Output()
+	if err == nil {
+		pid, cwd, _ := strings.Cut(strings.TrimSuffix(string(out), "\n"), "\t")
+		def.Cwd = cwd
+		if shellPid, err := strconv.Atoi(pid); err == nil {
+			def.Command = foregroundCommand(shellPid, session.Owner)
+		}
+	}
+	def.Env = sm.sessionEnvOverrides(session)
+	return def
+}
+
+// sessionEnvOverrides returns the variables set on a tmux session other than
+// the ones webmux sets itself
+func (sm *SessionManager) sessionEnvOverrides(session *Session) map[string]string {
+	out, err := exec.Command("tmux", "-S", session.tmuxSocket, "show-environment", "-t", session.tmuxSession).Output()
+	if err != nil {
+		return nil
+	}
+	var env map[string]string
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || !validEnvName.MatchString(key) || managedEnvVar(key) {
+			continue
+		}
+		// Don't write secrets to disk
+		if redactor.RedactFor(session.Owner, line) != line {
+			continue
+		}
+		if env == nil {
+			env = make(map[string]string)
+		}
+		env[key] = value
+	}
+	return env
+}
+
+// Variables tmux copies from the attaching client (update-environment); here
+// that is ttyd, so they describe webmux rather than the session
+var tmuxClientEnvVars = []string{
+	"KRB5CCNAME", "SSH_ASKPASS", "SSH_AUTH_SOCK", "SSH_AGENT_PID", "SSH_CONNECTION", "WINDOWID", "XAUTHORITY",
+}
+
+// managedEnvVar reports whether webmux or tmux sets key in every session
+func managedEnvVar(key string) bool {
+	switch key {
+	case "COLORTERM", "ENV", "ZDOTDIR", "_wm_bin":
+		return true
+	}
+	return strings.HasPrefix(key, "WEBMUX_") || slices.Contains(displayEnvVars, key) || slices.Contains(tmuxClientEnvVars, key)
+}
+
+// foregroundCommand returns the argv of the program in the foreground of a
+// shell's terminal, or nil when the shell itself is in the foreground (or the
+// command line holds a secret by owner's redaction patterns)
+func foregroundCommand(shellPid int, owner string) []string {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", shellPid))
+	if err != nil {
+		return nil
+	}
+	// Fields after "pid (comm)": state ppid pgrp session tty_nr tpgid ...
+	end := strings.LastIndexByte(string(stat), ')')
+	if end < 0 {
+		return nil
+	}
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 6 {
+		return nil
+	}
+	tpgid, err := strconv.Atoi(fields[5])
+	if err != nil || tpgid <= 0 || tpgid == shellPid {
+		return nil
+	}
+
+	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", tpgid))
+	if err != nil || len(cmdline) == 0 || len(cmdline) > maxSavedCommandLength {
+		return nil
+	}
+	argv := strings.Split(strings.TrimSuffix(string(cmdline), "\x00"), "\x00")
+	// Don't write secrets to disk
+	if joined := strings.Join(argv, " "); redactor.RedactFor(owner, joined) != joined {
+		return nil
+	}
+	return argv
+}
+
+// shellJoin quotes argv for typing into a POSIX shell
+func shellJoin(argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,+@%") == "" {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
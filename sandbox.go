@@ -0,0 +1,243 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SECTION: FILE SANDBOX
+
+// FileSandbox restricts the file browser, downloads, uploads and marked files
+// to allowed roots, minus denied globs. Every file handler resolves paths through Resolve.
+type FileSandbox struct {
+	roots []string // absolute, symlink-resolved; empty = whole filesystem
+	deny  []string // glob patterns; with a "/" they match full paths, otherwise any path component
+}
+
+// sandboxError reports a path rejected by the sandbox
+type sandboxError struct {
+	path   string
+	reason string
+}
+
+func (e *sandboxError) Error() string {
+	return fmt.Sprintf("%s: %s", e.path, e.reason)
+}
+
+// expandHome replaces a leading ~ with the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(list string) []string {
+	var items []string
+	for item := range strings.SplitSeq(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// resolveRoot makes a root absolute and resolves its symlinks (if it exists yet)
+func resolveRoot(root string) (string, error) {
+	abs, err := filepath.Abs(expandHome(root))
+	if err != nil {
+		return "", fmt.Errorf("invalid root %q: %w", root, err)
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("invalid root %q: %w", root, err)
+	}
+	return abs, nil
+}
+
+// NewFileSandbox builds a sandbox from comma-separated roots and deny globs.
+// extraRoots (e.g. the upload directory) are allowed whenever roots are restricted.
+func NewFileSandbox(roots, deny string, extraRoots ...string) (*FileSandbox, error) {
+	sb := &FileSandbox{}
+	rootList := splitList(roots)
+	if len(rootList) > 0 {
+		rootList = append(rootList, extraRoots...)
+	}
+	for _, root := range rootList {
+		abs, err := resolveRoot(root)
+		if err != nil {
+			return nil, err
+		}
+		sb.roots = append(sb.roots, abs)
+	}
+	for _, pattern := range splitList(deny) {
+		pattern = expandHome(pattern)
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid deny pattern %q: %w", pattern, err)
+		}
+		sb.deny = append(sb.deny, filepath.Clean(pattern))
+	}
+	return sb, nil
+}
+
+// Restricted reports whether access is limited to specific roots
+func (sb *FileSandbox) Restricted() bool {
+	return len(sb.roots) > 0
+}
+
+// DefaultDir returns the directory the file browser opens in
+func (sb *FileSandbox) DefaultDir() string {
+	home, _ := os.UserHomeDir()
+	if home != "" {
+		if _, err := sb.Resolve(home); err == nil {
+			return home
+		}
+	}
+	if len(sb.roots) > 0 {
+		return sb.roots[0]
+	}
+	return "/"
+}
+
+// withinRoots reports whether path is inside one of the roots
+func (sb *FileSandbox) withinRoots(path string) bool {
+	if len(sb.roots) == 0 {
+		return true
+	}
+	for _, root := range sb.roots {
+		if path == root || strings.HasPrefix(path, strings.TrimSuffix(root, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// deniedBy returns the deny pattern matching path or any of its parents ("" if none)
+func (sb *FileSandbox) deniedBy(path string) string {
+	for _, pattern := range sb.deny {
+		full := strings.Contains(pattern, "/")
+		for p := path; ; p = filepath.Dir(p) {
+			subject := p
+			if !full {
+				subject = filepath.Base(p)
+			}
+			if ok, _ := filepath.Match(pattern, subject); ok {
+				return pattern
+			}
+			if p == "/" || p == "." {
+				break
+			}
+		}
+	}
+	return ""
+}
+
+// resolveSymlinks resolves symlinks in the longest existing prefix of path,
+// so paths that do not exist yet (upload targets) are still checked
+func resolveSymlinks(path string) (string, error) {
+	var rest []string
+	p := path
+	for {
+		resolved, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return path, nil
+		}
+		rest = append([]string{filepath.Base(p)}, rest...)
+		p = parent
+	}
+}
+
+// Resolve cleans a client-supplied path and checks it against the roots, the deny
+// list and symlinks pointing outside the roots. Returns the cleaned absolute path,
+// or a *sandboxError naming the offending path.
+func (sb *FileSandbox) Resolve(path string) (string, error) {
+	if path == "" {
+		return "", errors.New("path required")
+	}
+	abs, err := filepath.Abs(expandHome(path))
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := resolveSymlinks(abs)
+	if err != nil {
+		return "", err
+	}
+
+	if !sb.withinRoots(abs) {
+		return "", &sandboxError{path: abs, reason: "outside the allowed roots"}
+	}
+	if !sb.withinRoots(resolved) {
+		return "", &sandboxError{path: abs, reason: fmt.Sprintf("symlink to %s escapes the allowed roots", resolved)}
+	}
+	if pattern := sb.deniedBy(abs); pattern != "" {
+		return "", &sandboxError{path: abs, reason: fmt.Sprintf("denied by %q", pattern)}
+	}
+	if pattern := sb.deniedBy(resolved); pattern != "" {
+		return "", &sandboxError{path: abs, reason: fmt.Sprintf("symlink to %s is denied by %q", resolved, pattern)}
+	}
+	return abs, nil
+}
+
+// Allowed reports whether path passes the sandbox (used to filter listings and archives)
+func (sb *FileSandbox) Allowed(path string) bool {
+	_, err := sb.Resolve(path)
+	return err == nil
+}
+
+// writeFileError writes a 403 for sandbox rejections and a 400 for other path errors
+func writeFileError(w http.ResponseWriter, err error) {
+	var se *sandboxError
+	if errors.As(err, &se) {
+		http.Error(w, "Forbidden: "+se.Error(), http.StatusForbidden)
+		return
+	}
+	http.Error(w, "Invalid path: "+err.Error(), http.StatusBadRequest)
+}
+
+// Within returns a sandbox limited to roots that keeps sb's deny globs
+func (sb *FileSandbox) Within(roots ...string) (*FileSandbox, error) {
+	confined := &FileSandbox{deny: sb.deny}
+	for _, root := range roots {
+		abs, err := resolveRoot(root)
+		if err != nil {
+			return nil, err
+		}
+		confined.roots = append(confined.roots, abs)
+	}
+	return confined, nil
+}
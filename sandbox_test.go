@@ -0,0 +1,96 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSandboxResolve(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(dir, "root")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{filepath.Join(root, "src"), filepath.Join(root, ".ssh"), outside} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, ".ssh"), filepath.Join(root, "keys")); err != nil {
+		t.Fatal(err)
+	}
+
+	sb, err := NewFileSandbox(root, ".ssh,*.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path    string
+		want    string // cleaned path, or "" when rejected
+		sandbox bool   // rejection is a *sandboxError
+	}{
+		{path: root, want: root},
+		{path: filepath.Join(root, "src"), want: filepath.Join(root, "src")},
+		{path: filepath.Join(root, "src", "..", "src", "main.go"), want: filepath.Join(root, "src", "main.go")},
+		{path: filepath.Join(root, "new", "file.txt"), want: filepath.Join(root, "new", "file.txt")},
+		{path: filepath.Join(root, "..", "outside"), sandbox: true},
+		{path: outside, sandbox: true},
+		{path: "/etc/passwd", sandbox: true},
+		{path: filepath.Join(root, "escape"), sandbox: true},
+		{path: filepath.Join(root, "escape", "new.txt"), sandbox: true},
+		{path: filepath.Join(root, ".ssh", "id_ed25519"), sandbox: true},
+		{path: filepath.Join(root, "keys", "id_ed25519"), sandbox: true},
+		{path: filepath.Join(root, "src", "cert.pem"), sandbox: true},
+		{path: ""},
+	}
+	for _, tt := range tests {
+		got, err := sb.Resolve(tt.path)
+		if tt.want != "" {
+			if err != nil || got != tt.want {
+				t.Errorf("Resolve(%q) = %q, %v; want %q", tt.path, got, err, tt.want)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("Resolve(%q) = %q, want an error", tt.path, got)
+			continue
+		}
+		var se *sandboxError
+		if errors.As(err, &se) != tt.sandbox {
+			t.Errorf("Resolve(%q) error %v: sandbox error = %v, want %v", tt.path, err, !tt.sandbox, tt.sandbox)
+		}
+	}
+}
+
+func TestFileSandboxUnrestricted(t *testing.T) {
+	sb, err := NewFileSandbox("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := sb.Resolve("/etc/../etc/hosts"); err != nil || got != "/etc/hosts" {
+		t.Errorf("Resolve = %q, %v; want /etc/hosts", got, err)
+	}
+}
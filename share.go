@@ -0,0 +1,373 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SECTION: SHARES
+
+const (
+	// Default and maximum lifetime of a read-only share link
+	defaultShareTTL = time.Hour
+	maxShareTTL     = 7 * 24 * time.Hour
+	// Largest client frame a viewer may send (viewers only send handshakes and flow control)
+	maxViewerFrameSize = 64 * 1024
+)
+
+// ttyd client message types (first payload byte of each WebSocket message)
+const (
+	ttydMsgInput  = '0'
+	ttydMsgResize = '1'
+)
+
+// Share is a read-only link to one session
+type Share struct {
+	ID        string    `json:"id"`
+	SessionID string    `json:"sessionId"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+
+	hash  string        // SHA-256 of the link token
+	done  chan struct{} // closed on revoke/expiry to disconnect viewers
+	timer *time.Timer
+}
+
+// ShareManager tracks active share links (in memory; links end when the server stops)
+type ShareManager struct {
+	shares map[string]*Share // ID -> share
+	mu     sync.Mutex
+}
+
+// NewShareManager creates an empty share manager
+func NewShareManager() *ShareManager {
+	return &ShareManager{shares: make(map[string]*Share)}
+}
+
+// Create mints a share link token for a session, valid for ttl
+func (shm *ShareManager) Create(sessionID string, ttl time.Duration, createdBy string) (*Share, string) {
+	token := randomToken(24)
+	now := time.Now()
+	share := &Share{
+		ID:        randomToken(6),
+		SessionID: sessionID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+		CreatedBy: createdBy,
+		hash:      hashToken(token),
+		done:      make(chan struct{}),
+	}
+	share.timer = time.AfterFunc(ttl, func() {
+		if shm.Revoke(share.ID) {
+			log.Printf("Share %s for session %s expired", share.ID, sessionID)
+		}
+	})
+
+	shm.mu.Lock()
+	shm.shares[share.ID] = share
+	shm.mu.Unlock()
+	return share, token
+}
+
+// Lookup returns the active share for a link token
+func (shm *ShareManager) Lookup(token string) (*Share, bool) {
+	hash := hashToken(token)
+	shm.mu.Lock()
+	defer shm.mu.Unlock()
+
+	for _, share := range shm.shares {
+		if share.hash == hash && time.Now().Before(share.ExpiresAt) {
+			return share, true
+		}
+	}
+	return nil, false
+}
+
+// Get returns a copy of a share by ID
+func (shm *ShareManager) Get(id string) (Share, bool) {
+	shm.mu.Lock()
+	defer shm.mu.Unlock()
+
+	share, ok := shm.shares[id]
+	if !ok {
+		return Share{}, false
+	}
+	return *share, true
+}
+
+// List returns the active shares, oldest first
+func (shm *ShareManager) List() []Share {
+	shm.mu.Lock()
+	defer shm.mu.Unlock()
+
+	list := make([]Share, 0, len(shm.shares))
+	for _, share := range shm.shares {
+		list = append(list, *share)
+	}
+	slices.SortFunc(list, func(a, b Share) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return list
+}
+
+// Revoke ends a share and disconnects its viewers; reports whether it existed
+func (shm *ShareManager) Revoke(id string) bool {
+	shm.mu.Lock()
+	defer shm.mu.Unlock()
+
+	share, ok := shm.shares[id]
+	if !ok {
+		return false
+	}
+	share.timer.Stop()
+	close(share.done)
+	delete(shm.shares, id)
+	return true
+}
+
+// RevokeSession ends all shares of a closed session
+func (shm *ShareManager) RevokeSession(sessionID string) {
+	shm.mu.Lock()
+	var ids []string
+	for id, share := range shm.shares {
+		if share.SessionID == sessionID {
+			ids = append(ids, id)
+		}
+	}
+	shm.mu.Unlock()
+
+	for _, id := range ids {
+		shm.Revoke(id)
+	}
+}
+
+// shareURL returns the absolute viewer URL for a token as seen by the requesting client
+func shareURL(r *http.Request, token string) string {
+	scheme := "http"
+	if isSecureRequest(r) {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/s/%s/", scheme, r.Host, token)
+}
+
+// handleShares lists and creates share links
+// GET /api/shares, POST /api/shares {"sessionId", "expiresIn"}
+func (s *Server) handleShares(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		// Only list links to sessions this user owns
+		shares := make([]Share, 0)
+		for _, share := range s.shares.List() {
+			if s.sessionAccess(share.SessionID) == AccessOwner {
+				shares = append(shares, share)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"shares": shares})
+
+	case http.MethodPost:
+		var req struct {
+			SessionID string `json:"sessionId"`
+			ExpiresIn string `json:"expiresIn"` // Go duration, e.g. "30m"; empty = 1h
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch s.sessionAccess(req.SessionID) {
+		case "":
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		case AccessOwner:
+		default:
+			http.Error(w, "Forbidden: only the session owner can share it", http.StatusForbidden)
+			return
+		}
+
+		ttl := defaultShareTTL
+		if req.ExpiresIn != "" {
+			d, err := time.ParseDuration(req.ExpiresIn)
+			if err != nil || d <= 0 {
+				http.Error(w, "Invalid expiresIn: must be a positive duration like 30m or 2h", http.StatusBadRequest)
+				return
+			}
+			if d > maxShareTTL {
+				http.Error(w, fmt.Sprintf("expiresIn may be at most %s", maxShareTTL), http.StatusBadRequest)
+				return
+			}
+			ttl = d
+		}
+
+		share, token := s.shares.Create(req.SessionID, ttl, requestUser(r))
+		log.Printf("Share %s for session %s created by %s (expires %s)",
+			share.ID, share.SessionID, clientDescription(r), share.ExpiresAt.Format(time.RFC3339))
+		s.audit.Record(r, AuditShareCreate, share.SessionID, map[string]any{"share": share.ID, "expiresAt": share.ExpiresAt})
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{
+			"share": share,
+			"token": token,
+			"url":   shareURL(r, token),
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleShare revokes a share link
+// DELETE /api/shares/{id}
+func (s *Server) handleShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/shares/")
+	if share, ok := s.shares.Get(id); ok && s.sessionAccess(share.SessionID) != AccessOwner {
+		http.Error(w, "share not found", http.StatusNotFound)
+		return
+	}
+	if !s.shares.Revoke(id) {
+		http.Error(w, "share not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("Share %s revoked by %s", id, clientDescription(r))
+	s.audit.Record(r, AuditShareRevoke, "", map[string]any{"share": id})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleShareView serves the read-only terminal for a share link
+// Path format: /s/{token}/...
+func (s *Server) handleShareView(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/s/"), "/", 2)
+	share, ok := s.shares.Lookup(parts[0])
+	if !ok {
+		http.Error(w, "Share link not found or expired", http.StatusNotFound)
+		return
+	}
+	session, ok := s.manager.GetSession(share.SessionID)
+	if !ok {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	// Viewers need the trailing slash so ttyd's relative asset and WebSocket URLs resolve
+	if len(parts) == 1 {
+		http.Redirect(w, r, parts[0]+"/", http.StatusFound)
+		return
+	}
+
+	// Disconnect viewers when the share is revoked or expires
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-share.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	s.proxyTerminal(w, r.WithContext(ctx), session, parts, true)
+}
+
+// copyViewerFrames forwards client WebSocket frames to ttyd, dropping input and
+// resize messages so a viewer cannot type into or resize the terminal.
+// Control frames and other ttyd messages (handshake, flow control) pass through.
+// Fragmented and empty data frames are always dropped: their message type is
+// not known from the frame alone, and ttyd's client never sends them.
+func copyViewerFrames(dst io.Writer, src *bufio.Reader) error {
+	for {
+		frame := make([]byte, 2, 14)
+		if _, err := io.ReadFull(src, frame); err != nil {
+			return err
+		}
+		fin := frame[0]&0x80 != 0
+		opcode := frame[0] & 0x0f
+		masked := frame[1]&0x80 != 0
+
+		length := uint64(frame[1] & 0x7f)
+		switch length {
+		case 126:
+			ext := make([]byte, 2)
+			if _, err := io.ReadFull(src, ext); err != nil {
+				return err
+			}
+			frame = append(frame, ext...)
+			length = uint64(binary.BigEndian.Uint16(ext))
+		case 127:
+			ext := make([]byte, 8)
+			if _, err := io.ReadFull(src, ext); err != nil {
+				return err
+			}
+			frame = append(frame, ext...)
+			length = binary.BigEndian.Uint64(ext)
+		}
+		if length > maxViewerFrameSize {
+			return fmt.Errorf("viewer frame too large (%d bytes)", length)
+		}
+
+		var mask []byte
+		if masked {
+			mask = make([]byte, 4)
+			if _, err := io.ReadFull(src, mask); err != nil {
+				return err
+			}
+			frame = append(frame, mask...)
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(src, payload); err != nil {
+			return err
+		}
+
+		drop := false
+		switch {
+		case opcode >= 0x8:
+			// Control frames (close, ping, pong)
+		case opcode == 0x0 || !fin || length == 0:
+			drop = true
+		default:
+			msgType := payload[0]
+			if masked {
+				msgType ^= mask[0]
+			}
+			drop = msgType == ttydMsgInput || msgType == ttydMsgResize
+		}
+		if drop {
+			continue
+		}
+
+		if _, err := dst.Write(append(frame, payload...)); err != nil {
+			return err
+		}
+	}
+}
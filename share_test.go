@@ -0,0 +1,135 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// wsFrame builds a masked client WebSocket frame
+func wsFrame(fin bool, opcode byte, payload string) []byte {
+	b0 := opcode
+	if fin {
+		b0 |= 0x80
+	}
+	frame := []byte{b0}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, mask...)
+	for i := range len(payload) {
+		frame = append(frame, payload[i]^mask[i%4])
+	}
+	return frame
+}
+
+func TestCopyViewerFrames(t *testing.T) {
+	const (
+		opCont  = 0x0
+		opText  = 0x1
+		opBin   = 0x2
+		opClose = 0x8
+		opPing  = 0x9
+	)
+	tests := []struct {
+		name   string
+		frames [][]byte
+		want   [][]byte // frames expected to reach ttyd
+	}{
+		{
+			name:   "input dropped",
+			frames: [][]byte{wsFrame(true, opBin, "0ls\r")},
+		},
+		{
+			name:   "resize dropped",
+			frames: [][]byte{wsFrame(true, opText, `1{"columns":80,"rows":24}`)},
+		},
+		{
+			name:   "handshake passes",
+			frames: [][]byte{wsFrame(true, opText, `{"AuthToken":""}`)},
+			want:   [][]byte{wsFrame(true, opText, `{"AuthToken":""}`)},
+		},
+		{
+			name:   "flow control passes",
+			frames: [][]byte{wsFrame(true, opBin, "2"), wsFrame(true, opBin, "3")},
+			want:   [][]byte{wsFrame(true, opBin, "2"), wsFrame(true, opBin, "3")},
+		},
+		{
+			name:   "control frames pass",
+			frames: [][]byte{wsFrame(true, opPing, "hi"), wsFrame(true, opClose, "")},
+			want:   [][]byte{wsFrame(true, opPing, "hi"), wsFrame(true, opClose, "")},
+		},
+		{
+			name:   "empty data frame dropped",
+			frames: [][]byte{wsFrame(true, opBin, "")},
+		},
+		{
+			name:   "fragmented input dropped",
+			frames: [][]byte{wsFrame(false, opBin, "0l"), wsFrame(true, opCont, "s\r")},
+		},
+		{
+			name:   "empty first fragment does not hide input",
+			frames: [][]byte{wsFrame(false, opBin, ""), wsFrame(false, opCont, "0rm"), wsFrame(true, opCont, " -rf ~\r")},
+		},
+		{
+			name:   "fragmented flow control dropped",
+			frames: [][]byte{wsFrame(false, opBin, "2"), wsFrame(true, opCont, "")},
+		},
+		{
+			name:   "stray continuation dropped",
+			frames: [][]byte{wsFrame(true, opCont, "0x")},
+		},
+		{
+			name:   "16-bit length",
+			frames: [][]byte{wsFrame(true, opBin, "0"+string(bytes.Repeat([]byte("a"), 300))), wsFrame(true, opBin, "2")},
+			want:   [][]byte{wsFrame(true, opBin, "2")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dst bytes.Buffer
+			src := bufio.NewReader(bytes.NewReader(bytes.Join(tt.frames, nil)))
+			if err := copyViewerFrames(&dst, src); err != io.EOF {
+				t.Fatalf("copyViewerFrames: %v, want EOF", err)
+			}
+			if want := bytes.Join(tt.want, nil); !bytes.Equal(dst.Bytes(), want) {
+				t.Errorf("forwarded %q, want %q", dst.Bytes(), want)
+			}
+		})
+	}
+}
+
+func TestCopyViewerFramesTooLarge(t *testing.T) {
+	frame := wsFrame(true, 0x2, string(make([]byte, maxViewerFrameSize+1)))
+	err := copyViewerFrames(io.Discard, bufio.NewReader(bytes.NewReader(frame)))
+	if err == nil || err == io.EOF {
+		t.Fatalf("copyViewerFrames: %v, want a size error", err)
+	}
+}
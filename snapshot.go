@@ -0,0 +1,567 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+// SECTION: SNAPSHOTS
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Snapshot storage limits per session; exceeding either starts a new full snapshot
+const (
+	maxSnapshotSegments = 100
+	snapshotAnchorLines = 5 // History lines matched to find where the next delta starts
+)
+
+// validSnapshotKey matches snapshot directory names (see snapshotKey)
+var validSnapshotKey = regexp.MustCompile(`^session-[0-9]{1,12}-[0-9]{1,20}$`)
+
+// ansiEscape matches the escape sequences capture-pane -e emits
+var ansiEscape = regexp.MustCompile(`\x1b(\[[0-9;:?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[()][0-9A-Za-z])`)
+
+// SnapshotInfo describes one stored snapshot segment. A full segment holds the
+// whole scrollback; the deltas after it hold only lines added since, so the
+// scrollback at any segment is its full segment plus the deltas up to it.
+type SnapshotInfo struct {
+	Seq   int       `json:"seq"`
+	Time  time.Time `json:"time"`
+	Full  bool      `json:"full"`
+	Lines int       `json:"lines"` // History lines in this segment
+	Bytes int       `json:"bytes"` // Compressed size
+}
+
+// snapshotIndex is a session's snapshots/<key>/index.json
+type snapshotIndex struct {
+	Segments     []SnapshotInfo `json:"segments"`
+	NextSeq      int            `json:"nextSeq"`
+	HistoryLines int            `json:"historyLines"`     // History lines in the last capture
+	Anchor       []string       `json:"anchor,omitempty"` // Hashes of its last history lines
+	ScreenHash   string         `json:"screenHash,omitempty"`
+}
+
+// segmentHeader starts each segment file, followed by the history and screen lines
+type segmentHeader struct {
+	History int `json:"history"`
+	Screen  int `json:"screen"`
+}
+
+// Snapshotter periodically captures each session's scrollback (-snapshot-interval)
+// into the state store, compressed and redacted, so it can be replayed when the
+// session is recreated
+type Snapshotter struct {
+	store    *StateStore
+	interval time.Duration
+	maxBytes int // Per-session cap on stored (compressed) bytes
+	mu       sync.Mutex
+}
+
+// NewSnapshotter returns a snapshotter, or nil when interval is 0
+func NewSnapshotter(store *StateStore, interval time.Duration, maxMB int) (*Snapshotter, error) {
+	if interval < 0 {
+		return nil, fmt.Errorf("interval must not be negative")
+	}
+	if interval == 0 {
+		return nil, nil
+	}
+	if interval < 5*time.Second {
+		return nil, fmt.Errorf("interval must be at least 5s")
+	}
+	if maxMB <= 0 {
+		return nil, fmt.Errorf("-snapshot-max-mb must be positive")
+	}
+	return &Snapshotter{store: store, interval: interval, maxBytes: maxMB << 20}, nil
+}
+
+// snapshotKey names a session's snapshot directory. Session IDs are reused
+// after a restart, so the creation time tells a saved session's snapshots
+// apart from those of a new session with the same ID.
+func snapshotKey(id string, created time.Time) string {
+	return fmt.Sprintf("%s-%d", id, created.Unix())
+}
+
+func snapshotDir(key string) string {
+	return filepath.Join("snapshots", key)
+}
+
+func snapshotSegmentFile(key string, seq int) string {
+	return filepath.Join(snapshotDir(key), strconv.Itoa(seq)+".gz")
+}
+
+// loadIndex reads a session's index (empty if it has no snapshots)
+func (sn *Snapshotter) loadIndex(key string) (*snapshotIndex, error) {
+	data, err := sn.store.ReadFile(filepath.Join(snapshotDir(key), "index.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return &snapshotIndex{NextSeq: 1}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var index snapshotIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+	return &index, nil
+}
+
+func (sn *Snapshotter) saveIndex(key string, index *snapshotIndex) error {
+	data, _ := json.Marshal(index)
+	return sn.store.WriteFile(filepath.Join(snapshotDir(key), "index.json"), data)
+}
+
+// List returns a session's snapshots, oldest first
+func (sn *Snapshotter) List(key string) ([]SnapshotInfo, error) {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+	index, err := sn.loadIndex(key)
+	if err != nil {
+		return nil, err
+	}
+	return index.Segments, nil
+}
+
+// captureLines runs tmux capture-pane and returns its redacted lines
+func captureLines(session *Session, args ...string) ([]string, error) {
+	var buf bytes.Buffer
+	rw := redactor.NewWriter(session.Owner, &buf)
+	cmd := exec.Command("tmux", append([]string{"-S", session.tmuxSocket, "capture-pane", "-p", "-e", "-J", "-t", session.tmuxSession}, args...)...)
+	cmd.Stdout = rw
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	rw.Close()
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"), nil
+}
+
+func lineHash(line string) string {
+	sum := sha256.Sum256([]byte(line))
+	return hex.EncodeToString(sum[:8])
+}
+
+// anchorOf returns the hashes of the last history lines
+func anchorOf(history []string) []string {
+	start := max(0, len(history)-snapshotAnchorLines)
+	anchor := make([]string, 0, len(history)-start)
+	for _, line := range history[start:] {
+		anchor = append(anchor, lineHash(line))
+	}
+	return anchor
+}
+
+// findAnchor returns the index just after the lines matching anchor in history,
+// trying where they were last time before searching from the end (-1 if absent)
+func findAnchor(history, anchor []string, expected int) int {
+	matches := func(end int) bool {
+		if end < len(anchor) || end > len(history) {
+			return false
+		}
+		for i, h := range anchor {
+			if lineHash(history[end-len(anchor)+i]) != h {
+				return false
+			}
+		}
+		return true
+	}
+	if matches(expected) {
+		return expected
+	}
+	for end := len(history); end >= len(anchor); end-- {
+		if matches(end) {
+			return end
+		}
+	}
+	return -1
+}
+
+// Take captures a session's scrollback, storing only lines added since the
+// last snapshot when it can. It returns nil when nothing changed.
+func (sn *Snapshotter) Take(session *Session) (*SnapshotInfo, error) {
+	key := snapshotKey(session.ID, session.CreatedAt)
+	if !validSnapshotKey.MatchString(key) {
+		return nil, fmt.Errorf("invalid session ID %q", session.ID)
+	}
+	out, err := exec.Command("tmux", "-S", session.tmuxSocket, "display-message", "-p", "-t", session.tmuxSession, "#{history_size}").Output()
+	if err != nil {
+		return nil, fmt.Errorf("tmux: %w", err)
+	}
+	var history []string
+	if size, _ := strconv.Atoi(strings.TrimSpace(string(out))); size > 0 {
+		if history, err = captureLines(session, "-S", "-", "-E", "-1"); err != nil {
+			return nil, fmt.Errorf("capture-pane: %w", err)
+		}
+	}
+	screen, err := captureLines(session)
+	if err != nil {
+		return nil, fmt.Errorf("capture-pane: %w", err)
+	}
+
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+	index, err := sn.loadIndex(key)
+	if err != nil {
+		return nil, err
+	}
+
+	screenHash := lineHash(strings.Join(screen, "\n"))
+	full := len(index.Segments) == 0 || len(index.Segments) >= maxSnapshotSegments
+	delta := history
+	if !full {
+		if end := findAnchor(history, index.Anchor, index.HistoryLines); len(index.Anchor) > 0 && end >= 0 {
+			delta = history[end:]
+		} else if len(index.Anchor) > 0 || len(history) < index.HistoryLines {
+			full = true // Cleared or scrolled past the anchor
+		}
+	}
+	if !full && len(delta) == 0 && screenHash == index.ScreenHash {
+		return nil, nil
+	}
+
+	total := 0
+	for _, seg := range index.Segments {
+		total += seg.Bytes
+	}
+	data := encodeSegment(delta, screen)
+	if !full && total+len(data) > sn.maxBytes {
+		full = true
+	}
+	if full {
+		delta = history
+		data = encodeSegment(delta, screen)
+		// Keep the most recent part of a scrollback too big for the cap
+		for len(data) > sn.maxBytes && len(delta) > 0 {
+			delta = delta[len(delta)/2:]
+			if len(delta) == 1 {
+				delta = nil
+			}
+			data = encodeSegment(delta, screen)
+		}
+	}
+
+	info := SnapshotInfo{Seq: index.NextSeq, Time: time.Now(), Full: full, Lines: len(delta), Bytes: len(data)}
+	if err := sn.store.WriteFile(snapshotSegmentFile(key, info.Seq), data); err != nil {
+		return nil, err
+	}
+	if full {
+		for _, seg := range index.Segments {
+			sn.store.Remove(snapshotSegmentFile(key, seg.Seq))
+		}
+		index.Segments = nil
+	}
+	index.Segments = append(index.Segments, info)
+	index.NextSeq++
+	index.HistoryLines = len(history)
+	index.Anchor = anchorOf(history)
+	index.ScreenHash = screenHash
+	if err := sn.saveIndex(key, index); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// encodeSegment gzips a segment header and its lines
+func encodeSegment(history, screen []string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	header, _ := json.Marshal(segmentHeader{History: len(history), Screen: len(screen)})
+	zw.Write(append(header, '\n'))
+	for _, line := range history {
+		io.WriteString(zw, line+"\n")
+	}
+	for _, line := range screen {
+		io.WriteString(zw, line+"\n")
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+// decodeSegment reverses encodeSegment
+func decodeSegment(data []byte) (history, screen []string, err error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	scanner := bufio.NewScanner(zr)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	var header segmentHeader
+	if !scanner.Scan() || json.Unmarshal(scanner.Bytes(), &header) != nil {
+		return nil, nil, fmt.Errorf("bad snapshot segment header")
+	}
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(lines) != header.History+header.Screen {
+		return nil, nil, fmt.Errorf("truncated snapshot segment")
+	}
+	return lines[:header.History], lines[header.History:], nil
+}
+
+// Scrollback reconstructs the scrollback and screen at snapshot seq (0 = latest)
+func (sn *Snapshotter) Scrollback(key string, seq int) ([]byte, *SnapshotInfo, error) {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+	index, err := sn.loadIndex(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	end := len(index.Segments) - 1
+	if seq != 0 {
+		end = -1
+		for i, seg := range index.Segments {
+			if seg.Seq == seq {
+				end = i
+			}
+		}
+	}
+	if end < 0 {
+		return nil, nil, fs.ErrNotExist
+	}
+
+	var out bytes.Buffer
+	var screen []string
+	for _, seg := range index.Segments[:end+1] {
+		data, err := sn.store.ReadFile(snapshotSegmentFile(key, seg.Seq))
+		if err != nil {
+			return nil, nil, err
+		}
+		var history []string
+		if history, screen, err = decodeSegment(data); err != nil {
+			return nil, nil, fmt.Errorf("snapshot %d: %w", seg.Seq, err)
+		}
+		for _, line := range history {
+			out.WriteString(line + "\n")
+		}
+	}
+	for _, line := range screen {
+		out.WriteString(line + "\n")
+	}
+	info := index.Segments[end]
+	return out.Bytes(), &info, nil
+}
+
+// Remove deletes a session's snapshots
+func (sn *Snapshotter) Remove(key string) {
+	if sn == nil || !validSnapshotKey.MatchString(key) {
+		return
+	}
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+	if err := os.RemoveAll(filepath.Join(sn.store.dir, snapshotDir(key))); err != nil {
+		log.Printf("Snapshots: removing %s: %v", key, err)
+	}
+}
+
+// Prune deletes the snapshots of sessions keep rejects
+func (sn *Snapshotter) Prune(keep map[string]bool) {
+	entries, err := os.ReadDir(filepath.Join(sn.store.dir, "snapshots"))
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !keep[entry.Name()] {
+			sn.Remove(entry.Name())
+		}
+	}
+}
+
+// TakeAll snapshots every session
+func (sn *Snapshotter) TakeAll(sm *SessionManager) {
+	for _, session := range sm.ListSessions() {
+		if _, err := sn.Take(session); err != nil {
+			log.Printf("Snapshots: session %s: %v", session.ID, err)
+		}
+	}
+}
+
+// run snapshots every session each interval
+func (sn *Snapshotter) run(sm *SessionManager) {
+	ticker := time.NewTicker(sn.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if sm.Closed() {
+			return
+		}
+		sn.TakeAll(sm)
+	}
+}
+
+// replayFile writes a session's latest scrollback to a temporary file for a
+// recreated session to print before its shell starts ("" if there is none)
+func (sn *Snapshotter) replayFile(key string) string {
+	if sn == nil || !validSnapshotKey.MatchString(key) {
+		return ""
+	}
+	data, info, err := sn.Scrollback(key, 0)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Snapshots: %s: %v", key, err)
+		}
+		return ""
+	}
+	f, err := os.CreateTemp("", "webmux-replay-*")
+	if err != nil {
+		log.Printf("Snapshots: %v", err)
+		return ""
+	}
+	defer f.Close()
+	// Drop the blank rows below the cursor so the new prompt follows the output
+	f.Write(bytes.TrimRight(data, " \n"))
+	f.WriteString("\n")
+	fmt.Fprintf(f, "\x1b[0m\x1b[2m--- restored from snapshot of %s ---\x1b[0m\n", info.Time.Local().Format("2006-01-02 15:04:05"))
+	return f.Name()
+}
+
+// handleSessionSnapshots lists, takes and returns scrollback snapshots
+// GET /api/sessions/{id}/snapshots, POST /api/sessions/{id}/snapshots,
+// GET /api/sessions/{id}/snapshots/{seq|latest}[?plain=1]
+func (s *Server) handleSessionSnapshots(w http.ResponseWriter, r *http.Request, sessionID string, rest []string) {
+	if s.snapshots == nil {
+		http.Error(w, "Snapshots are disabled (-snapshot-interval 0)", http.StatusNotFound)
+		return
+	}
+	// Saved sessions waiting to be recreated keep their snapshots
+	var key string
+	session, running := s.manager.GetSession(sessionID)
+	if running && s.sessionAccess(sessionID) != "" {
+		key = snapshotKey(session.ID, session.CreatedAt)
+	} else if !running {
+		for _, def := range s.resurrect.pendingFor(s.user) {
+			if def.ID == sessionID {
+				key = snapshotKey(def.ID, def.CreatedAt)
+			}
+		}
+	}
+	if key == "" {
+		http.Error(w, "session not found: "+sessionID, http.StatusNotFound)
+		return
+	}
+
+	if len(rest) > 0 && rest[0] != "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		seq := 0
+		if rest[0] != "latest" {
+			var err error
+			if seq, err = strconv.Atoi(rest[0]); err != nil || seq <= 0 {
+				http.Error(w, "Invalid snapshot: "+rest[0], http.StatusBadRequest)
+				return
+			}
+		}
+		data, info, err := s.snapshots.Scrollback(key, seq)
+		if errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, "snapshot not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if r.URL.Query().Get("plain") == "1" {
+			data = ansiEscape.ReplaceAll(data, nil)
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Snapshot-Seq", strconv.Itoa(info.Seq))
+		w.Header().Set("X-Snapshot-Time", info.Time.Format(time.RFC3339))
+		w.Write(data)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		snapshots, err := s.snapshots.List(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		total := 0
+		for _, seg := range snapshots {
+			total += seg.Bytes
+		}
+		if snapshots == nil {
+			snapshots = make([]SnapshotInfo, 0)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"snapshots": snapshots, "bytes": total, "maxBytes": s.snapshots.maxBytes})
+
+	case http.MethodPost:
+		if !running {
+			http.Error(w, "session is not running: "+sessionID, http.StatusConflict)
+			return
+		}
+		info, err := s.snapshots.Take(session)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if info == nil {
+			json.NewEncoder(w).Encode(map[string]any{"unchanged": true})
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(info)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// pruneSnapshots deletes the snapshots of sessions that are neither running
+// nor saved to be recreated
+func (s *Server) pruneSnapshots() {
+	if s.snapshots == nil || s.manager.Closed() {
+		return
+	}
+	keep := make(map[string]bool)
+	for _, session := range s.manager.ListSessions() {
+		keep[snapshotKey(session.ID, session.CreatedAt)] = true
+	}
+	if r := s.resurrect; r != nil {
+		r.mu.Lock()
+		for _, defs := range r.pending {
+			for _, def := range defs {
+				keep[snapshotKey(def.ID, def.CreatedAt)] = true
+			}
+		}
+		r.mu.Unlock()
+	}
+	s.snapshots.Prune(keep)
+}
@@ -0,0 +1,612 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SECTION: STATE STORE
+
+// State encryption modes (-encrypt-state)
+const (
+	StateEncryptionOff        = "off"
+	StateEncryptionKeyFile    = "keyfile"
+	StateEncryptionPassphrase = "passphrase"
+)
+
+const (
+	// Environment variables holding the state passphrase, and the new and previous
+	// ones for -re-encrypt (the previous one only after an interrupted rotation)
+	statePassphraseEnv    = "WEBMUX_STATE_PASSPHRASE"
+	newStatePassphraseEnv = "WEBMUX_NEW_STATE_PASSPHRASE"
+	oldStatePassphraseEnv = "WEBMUX_OLD_STATE_PASSPHRASE"
+	// Encrypted file header: magic, format version, key ID, then the GCM nonce
+	stateMagic     = "WMXS\x01"
+	stateKeyIDSize = 8
+	// Sealed with each key so a wrong passphrase or damaged key is reported as such
+	stateKeyCheck = "webmux-state-key"
+)
+
+// stateKeyEntry is one key in the keyring file. Key file mode stores the key
+// itself; passphrase mode stores only the salt it is derived with.
+type stateKeyEntry struct {
+	ID         string    `json:"id"`
+	Key        string    `json:"key,omitempty"`        // base64 AES-256 key (keyfile)
+	Salt       string    `json:"salt,omitempty"`       // base64 PBKDF2 salt (passphrase)
+	Iterations int       `json:"iterations,omitempty"` // PBKDF2 iterations (passphrase)
+	Check      string    `json:"check"`                // base64 nonce+sealed stateKeyCheck
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// stateKeyFile is the on-disk keyring. Older keys are kept while -re-encrypt runs
+// so that an interrupted rotation leaves every file readable.
+type stateKeyFile struct {
+	Mode    string          `json:"mode"`
+	Current string          `json:"current"`
+	Keys    []stateKeyEntry `json:"keys"`
+}
+
+// stateKeyring holds the usable keys by ID
+type stateKeyring struct {
+	file    stateKeyFile
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+// StateStore reads and writes persisted state (scratch pads, clipboard history,
+// UI state, captured output, scrollback snapshots) under $XDG_STATE_HOME/webmux,
+// encrypting each file with AES-256-GCM when -encrypt-state is on. JSON-lines
+// logs in the directory are append-only streams and are not managed by the store.
+type StateStore struct {
+	dir  string
+	keys *stateKeyring // nil = plaintext
+}
+
+// stateDir returns the directory holding persisted state
+func stateDir() string {
+	return filepath.Join(xdgStateHome(), "webmux")
+}
+
+// stateKeyPath returns the path to the state keyring
+func stateKeyPath() string {
+	return filepath.Join(xdgConfigHome(), "webmux", "state-key.json")
+}
+
+// validStateEncryption reports whether mode is a known -encrypt-state mode
+func validStateEncryption(mode string) bool {
+	switch mode {
+	case StateEncryptionOff, StateEncryptionKeyFile, StateEncryptionPassphrase:
+		return true
+	}
+	return false
+}
+
+// OpenStateStore opens the state directory for mode, creating the keyring on first
+// use, and checks that every stored file can be read. It refuses to open a store
+// with damaged, undecryptable or wrongly (un)encrypted files.
+func OpenStateStore(mode string) (*StateStore, error) {
+	keys, err := loadStateKeyring(mode, true)
+	if err != nil {
+		return nil, err
+	}
+	st := &StateStore{dir: stateDir(), keys: keys}
+	if err := st.Verify(); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// Encrypted reports whether files are encrypted
+func (st *StateStore) Encrypted() bool {
+	return st.keys != nil
+}
+
+// ReadFile returns the contents of a stored file, decrypting it if needed.
+// Missing files return an error satisfying errors.Is(err, fs.ErrNotExist).
+func (st *StateStore) ReadFile(name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(st.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	return st.open(name, data)
+}
+
+// WriteFile atomically replaces a stored file, encrypting it if needed
+func (st *StateStore) WriteFile(name string, data []byte) error {
+	if st.keys != nil {
+		var err error
+		if data, err = st.keys.seal(name, data); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(filepath.Join(st.dir, name), data, 0600)
+}
+
+// Remove deletes a stored file (missing files are not an error)
+func (st *StateStore) Remove(name string) error {
+	if err := os.Remove(filepath.Join(st.dir, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// open decodes a file read from disk
+func (st *StateStore) open(name string, data []byte) ([]byte, error) {
+	encrypted := bytes.HasPrefix(data, []byte(stateMagic))
+	switch {
+	case st.keys == nil && encrypted:
+		return nil, fmt.Errorf("%s is encrypted; start with -encrypt-state", name)
+	case st.keys != nil && !encrypted:
+		return nil, fmt.Errorf("%s is not encrypted; run 'webmux -encrypt-state=%s -re-encrypt'", name, st.keys.file.Mode)
+	case st.keys == nil:
+		return data, nil
+	}
+	return st.keys.open(name, data)
+}
+
+// files returns the names (relative to the state dir) of the files managed by the store
+func (st *StateStore) files() ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(st.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == st.dir {
+				return fs.SkipDir
+			}
+			return err
+		}
+		// Skip append-only logs and leftovers of interrupted atomic writes
+		if d.IsDir() || !d.Type().IsRegular() || strings.HasSuffix(d.Name(), ".jsonl") || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(st.dir, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, rel)
+		return nil
+	})
+	return names, err
+}
+
+// Verify reads every stored file and reports all that cannot be decoded
+func (st *StateStore) Verify() error {
+	names, err := st.files()
+	if err != nil {
+		return err
+	}
+	var problems []string
+	for _, name := range names {
+		if _, err := st.ReadFile(name); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("unreadable state in %s:\n  %s", st.dir, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it into place
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// newAEAD returns AES-256-GCM for a raw key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// header returns the file header for a key ID
+func stateHeader(id string) ([]byte, error) {
+	raw, err := hex.DecodeString(id)
+	if err != nil || len(raw) != stateKeyIDSize {
+		return nil, fmt.Errorf("invalid state key ID %q", id)
+	}
+	return append([]byte(stateMagic), raw...), nil
+}
+
+// seal encrypts a file with the current key. The header and file name are
+// authenticated so files cannot be swapped for one another.
+func (k *stateKeyring) seal(name string, plaintext []byte) ([]byte, error) {
+	aead := k.aeads[k.current]
+	header, err := stateHeader(k.current)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append(header, nonce...)
+	return aead.Seal(out, nonce, plaintext, stateAAD(header, name)), nil
+}
+
+// open decrypts a file written by seal
+func (k *stateKeyring) open(name string, data []byte) ([]byte, error) {
+	headerSize := len(stateMagic) + stateKeyIDSize
+	if len(data) < headerSize {
+		return nil, fmt.Errorf("%s is corrupt: truncated header", name)
+	}
+	header := data[:headerSize]
+	id := hex.EncodeToString(header[len(stateMagic):])
+	aead, ok := k.aeads[id]
+	if !ok {
+		return nil, fmt.Errorf("%s is encrypted with key %s, which is not in %s", name, id, stateKeyPath())
+	}
+	rest := data[headerSize:]
+	if len(rest) < aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("%s is corrupt: truncated", name)
+	}
+	nonce, ciphertext := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, stateAAD(header, name))
+	if err != nil {
+		return nil, fmt.Errorf("%s is corrupt or was not encrypted with key %s", name, id)
+	}
+	return plaintext, nil
+}
+
+// stateAAD binds a ciphertext to its header and file name
+func stateAAD(header []byte, name string) []byte {
+	return append(bytes.Clone(header), filepath.ToSlash(name)...)
+}
+
+// newStateKeyEntry creates a key. In passphrase mode the key is derived from
+// passphrase with a fresh salt; otherwise it is random.
+func newStateKeyEntry(mode, passphrase string) (stateKeyEntry, cipher.AEAD, error) {
+	entry := stateKeyEntry{ID: randomToken(stateKeyIDSize), CreatedAt: time.Now().UTC()}
+	var key []byte
+	if mode == StateEncryptionPassphrase {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return entry, nil, err
+		}
+		entry.Salt = base64.StdEncoding.EncodeToString(salt)
+		entry.Iterations = pbkdf2Iterations
+		var err error
+		if key, err = pbkdf2.Key(sha256.New, passphrase, salt, pbkdf2Iterations, 32); err != nil {
+			return entry, nil, err
+		}
+	} else {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return entry, nil, err
+		}
+		entry.Key = base64.StdEncoding.EncodeToString(key)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return entry, nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return entry, nil, err
+	}
+	check := aead.Seal(bytes.Clone(nonce), nonce, []byte(stateKeyCheck), []byte(entry.ID))
+	entry.Check = base64.StdEncoding.EncodeToString(check)
+	return entry, aead, nil
+}
+
+// usesPassphrase reports whether the key is derived from a passphrase
+func (e stateKeyEntry) usesPassphrase() bool {
+	return e.Salt != ""
+}
+
+// unlock returns the cipher for a stored key, checking it against its check value
+func (e stateKeyEntry) unlock(passphrase string) (cipher.AEAD, error) {
+	var key []byte
+	if e.Salt != "" {
+		salt, err := base64.StdEncoding.DecodeString(e.Salt)
+		if err != nil || e.Iterations <= 0 {
+			return nil, fmt.Errorf("key %s: invalid salt", e.ID)
+		}
+		if key, err = pbkdf2.Key(sha256.New, passphrase, salt, e.Iterations, 32); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if key, err = base64.StdEncoding.DecodeString(e.Key); err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("key %s: invalid key", e.ID)
+		}
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	check, err := base64.StdEncoding.DecodeString(e.Check)
+	if err != nil || len(check) < aead.NonceSize() {
+		return nil, fmt.Errorf("key %s: invalid check value", e.ID)
+	}
+	nonce := check[:aead.NonceSize()]
+	if plain, err := aead.Open(nil, nonce, check[aead.NonceSize():], []byte(e.ID)); err != nil || string(plain) != stateKeyCheck {
+		if e.Salt != "" {
+			return nil, fmt.Errorf("wrong passphrase for state key %s", e.ID)
+		}
+		return nil, fmt.Errorf("state key %s is damaged", e.ID)
+	}
+	return aead, nil
+}
+
+// statePassphrase returns the passphrase from env, or prompts for it on a terminal
+func statePassphrase(env, prompt string, confirm bool) (string, error) {
+	if passphrase := os.Getenv(env); passphrase != "" {
+		return passphrase, nil
+	}
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return "", fmt.Errorf("state passphrase required: set %s", env)
+	}
+	passphrase, err := readPassword(prompt)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	if confirm {
+		if len(passphrase) < minPasswordLength {
+			return "", fmt.Errorf("passphrase must be at least %d characters", minPasswordLength)
+		}
+		again, err := readPassword("Confirm passphrase: ")
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		if again != passphrase {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+	}
+	return passphrase, nil
+}
+
+// readStateKeyFile loads the keyring file (nil if there is none)
+func readStateKeyFile() (*stateKeyFile, error) {
+	data, err := os.ReadFile(stateKeyPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file stateKeyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid state key file %s: %w", stateKeyPath(), err)
+	}
+	if !validStateEncryption(file.Mode) || file.Mode == StateEncryptionOff || len(file.Keys) == 0 {
+		return nil, fmt.Errorf("invalid state key file %s: no keys", stateKeyPath())
+	}
+	return &file, nil
+}
+
+// saveStateKeyFile writes the keyring with owner-only permissions
+func saveStateKeyFile(file *stateKeyFile) error {
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(stateKeyPath(), data, 0600)
+}
+
+// unlockStateKeyFile unlocks every key in file. Keys other than the current one
+// that cannot be unlocked (e.g. derived from an earlier passphrase) are skipped;
+// files encrypted with them are reported when read.
+func unlockStateKeyFile(file *stateKeyFile, passphrase string) (*stateKeyring, error) {
+	keys := &stateKeyring{file: *file, current: file.Current, aeads: make(map[string]cipher.AEAD)}
+	for _, entry := range file.Keys {
+		aead, err := entry.unlock(passphrase)
+		if err != nil {
+			if entry.ID == file.Current {
+				return nil, err
+			}
+			log.Printf("Skipping state key %s: %v", entry.ID, err)
+			continue
+		}
+		keys.aeads[entry.ID] = aead
+	}
+	if _, ok := keys.aeads[file.Current]; !ok {
+		return nil, fmt.Errorf("state key file %s has no current key", stateKeyPath())
+	}
+	return keys, nil
+}
+
+// loadStateKeyring returns the keyring for mode (nil when off). With create, a
+// missing keyring is generated.
+func loadStateKeyring(mode string, create bool) (*stateKeyring, error) {
+	file, err := readStateKeyFile()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case file == nil && mode == StateEncryptionOff:
+		return nil, nil
+	case file != nil && mode == StateEncryptionOff:
+		return nil, fmt.Errorf("state is encrypted (%s); start with -encrypt-state=%s, or decrypt it with 'webmux -encrypt-state=off -re-encrypt'",
+			stateKeyPath(), file.Mode)
+	case file != nil && file.Mode != mode:
+		return nil, fmt.Errorf("state is encrypted with a %s; start with -encrypt-state=%s, or switch with 'webmux -encrypt-state=%s -re-encrypt'",
+			file.Mode, file.Mode, mode)
+	case file == nil && !create:
+		return nil, nil
+	}
+
+	var passphrase string
+	if mode == StateEncryptionPassphrase {
+		if passphrase, err = statePassphrase(statePassphraseEnv, "State passphrase: ", file == nil); err != nil {
+			return nil, err
+		}
+	}
+	if file != nil {
+		return unlockStateKeyFile(file, passphrase)
+	}
+
+	entry, aead, err := newStateKeyEntry(mode, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	file = &stateKeyFile{Mode: mode, Current: entry.ID, Keys: []stateKeyEntry{entry}}
+	if err := saveStateKeyFile(file); err != nil {
+		return nil, err
+	}
+	log.Printf("Created state key %s in %s", entry.ID, stateKeyPath())
+	return &stateKeyring{file: *file, current: entry.ID, aeads: map[string]cipher.AEAD{entry.ID: aead}}, nil
+}
+
+// runReEncrypt rewrites every stored file for mode with a new key (or as plaintext
+// when mode is off), then retires the old keys. It is also how encryption is turned
+// on or off and how the passphrase is changed.
+func runReEncrypt(mode string) error {
+	file, err := readStateKeyFile()
+	if err != nil {
+		return err
+	}
+
+	// Read everything with the current keyring
+	old := &StateStore{dir: stateDir()}
+	if file != nil {
+		// An interrupted switch leaves keys of both modes in the keyring
+		var passphrase string
+		if slices.ContainsFunc(file.Keys, stateKeyEntry.usesPassphrase) {
+			if passphrase, err = statePassphrase(statePassphraseEnv, "Current state passphrase: ", false); err != nil {
+				return err
+			}
+		}
+		if old.keys, err = unlockStateKeyFile(file, passphrase); err != nil {
+			return err
+		}
+		// ... and an interrupted passphrase change, keys under the previous passphrase
+		if slices.ContainsFunc(file.Keys, func(e stateKeyEntry) bool { return old.keys.aeads[e.ID] == nil && e.usesPassphrase() }) {
+			previous, err := statePassphrase(oldStatePassphraseEnv, "Previous state passphrase: ", false)
+			if err != nil {
+				return err
+			}
+			for _, entry := range file.Keys {
+				if old.keys.aeads[entry.ID] == nil && entry.usesPassphrase() {
+					if aead, err := entry.unlock(previous); err == nil {
+						old.keys.aeads[entry.ID] = aead
+					}
+				}
+			}
+		}
+	}
+	names, err := old.files()
+	if err != nil {
+		return err
+	}
+	contents := make(map[string][]byte, len(names))
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(old.dir, name))
+		if err != nil {
+			return err
+		}
+		// Plaintext files left from before encryption was turned on are taken as is
+		if old.keys != nil && !bytes.HasPrefix(data, []byte(stateMagic)) {
+			contents[name] = data
+			continue
+		}
+		if contents[name], err = old.open(name, data); err != nil {
+			return fmt.Errorf("cannot re-encrypt: %w", err)
+		}
+	}
+
+	// Add the new key alongside all the old ones, whatever their mode, so an
+	// interruption leaves every file readable; the keyring with only the new key
+	// is committed once every file has been rewritten
+	next := &StateStore{dir: old.dir}
+	if mode != StateEncryptionOff {
+		var passphrase string
+		if mode == StateEncryptionPassphrase {
+			if passphrase, err = statePassphrase(newStatePassphraseEnv, "New state passphrase: ", true); err != nil {
+				return err
+			}
+		}
+		entry, aead, err := newStateKeyEntry(mode, passphrase)
+		if err != nil {
+			return err
+		}
+		pending := &stateKeyFile{Mode: mode, Current: entry.ID, Keys: []stateKeyEntry{entry}}
+		if file != nil {
+			pending.Keys = append(pending.Keys, file.Keys...)
+		}
+		if err := saveStateKeyFile(pending); err != nil {
+			return err
+		}
+		next.keys = &stateKeyring{file: *pending, current: entry.ID, aeads: map[string]cipher.AEAD{entry.ID: aead}}
+	}
+
+	for _, name := range names {
+		if err := next.WriteFile(name, contents[name]); err != nil {
+			return fmt.Errorf("failed to rewrite %s: %w", name, err)
+		}
+	}
+
+	// Retire the old keys
+	if next.keys == nil {
+		if err := os.Remove(stateKeyPath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Decrypted %d files in %s\n", len(names), old.dir)
+		return nil
+	}
+	final := next.keys.file
+	final.Keys = final.Keys[:1]
+	if err := saveStateKeyFile(&final); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Re-encrypted %d files in %s with key %s (%s)\n", len(names), old.dir, final.Current, mode)
+	return nil
+}
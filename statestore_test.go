@@ -0,0 +1,216 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setStateDirs points the state directory and keyring at fresh temporary directories
+func setStateDirs(t *testing.T) {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+}
+
+// writeStateFiles stores files with st and returns them
+func writeStateFiles(t *testing.T, st *StateStore) map[string][]byte {
+	t.Helper()
+	files := map[string][]byte{
+		"scratch.json":           []byte(`{"text":"remember me"}`),
+		"captures/session-1.txt": []byte("$ make\nok\n"),
+		"empty":                  {},
+	}
+	for name, data := range files {
+		if err := st.WriteFile(name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+// checkStateFiles opens the store for mode and checks it holds files
+func checkStateFiles(t *testing.T, mode string, files map[string][]byte) {
+	t.Helper()
+	st, err := OpenStateStore(mode)
+	if err != nil {
+		t.Fatalf("OpenStateStore(%s): %v", mode, err)
+	}
+	for name, want := range files {
+		raw, err := os.ReadFile(filepath.Join(stateDir(), name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if encrypted := bytes.HasPrefix(raw, []byte(stateMagic)); encrypted != (mode != StateEncryptionOff) {
+			t.Errorf("%s: encrypted = %v with mode %s", name, encrypted, mode)
+		}
+		got, err := st.ReadFile(name)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("ReadFile(%s) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+}
+
+func TestStateStoreEncryptDecrypt(t *testing.T) {
+	setStateDirs(t)
+	st, err := OpenStateStore(StateEncryptionKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := writeStateFiles(t, st)
+	raw, err := os.ReadFile(filepath.Join(stateDir(), "scratch.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("remember me")) {
+		t.Error("plaintext found in encrypted file")
+	}
+	checkStateFiles(t, StateEncryptionKeyFile, files)
+
+	// Files are bound to their name and cannot be altered or swapped
+	if err := os.WriteFile(filepath.Join(stateDir(), "other.json"), raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.ReadFile("other.json"); err == nil {
+		t.Error("file renamed to another name was accepted")
+	}
+	raw[len(raw)-1] ^= 1
+	if err := os.WriteFile(filepath.Join(stateDir(), "scratch.json"), raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.ReadFile("scratch.json"); err == nil {
+		t.Error("altered file was accepted")
+	}
+	if _, err := OpenStateStore(StateEncryptionKeyFile); err == nil {
+		t.Error("OpenStateStore accepted a store with damaged files")
+	}
+}
+
+func TestStateStoreModeMismatch(t *testing.T) {
+	setStateDirs(t)
+	plain, err := OpenStateStore(StateEncryptionOff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeStateFiles(t, plain)
+	// Plaintext files are refused once encryption is on, until re-encrypted
+	if _, err := OpenStateStore(StateEncryptionKeyFile); err == nil {
+		t.Error("encrypted store opened over plaintext files")
+	}
+	// ... and an existing keyring cannot be ignored or switched implicitly
+	if _, err := OpenStateStore(StateEncryptionOff); err == nil {
+		t.Error("plaintext store opened with a keyring present")
+	}
+	t.Setenv(statePassphraseEnv, "correct horse battery")
+	if _, err := OpenStateStore(StateEncryptionPassphrase); err == nil {
+		t.Error("passphrase store opened with a key file keyring")
+	}
+}
+
+func TestRunReEncrypt(t *testing.T) {
+	setStateDirs(t)
+	plain, err := OpenStateStore(StateEncryptionOff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := writeStateFiles(t, plain)
+
+	// Turn encryption on, rotate the key, switch to a passphrase and back off
+	var previous string
+	for _, mode := range []string{StateEncryptionKeyFile, StateEncryptionKeyFile, StateEncryptionPassphrase, StateEncryptionOff} {
+		if mode == StateEncryptionPassphrase {
+			t.Setenv(newStatePassphraseEnv, "correct horse battery")
+		}
+		if err := runReEncrypt(mode); err != nil {
+			t.Fatalf("re-encrypt to %s: %v", mode, err)
+		}
+		if mode == StateEncryptionPassphrase {
+			t.Setenv(statePassphraseEnv, "correct horse battery")
+		}
+		checkStateFiles(t, mode, files)
+
+		file, err := readStateKeyFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode == StateEncryptionOff {
+			if file != nil {
+				t.Error("key file kept after decrypting")
+			}
+			continue
+		}
+		if file == nil || len(file.Keys) != 1 || file.Current == previous {
+			t.Fatalf("after re-encrypting to %s: key file %+v, want one new key", mode, file)
+		}
+		previous = file.Current
+	}
+}
+
+func TestRunReEncryptResumesInterrupted(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string // the interrupted rotation
+	}{
+		{"rotate key file", StateEncryptionKeyFile, StateEncryptionKeyFile},
+		{"switch to passphrase", StateEncryptionKeyFile, StateEncryptionPassphrase},
+		{"change passphrase", StateEncryptionPassphrase, StateEncryptionPassphrase},
+		{"switch to key file", StateEncryptionPassphrase, StateEncryptionKeyFile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setStateDirs(t)
+			t.Setenv(statePassphraseEnv, "first passphrase")
+			st, err := OpenStateStore(tt.from)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files := writeStateFiles(t, st)
+
+			// Stop a rotation after the pending keyring is saved and one file is rewritten
+			entry, aead, err := newStateKeyEntry(tt.to, "second passphrase")
+			if err != nil {
+				t.Fatal(err)
+			}
+			pending := &stateKeyFile{Mode: tt.to, Current: entry.ID, Keys: append([]stateKeyEntry{entry}, st.keys.file.Keys...)}
+			if err := saveStateKeyFile(pending); err != nil {
+				t.Fatal(err)
+			}
+			next := &StateStore{dir: st.dir, keys: &stateKeyring{file: *pending, current: entry.ID, aeads: map[string]cipher.AEAD{entry.ID: aead}}}
+			if err := next.WriteFile("scratch.json", files["scratch.json"]); err != nil {
+				t.Fatal(err)
+			}
+
+			// Running it again finishes the job, given the passphrases involved
+			t.Setenv(statePassphraseEnv, "second passphrase")
+			t.Setenv(oldStatePassphraseEnv, "first passphrase")
+			t.Setenv(newStatePassphraseEnv, "third passphrase")
+			if err := runReEncrypt(tt.to); err != nil {
+				t.Fatalf("resuming: %v", err)
+			}
+			t.Setenv(statePassphraseEnv, "third passphrase")
+			checkStateFiles(t, tt.to, files)
+			if file, err := readStateKeyFile(); err != nil || len(file.Keys) != 1 {
+				t.Errorf("key file after resuming: %+v, %v; want one key", file, err)
+			}
+		})
+	}
+}
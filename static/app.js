@@ -18,6 +18,20 @@
 
 // SECTION: CORE
 
+// Echo the CSRF cookie in a header on state-changing requests to the server
+const nativeFetch = window.fetch.bind(window);
+window.fetch = (input, init = {}) => {
+    const method = (init.method || (input instanceof Request ? input.method : 'GET')).toUpperCase();
+    const url = new URL(input instanceof Request ? input.url : input, window.location.href);
+    const token = document.cookie.match(/(?:^|;\s*)webmux_csrf=([^;]+)/);
+    if (token && url.origin === window.location.origin && !['GET', 'HEAD', 'OPTIONS'].includes(method)) {
+        const headers = new Headers(init.headers || (input instanceof Request ? input.headers : undefined));
+        headers.set('X-CSRF-Token', token[1]);
+        init = { ...init, headers };
+    }
+    return nativeFetch(input, init);
+};
+
 // Terminal Multiplexer Application with Split Pane Support
 
 class TerminalMultiplexer {
@@ -132,6 +146,7 @@ class TerminalMultiplexer {
             await this.loadServerInfo();
             await this.loadUIState(); // Load saved UI state from server before loading sessions
             await this.loadSessions();
+            this.offerResurrect();
         }
 
         if (this.groups.size === 0) {
@@ -628,6 +643,11 @@ class TerminalMultiplexer {
     }
 
     async saveUIState() {
+        // The server rejects changes in read-only mode; layout stays local to this tab
+        if (this.serverInfo?.readOnly) return;
+        // Don't overwrite groups the server restored while we reload
+        if (this.stateSaveSuspended) return;
+
         const state = {
             groupOrder: this.groupOrder,
             groups: Array.from(this.groups.entries()).map(([id, g]) => ({
@@ -642,16 +662,22 @@ class TerminalMultiplexer {
             activeGroupId: this.activeGroupId,
             sidebarCollapsed: this.sidebar?.classList.contains('collapsed') || false,
             customNames: Array.from(this.customNames),
-            groupCounter: this.groupCounter
+            groupCounter: this.groupCounter,
+            revision: this.uiRevision || 0
         };
 
         try {
             // Save to server (authoritative source)
-            await fetch(this.url('/api/ui-state'), {
+            const response = await fetch(this.url('/api/ui-state'), {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify(state)
             });
+            // The server changed the layout (e.g. applied a workspace); show that instead
+            if (response.status === 409) {
+                await this.loadUIState();
+                await this.loadSessions();
+            }
         } catch (e) {
             console.warn('Failed to save UI state to server:', e);
         }
@@ -710,6 +736,7 @@ class TerminalMultiplexer {
 
             // Restore state
             this.savedState = state;
+            this.uiRevision = Number.isSafeInteger(state.revision) ? state.revision : 0;
             this.sidebarCollapsed = !!state.sidebarCollapsed;
             this.groupCounter = state.groupCounter;
             this.customNames = new Set(Array.isArray(state.customNames) ? state.customNames.filter(n => typeof n === 'string') : []);
@@ -718,10 +745,35 @@ class TerminalMultiplexer {
         }
     }
 
+    // Return to the layout before the last group, split or rename change
+    async undoLayout() {
+        if (this.serverInfo?.readOnly) return;
+        // Keep this tab from saving its current layout over the restored one
+        this.stateSaveSuspended = true;
+        try {
+            const resp = await fetch(this.url('/api/ui-state/undo'), { method: 'POST' });
+            if (!resp.ok) {
+                this.stateSaveSuspended = false;
+                this.toast((await resp.text()).trim() || 'Nothing to undo');
+                return;
+            }
+            location.reload();
+        } catch (err) {
+            this.stateSaveSuspended = false;
+            this.toastError('Failed to undo layout change');
+        }
+    }
+
     async checkSessionHealth() {
         try {
             const response = await fetch(this.url('/api/sessions'));
 
+            // Login expired or revoked - go back to the login page
+            if (response.status === 401) {
+                window.location.href = this.url('/login.html');
+                return;
+            }
+
             // Update connection status on successful response
             if (!this.serverConnected) {
                 this.setServerConnected(true);
@@ -880,6 +932,7 @@ class TerminalMultiplexer {
         this.goPathBtn = document.getElementById('go-path');
         this.fileList = document.getElementById('file-list');
         this.fileCountEl = document.getElementById('file-count');
+        this.projectBar = document.getElementById('project-bar');
         this.fileHeader = document.querySelector('.file-header');
 
         // File browser state
@@ -931,6 +984,9 @@ class TerminalMultiplexer {
         this.keybindsModal = document.getElementById('keybinds-modal');
         this.openKeybindsBtn = document.getElementById('open-keybinds');
 
+        // Logout button (only shown when login is required)
+        this.logoutBtn = document.getElementById('logout');
+
         // Logs modal
         this.logsModal = document.getElementById('logs-modal');
         this.openLogsBtn = document.getElementById('open-logs');
@@ -1002,6 +1058,11 @@ class TerminalMultiplexer {
             this.openModal(this.keybindsModal);
         });
 
+        // Logout button
+        this.logoutBtn.addEventListener('click', () => {
+            this.logout();
+        });
+
         // Logs button
         this.openLogsBtn.addEventListener('click', () => {
             this.openLogsModal();
@@ -1039,6 +1100,11 @@ class TerminalMultiplexer {
                 e.preventDefault();
                 this.openLogsModal();
             }
+            // Ctrl+Shift+Z to undo the last layout change
+            if (e.ctrlKey && e.shiftKey && (e.key === 'Z' || e.key === 'z')) {
+                e.preventDefault();
+                this.undoLayout();
+            }
         });
 
         // Settings modal events
@@ -1058,9 +1124,18 @@ class TerminalMultiplexer {
 
                 // Show/hide theme import/export buttons based on tab
                 this.updateThemeActionsVisibility(tabName);
+
+                if (tabName === 'security') {
+                    this.loadTOTPStatus();
+                }
             });
         });
 
+        // Two-factor enrollment
+        document.getElementById('totp-setup-btn').addEventListener('click', () => this.startTOTPSetup());
+        document.getElementById('totp-confirm-btn').addEventListener('click', () => this.confirmTOTPSetup());
+        document.getElementById('totp-disable-btn').addEventListener('click', () => this.disableTOTP());
+
         // Keybar settings event listeners
         const addKeybarBtn = document.getElementById('add-keybar-btn');
         if (addKeybarBtn) {
@@ -1239,7 +1314,10 @@ class TerminalMultiplexer {
         document.addEventListener('keydown', (e) => {
             if (e.ctrlKey && e.shiftKey && (e.key === 'T' || e.key === 't')) {
                 e.preventDefault();
-                this.createNewSessionAndGroup();
+                // Open it where the focused terminal is
+                const group = this.groups.get(this.activeGroupId);
+                const source = group?.sessionIds.includes(this.focusedSessionId) ? this.focusedSessionId : group?.sessionIds[0];
+                this.createNewSessionAndGroup(source ? { cloneFrom: source, cloneEnv: true } : {});
             }
 
             if (e.key === 'Escape') {
@@ -1491,12 +1569,16 @@ class TerminalMultiplexer {
         }
     }
 
-    async createNewSessionAndGroup() {
+    async createNewSessionAndGroup(options = {}) {
         if (!this.serverConnected) {
             this.toastError('Cannot create terminal: server disconnected');
             return;
         }
-        const session = await this.createSession();
+        if (this.serverInfo?.readOnly) {
+            this.toastWarning('Server is in read-only mode');
+            return;
+        }
+        const session = await this.createSession('', options);
         if (session) {
             const group = this.createGroup([session.id]);
             this.addGroupToSidebar(group);
@@ -1505,12 +1587,12 @@ class TerminalMultiplexer {
         }
     }
 
-    async createSession(name = '') {
+    async createSession(name = '', options = {}) {
         try {
             const response = await fetch(this.url('/api/sessions'), {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
-                body: JSON.stringify({ name })
+                body: JSON.stringify({ name, ...options })
             });
 
             if (!response.ok) throw new Error('Failed to create session');
@@ -3552,6 +3634,7 @@ class TerminalMultiplexer {
             this.currentFiles = result.files;
             this.updateSortIndicators();
             this.renderFileList();
+            this.updateProjectBar(result.project ? result.path : null);
         } catch (error) {
             console.error('Failed to browse:', error);
             this.fileList.innerHTML = `<p style="padding: 20px; color: var(--danger);">Failed to load directory</p>`;
@@ -3559,6 +3642,109 @@ class TerminalMultiplexer {
         }
     }
 
+    // Offer the sessions and tasks of a directory's .webmux.json
+    async updateProjectBar(dir) {
+        this.projectBar.classList.add('hidden');
+        this.projectBar.innerHTML = '';
+        if (!dir || this.serverInfo?.readOnly) return;
+        let project;
+        try {
+            const resp = await fetch(this.url(`/api/project?path=${encodeURIComponent(dir)}`));
+            if (!resp.ok) return;
+            project = await resp.json();
+        } catch (err) {
+            return;
+        }
+        if (this.currentPathInput.value !== dir) return; // Navigated away meanwhile
+
+        const manifest = project.manifest;
+        const items = [...(manifest.sessions || []), ...(manifest.tasks || [])];
+        const describe = item => item.description || (item.command || []).join(' ') || 'Shell';
+        this.projectBar.innerHTML =
+            `<span class="project-bar-label">Project <strong>${this.escapeHtml(manifest.name)}</strong>` +
+            `${project.trusted ? '' : ' (not trusted)'}</span>` +
+            `<button class="btn btn-primary btn-sm" data-all>Open${manifest.sessions?.length > 1 ? ' all' : ''}</button>` +
+            items.map(item => `<button class="btn btn-secondary btn-sm" data-name="${this.escapeHtml(item.name)}" ` +
+                `title="${this.escapeHtml(describe(item))}">${this.escapeHtml(item.name)}</button>`).join('');
+        this.projectBar.querySelectorAll('button').forEach(btn => {
+            btn.addEventListener('click', () => this.openProject(project, btn.dataset.name ? [btn.dataset.name] : []));
+        });
+        this.projectBar.classList.remove('hidden');
+    }
+
+    async openProject(project, names) {
+        if (!project.trusted && !(await this.confirmProjectTrust(project))) return;
+        try {
+            const resp = await fetch(this.url('/api/project/open'), {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ path: project.root, names })
+            });
+            if (!resp.ok) {
+                this.toastError('Failed to open project: ' + (await resp.text()).trim());
+                return;
+            }
+            const sessions = await resp.json();
+            let group = null;
+            for (let i = 0; i < sessions.length; i += 4) {
+                const ids = sessions.slice(i, i + 4).map(session => {
+                    session._addedAt = Date.now();
+                    this.sessions.set(session.id, session);
+                    return session.id;
+                });
+                group = this.createGroup(ids, project.manifest.name);
+                this.addGroupToSidebar(group);
+            }
+            this.closeModal(this.downloadModal);
+            if (group) this.activateGroup(group.id);
+        } catch (err) {
+            this.toastError('Failed to open project');
+        }
+    }
+
+    // Show what a manifest would run; resolves to true once the user trusts it
+    confirmProjectTrust(project) {
+        const manifest = project.manifest;
+        const lines = Object.entries(manifest.env || {}).map(([key, value]) => `${key}=${value}`);
+        for (const item of [...(manifest.sessions || []), ...(manifest.tasks || [])]) {
+            const env = Object.entries(item.env || {}).map(([key, value]) => `${key}=${value} `).join('');
+            lines.push(`${item.name}: ${item.cwd ? `(in ${item.cwd}) ` : ''}${env}${(item.command || []).join(' ') || 'shell'}`);
+        }
+        return new Promise(resolve => {
+            const toast = this.toast(
+                `<strong>${this.escapeHtml(project.file)}</strong> is not trusted yet. It sets up:` +
+                `<pre class="clipboard-prompt-preview">${this.escapeHtml(lines.join('\n'))}</pre>` +
+                `<span class="project-prompt-actions">` +
+                `<button class="btn btn-primary btn-sm" data-action="trust">Trust and open</button>` +
+                `<button class="btn btn-secondary btn-sm" data-action="cancel">Cancel</button>` +
+                `</span>`,
+                'warning', 0);
+            if (!toast) return resolve(false);
+            toast.classList.add('project-prompt');
+            toast.querySelectorAll('[data-action]').forEach(btn => {
+                btn.addEventListener('click', async () => {
+                    toast.remove();
+                    if (btn.dataset.action !== 'trust') return resolve(false);
+                    try {
+                        const resp = await fetch(this.url('/api/project/trust'), {
+                            method: 'POST',
+                            headers: { 'Content-Type': 'application/json' },
+                            body: JSON.stringify({ path: project.root, hash: project.hash })
+                        });
+                        if (!resp.ok) {
+                            this.toastError('Failed to trust project: ' + (await resp.text()).trim());
+                            return resolve(false);
+                        }
+                        resolve(true);
+                    } catch (err) {
+                        this.toastError('Failed to trust project');
+                        resolve(false);
+                    }
+                });
+            });
+        });
+    }
+
     updateSortIndicators() {
         this.fileHeader.querySelectorAll('.sortable').forEach(col => {
             const isActive = col.dataset.sort === this.fileSortBy;
@@ -3862,11 +4048,106 @@ class TerminalMultiplexer {
             if (this.uploadDirectory && info.uploadDir) {
                 this.uploadDirectory.placeholder = info.uploadDir;
             }
+
+            // Read-only servers: hide controls that would change anything
+            document.body.classList.toggle('readonly', !!info.readOnly);
+
+            // Show logout button and security settings when login is required
+            this.logoutBtn.classList.toggle('hidden', !info.authEnabled);
+            document.getElementById('security-settings-tab').classList.toggle('hidden', !info.authEnabled);
         } catch (error) {
             console.error('Failed to load server info:', error);
         }
     }
 
+    async logout() {
+        try {
+            await fetch(this.url('/api/auth/logout'), { method: 'POST' });
+        } catch (error) {
+            console.error('Logout failed:', error);
+        }
+        window.location.href = this.url('/login.html');
+    }
+
+    async loadTOTPStatus() {
+        const status = document.getElementById('totp-status');
+        document.getElementById('totp-setup').classList.add('hidden');
+        try {
+            const response = await fetch(this.url('/api/auth/totp'));
+            if (!response.ok) {
+                throw new Error((await response.text()).trim());
+            }
+            const totp = await response.json();
+            status.textContent = totp.enrolled
+                ? `Enabled. ${totp.recoveryCodes} recovery code${totp.recoveryCodes === 1 ? '' : 's'} left.`
+                : 'Not enabled. Logins only need the password.';
+            document.getElementById('totp-enroll').classList.toggle('hidden', totp.enrolled);
+            document.getElementById('totp-disable').classList.toggle('hidden', !totp.enrolled);
+        } catch (error) {
+            status.textContent = 'Failed to load two-factor status: ' + error.message;
+        }
+    }
+
+    async startTOTPSetup() {
+        try {
+            const response = await fetch(this.url('/api/auth/totp/setup'), { method: 'POST' });
+            if (!response.ok) {
+                throw new Error((await response.text()).trim());
+            }
+            const setup = await response.json();
+            document.getElementById('totp-uri').href = setup.uri;
+            document.getElementById('totp-secret').textContent = setup.secret.replace(/(.{4})/g, '$1 ').trim();
+            document.getElementById('totp-recovery').classList.add('hidden');
+            document.getElementById('totp-enroll').classList.add('hidden');
+            document.getElementById('totp-setup').classList.remove('hidden');
+            document.getElementById('totp-confirm-code').value = '';
+            document.getElementById('totp-confirm-code').focus();
+        } catch (error) {
+            this.toastError('Failed to start setup: ' + error.message);
+        }
+    }
+
+    async confirmTOTPSetup() {
+        const input = document.getElementById('totp-confirm-code');
+        try {
+            const response = await fetch(this.url('/api/auth/totp/confirm'), {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ code: input.value.trim() })
+            });
+            if (!response.ok) {
+                throw new Error((await response.text()).trim());
+            }
+            const result = await response.json();
+            await this.loadTOTPStatus();
+            document.getElementById('totp-recovery-codes').textContent = result.recoveryCodes.join('\n');
+            document.getElementById('totp-recovery').classList.remove('hidden');
+            this.toastSuccess('Two-factor authentication enabled');
+        } catch (error) {
+            this.toastError(error.message || 'Failed to enable two-factor authentication');
+        }
+    }
+
+    async disableTOTP() {
+        const input = document.getElementById('totp-disable-code');
+        try {
+            const response = await fetch(this.url('/api/auth/totp'), {
+                method: 'DELETE',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ code: input.value.trim() })
+            });
+            if (!response.ok) {
+                throw new Error((await response.text()).trim());
+            }
+            input.value = '';
+            document.getElementById('totp-recovery').classList.add('hidden');
+            await this.loadTOTPStatus();
+            this.toastSuccess('Two-factor authentication disabled');
+        } catch (error) {
+            this.toastError(error.message || 'Failed to disable two-factor authentication');
+        }
+    }
+
     getDefaultSettings() {
         return {
             ui: {
@@ -4068,7 +4349,7 @@ class TerminalMultiplexer {
     updateThemeActionsVisibility(tabName) {
         const themeActions = document.getElementById('settings-theme-actions');
         if (themeActions) {
-            themeActions.style.display = tabName === 'keybar' ? 'none' : '';
+            themeActions.style.display = ['keybar', 'redaction', 'security'].includes(tabName) ? 'none' : '';
         }
     }
 
@@ -4170,6 +4451,8 @@ class TerminalMultiplexer {
         }
         // Populate keybar buttons
         this.populateKeybarButtons();
+        // Populate redaction patterns
+        document.getElementById('redaction-patterns').value = (this.settings.redaction?.patterns || []).join('\n');
     }
 
     getSettingsFromInputs() {
@@ -4195,6 +4478,11 @@ class TerminalMultiplexer {
             buttons: this.settings.keybar?.buttons || this.getDefaultSettings().keybar.buttons
         };
 
+        settings.redaction = {
+            patterns: document.getElementById('redaction-patterns').value
+                .split('\n').map(line => line.trim()).filter(line => line)
+        };
+
         return settings;
     }
 
@@ -4213,7 +4501,9 @@ class TerminalMultiplexer {
                 body: JSON.stringify(settings)
             });
 
-            if (!response.ok) throw new Error('Failed to save settings');
+            if (!response.ok) {
+                throw new Error((await response.text()).trim() || 'Failed to save settings');
+            }
 
             this.settings = settings;
             this.renderKeybar();
@@ -4222,7 +4512,7 @@ class TerminalMultiplexer {
             this.toastSuccess('Settings saved');
         } catch (error) {
             console.error('Failed to save settings:', error);
-            this.toastError('Failed to save settings');
+            this.toastError(error.message || 'Failed to save settings');
         }
     }
 
@@ -5289,11 +5579,18 @@ class TerminalMultiplexer {
     // This bypasses reverse proxy SSE buffering since each poll is a complete HTTP request.
     startClipboardPolling() {
         let knownVersion = -1;
+        let knownPending = '0';
 
         const poll = async () => {
             try {
                 const resp = await fetch(this.url('/api/clipboard/version'));
                 if (!resp.ok) return;
+                // OSC 52 writes held by the server's confirm policy
+                const pending = resp.headers.get('X-Clipboard-Pending') || '0';
+                if (pending !== knownPending) {
+                    knownPending = pending;
+                    this.loadPendingClipboard();
+                }
                 const version = parseInt(await resp.text(), 10);
                 if (version !== knownVersion) {
                     if (knownVersion !== -1) {
@@ -5317,6 +5614,126 @@ class TerminalMultiplexer {
         poll();
     }
 
+    // Show an approval toast for each OSC 52 write waiting for confirmation,
+    // and drop toasts for requests decided elsewhere or expired
+    async loadPendingClipboard() {
+        let pending;
+        try {
+            const resp = await fetch(this.url('/api/clipboard/pending'));
+            if (!resp.ok) return;
+            pending = await resp.json();
+        } catch (err) {
+            return;
+        }
+
+        this.clipboardPromptToasts = this.clipboardPromptToasts || new Map();
+        const ids = new Set(pending.map(req => req.id));
+        for (const [id, toast] of this.clipboardPromptToasts) {
+            if (!ids.has(id)) {
+                toast.remove();
+                this.clipboardPromptToasts.delete(id);
+            }
+        }
+        for (const req of pending) {
+            if (!this.clipboardPromptToasts.has(req.id)) {
+                this.clipboardPromptToasts.set(req.id, this.showClipboardPrompt(req));
+            }
+        }
+    }
+
+    // Offer to recreate sessions saved before the server's tmux sessions went away
+    async offerResurrect() {
+        if (this.serverInfo?.readOnly) return;
+        let saved;
+        try {
+            const resp = await fetch(this.url('/api/resurrect'));
+            if (!resp.ok) return;
+            saved = await resp.json();
+        } catch (err) {
+            return;
+        }
+        if (!Array.isArray(saved) || saved.length === 0) return;
+
+        const names = saved.map(def => this.escapeHtml(def.name || def.id)).join(', ');
+        const toast = this.toast(
+            `${saved.length} session${saved.length === 1 ? '' : 's'} from before the restart can be restored: ${names}` +
+            `<span class="resurrect-prompt-actions">` +
+            `<button class="btn btn-primary btn-sm" data-action="restore">Restore</button>` +
+            `<button class="btn btn-secondary btn-sm" data-action="discard">Discard</button>` +
+            `</span>`,
+            'info', 0);
+        if (!toast) return;
+        toast.classList.add('resurrect-prompt');
+
+        toast.querySelectorAll('[data-action]').forEach(btn => {
+            btn.addEventListener('click', async () => {
+                const restore = btn.dataset.action === 'restore';
+                toast.remove();
+                try {
+                    if (restore) this.stateSaveSuspended = true;
+                    const resp = await fetch(this.url('/api/resurrect'), {
+                        method: restore ? 'POST' : 'DELETE',
+                        headers: { 'Content-Type': 'application/json' },
+                        body: restore ? JSON.stringify({ ids: [] }) : undefined
+                    });
+                    if (!resp.ok) {
+                        this.stateSaveSuspended = false;
+                        this.toastError('Failed to restore sessions: ' + (await resp.text()).trim());
+                        return;
+                    }
+                    // Reload to pick up the sessions with their restored groups
+                    if (restore) location.reload();
+                } catch (err) {
+                    this.stateSaveSuspended = false;
+                    this.toastError('Failed to restore sessions');
+                }
+            });
+        });
+    }
+
+    showClipboardPrompt(req) {
+        const source = req.sessionName || req.sessionId;
+        const toast = this.toast(
+            `<strong>${this.escapeHtml(source)}</strong> wants to set the clipboard (${req.bytes} bytes):` +
+            `<pre class="clipboard-prompt-preview">${this.escapeHtml(req.preview)}</pre>` +
+            `<span class="clipboard-prompt-actions">` +
+            `<button class="btn btn-primary btn-sm" data-action="allow">Allow</button>` +
+            `<button class="btn btn-secondary btn-sm" data-action="deny">Deny</button>` +
+            `<button class="btn btn-secondary btn-sm" data-action="block" title="Deny all clipboard writes from this session">Block session</button>` +
+            `</span>`,
+            'warning', 0);
+        if (!toast) return null;
+        toast.classList.add('clipboard-prompt');
+
+        toast.querySelectorAll('[data-action]').forEach(btn => {
+            btn.addEventListener('click', async () => {
+                const action = btn.dataset.action;
+                try {
+                    if (action === 'block') {
+                        await fetch(this.url(`/api/sessions/${encodeURIComponent(req.sessionId)}`), {
+                            method: 'PATCH',
+                            headers: { 'Content-Type': 'application/json' },
+                            body: JSON.stringify({ osc52Policy: 'deny' })
+                        });
+                    }
+                    const resp = await fetch(this.url(`/api/clipboard/pending/${encodeURIComponent(req.id)}`), {
+                        method: 'POST',
+                        headers: { 'Content-Type': 'application/json' },
+                        body: JSON.stringify({ approve: action === 'allow' })
+                    });
+                    if (!resp.ok && resp.status !== 404) {
+                        this.toastError('Failed to answer clipboard request: ' + (await resp.text()).trim());
+                    }
+                } catch (err) {
+                    this.toastError('Failed to answer clipboard request');
+                }
+                toast.remove();
+                this.clipboardPromptToasts.delete(req.id);
+            });
+        });
+        return toast;
+    }
+
 }
 
 // Initialize app
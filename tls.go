@@ -0,0 +1,358 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SECTION: TLS
+
+const (
+	// Validity of the generated CA and server certificates
+	selfSignedCAValidity   = 10 * 365 * 24 * time.Hour
+	selfSignedCertValidity = 365 * 24 * time.Hour
+	// Regenerate the server certificate when it expires within this window
+	selfSignedRenewBefore = 30 * 24 * time.Hour
+	// How often the reloader checks the certificate files for changes
+	certReloadInterval = 5 * time.Second
+)
+
+// tlsDir returns the directory holding generated TLS material
+func tlsDir() string {
+	return filepath.Join(xdgDataHome(), "webmux", "tls")
+}
+
+// certReloader serves a certificate from disk and reloads it when the files change
+type certReloader struct {
+	certPath  string
+	keyPath   string
+	cert      *tls.Certificate
+	certMod   time.Time
+	keyMod    time.Time
+	lastCheck time.Time
+	mu        sync.Mutex
+}
+
+// newCertReloader loads the certificate pair and returns a reloader for it
+func newCertReloader(certPath, keyPath string) (*certReloader, error) {
+	cr := &certReloader{certPath: certPath, keyPath: keyPath}
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// reload reads the certificate pair from disk
+// Must be called with cr.mu held (or before the reloader is shared)
+func (cr *certReloader) reload() error {
+	certInfo, err := os.Stat(cr.certPath)
+	if err != nil {
+		return err
+	}
+	keyInfo, err := os.Stat(cr.keyPath)
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.certPath, cr.keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	cr.cert = &cert
+	cr.certMod = certInfo.ModTime()
+	cr.keyMod = keyInfo.ModTime()
+	return nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate, reloading changed files
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if time.Since(cr.lastCheck) < certReloadInterval {
+		return cr.cert, nil
+	}
+	cr.lastCheck = time.Now()
+
+	certInfo, certErr := os.Stat(cr.certPath)
+	keyInfo, keyErr := os.Stat(cr.keyPath)
+	if certErr != nil || keyErr != nil {
+		// Files temporarily missing (e.g. mid-renewal) - keep serving the old cert
+		return cr.cert, nil
+	}
+	if certInfo.ModTime().Equal(cr.certMod) && keyInfo.ModTime().Equal(cr.keyMod) {
+		return cr.cert, nil
+	}
+
+	if err := cr.reload(); err != nil {
+		log.Printf("TLS certificate reload failed, keeping previous certificate: %v", err)
+		return cr.cert, nil
+	}
+	log.Printf("Reloaded TLS certificate from %s", cr.certPath)
+	return cr.cert, nil
+}
+
+// writePEM writes a single PEM block to path with the given permissions
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	return os.WriteFile(path, data, perm)
+}
+
+// readPEMCert reads the first certificate from a PEM file
+func readPEMCert(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate found in %s", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// readPEMKey reads an EC private key from a PEM file
+func readPEMKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no private key found in %s", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unexpected key type in %s", path)
+	}
+	return ecKey, nil
+}
+
+// randomSerial returns a random certificate serial number
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// ensureSelfSignedCA loads the cached CA or generates a new one
+func ensureSelfSignedCA(dir string, dnsNames []string, ips []net.IP) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	caPath := filepath.Join(dir, "ca.pem")
+	caKeyPath := filepath.Join(dir, "ca-key.pem")
+
+	if cert, err := readPEMCert(caPath); err == nil {
+		if key, err := readPEMKey(caKeyPath); err == nil && time.Now().Before(cert.NotAfter) {
+			if caPermitsHosts(cert, dnsNames, ips) {
+				return cert, key, nil
+			}
+			log.Printf("Self-signed CA %s is not constrained to this machine's names and addresses, replacing it", caPath)
+		}
+	}
+
+	// Name constraints limit the CA to this machine, so trusting it cannot
+	// vouch for any other site if the key leaks
+	var ipRanges []*net.IPNet
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			ipRanges = append(ipRanges, &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)})
+		} else {
+			ipRanges = append(ipRanges, &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)})
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "webmux local CA (" + hostname + ")"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(selfSignedCAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+
+		PermittedDNSDomainsCritical: true,
+		PermittedDNSDomains:         dnsNames,
+		PermittedIPRanges:           ipRanges,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writePEM(caKeyPath, "PRIVATE KEY", keyDER, 0600); err != nil {
+		return nil, nil, err
+	}
+	if err := writePEM(caPath, "CERTIFICATE", der, 0644); err != nil {
+		return nil, nil, err
+	}
+	log.Printf("Generated self-signed CA: %s", caPath)
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// selfSignedHosts returns the names and addresses the server certificate covers
+func selfSignedHosts() (dnsNames []string, ips []net.IP) {
+	dnsNames = []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		dnsNames = append(dnsNames, hostname)
+	}
+	ips = []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && !ipNet.IP.IsLinkLocalUnicast() {
+				ips = append(ips, ipNet.IP)
+			}
+		}
+	}
+	return dnsNames, ips
+}
+
+// ensureSelfSignedCert generates (or reuses) a CA and server certificate in the data dir.
+// Returns the certificate, key and CA file paths.
+func ensureSelfSignedCert() (certPath, keyPath, caPath string, err error) {
+	dir := tlsDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", "", err
+	}
+	certPath = filepath.Join(dir, "cert.pem")
+	keyPath = filepath.Join(dir, "key.pem")
+	caPath = filepath.Join(dir, "ca.pem")
+
+	dnsNames, ips := selfSignedHosts()
+	caCert, caKey, err := ensureSelfSignedCA(dir, dnsNames, ips)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to create CA: %w", err)
+	}
+
+	// Reuse the cached server cert while it is valid, signed by the current CA
+	// and still covers this machine's names and addresses
+	if cert, err := readPEMCert(certPath); err == nil && cert.CheckSignatureFrom(caCert) == nil &&
+		time.Until(cert.NotAfter) > selfSignedRenewBefore && certCoversHosts(cert, dnsNames, ips) {
+		if _, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil {
+			return certPath, keyPath, caPath, nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", "", err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return "", "", "", err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "webmux"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(selfSignedCertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return "", "", "", err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", "", "", err
+	}
+	if err := writePEM(keyPath, "PRIVATE KEY", keyDER, 0600); err != nil {
+		return "", "", "", err
+	}
+	if err := writePEM(certPath, "CERTIFICATE", der, 0644); err != nil {
+		return "", "", "", err
+	}
+	log.Printf("Generated self-signed certificate: %s", certPath)
+
+	return certPath, keyPath, caPath, nil
+}
+
+// caPermitsHosts reports whether a CA is name-constrained and its constraints
+// allow every given DNS name and IP
+func caPermitsHosts(ca *x509.Certificate, dnsNames []string, ips []net.IP) bool {
+	if !ca.PermittedDNSDomainsCritical {
+		return false
+	}
+	for _, name := range dnsNames {
+		if !slices.ContainsFunc(ca.PermittedDNSDomains, func(domain string) bool {
+			return strings.EqualFold(name, domain) || strings.HasSuffix(strings.ToLower(name), "."+strings.ToLower(domain))
+		}) {
+			return false
+		}
+	}
+	for _, ip := range ips {
+		if !slices.ContainsFunc(ca.PermittedIPRanges, func(n *net.IPNet) bool { return n.Contains(ip) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// certCoversHosts reports whether cert lists every given DNS name and IP
+func certCoversHosts(cert *x509.Certificate, dnsNames []string, ips []net.IP) bool {
+	for _, name := range dnsNames {
+		if cert.VerifyHostname(name) != nil {
+			return false
+		}
+	}
+	for _, ip := range ips {
+		if cert.VerifyHostname(ip.String()) != nil {
+			return false
+		}
+	}
+	return true
+}
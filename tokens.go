@@ -0,0 +1,530 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SECTION: TOKENS
+
+// API token scopes
+const (
+	ScopeSessionsRead  = "sessions:read"
+	ScopeSessionsWrite = "sessions:write"
+	ScopeKeysSend      = "keys:send"
+	ScopeClipboard     = "clipboard"
+	ScopeFilesRead     = "files:read"
+	ScopeFilesWrite    = "files:write"
+	ScopeSettings      = "settings"
+	ScopeTerminal      = "terminal"
+	ScopeAdmin         = "admin" // implies every other scope
+)
+
+// allScopes lists every valid scope (for validation and help text)
+var allScopes = []string{
+	ScopeSessionsRead, ScopeSessionsWrite, ScopeKeysSend, ScopeClipboard,
+	ScopeFilesRead, ScopeFilesWrite, ScopeSettings, ScopeTerminal, ScopeAdmin,
+}
+
+// sessionTokenScopes are granted to the token injected into each terminal for wm
+var sessionTokenScopes = []string{
+	ScopeSessionsRead, ScopeSessionsWrite, ScopeKeysSend, ScopeClipboard,
+	ScopeFilesRead, ScopeFilesWrite,
+}
+
+// Prefix for token secrets, so they are recognizable in configs and scanners
+const apiTokenPrefix = "wmx_"
+
+// APIToken is a named bearer token with a set of scopes.
+// Only the SHA-256 hash of the secret is kept.
+type APIToken struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	Hash      string     `json:"hash,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	SessionID string     `json:"sessionId,omitempty"` // set for tokens injected into a terminal session
+	User      string     `json:"user,omitempty"`      // user the token acts as in -multi-user mode
+}
+
+// sessionBoundToken reports whether r was authenticated by a token injected into a
+// terminal session, i.e. it may come from a program running inside webmux
+func sessionBoundToken(r *http.Request) bool {
+	token, ok := r.Context().Value(tokenContextKey{}).(*APIToken)
+	return ok && token.SessionID != ""
+}
+
+// Allows reports whether the token grants scope (empty scope = any valid token)
+func (t *APIToken) Allows(scope string) bool {
+	if scope == "" || slices.Contains(t.Scopes, ScopeAdmin) {
+		return true
+	}
+	return slices.Contains(t.Scopes, scope)
+}
+
+// expired reports whether the token has passed its expiry time
+func (t *APIToken) expired() bool {
+	return t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt)
+}
+
+// TokenStore holds persisted tokens (tokens.json) and in-memory session tokens
+type TokenStore struct {
+	path    string
+	tokens  map[string]*APIToken // hash -> persisted token
+	session map[string]*APIToken // hash -> session-scoped token (not persisted)
+	fileMod time.Time
+	mu      sync.Mutex
+}
+
+// tokensFilePath returns the path to the persisted token file
+func tokensFilePath() string {
+	return filepath.Join(xdgConfigHome(), "webmux", "tokens.json")
+}
+
+// hashToken returns the hex SHA-256 of a token secret
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewTokenStore loads persisted tokens from disk
+func NewTokenStore() (*TokenStore, error) {
+	ts := &TokenStore{
+		path:    tokensFilePath(),
+		tokens:  make(map[string]*APIToken),
+		session: make(map[string]*APIToken),
+	}
+	if err := ts.load(); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// load reads tokens.json, replacing the persisted tokens
+// Must be called with ts.mu held (or before the store is shared)
+func (ts *TokenStore) load() error {
+	info, err := os.Stat(ts.path)
+	if os.IsNotExist(err) {
+		ts.tokens = make(map[string]*APIToken)
+		ts.fileMod = time.Time{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(ts.path)
+	if err != nil {
+		return err
+	}
+	var list []*APIToken
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("invalid token file %s: %w", ts.path, err)
+	}
+
+	tokens := make(map[string]*APIToken, len(list))
+	for _, t := range list {
+		tokens[t.Hash] = t
+	}
+	ts.tokens = tokens
+	ts.fileMod = info.ModTime()
+	return nil
+}
+
+// reloadIfChanged re-reads tokens.json if it was modified outside the server
+// Must be called with ts.mu held
+func (ts *TokenStore) reloadIfChanged() {
+	info, err := os.Stat(ts.path)
+	var mod time.Time
+	if err == nil {
+		mod = info.ModTime()
+	}
+	if mod.Equal(ts.fileMod) {
+		return
+	}
+	if err := ts.load(); err != nil {
+		log.Printf("Failed to reload tokens: %v", err)
+	}
+}
+
+// save writes the persisted tokens to disk
+// Must be called with ts.mu held
+func (ts *TokenStore) save() error {
+	list := make([]*APIToken, 0, len(ts.tokens))
+	for _, t := range ts.tokens {
+		list = append(list, t)
+	}
+	slices.SortFunc(list, func(a, b *APIToken) int { return a.CreatedAt.Compare(b.CreatedAt) })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(ts.path), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(ts.path, data, 0600); err != nil {
+		return err
+	}
+	if info, err := os.Stat(ts.path); err == nil {
+		ts.fileMod = info.ModTime()
+	}
+	return nil
+}
+
+// validateScopes checks that every scope is known
+func validateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(allScopes, scope) {
+			return fmt.Errorf("unknown scope %q (valid: %s)", scope, strings.Join(allScopes, ", "))
+		}
+	}
+	return nil
+}
+
+// newToken builds a token and its secret
+func newToken(name string, scopes []string, ttl time.Duration) (*APIToken, string) {
+	secret := apiTokenPrefix + randomToken(32)
+	t := &APIToken{
+		ID:        randomToken(6),
+		Name:      name,
+		Scopes:    scopes,
+		Hash:      hashToken(secret),
+		CreatedAt: time.Now(),
+	}
+	if ttl > 0 {
+		expires := t.CreatedAt.Add(ttl)
+		t.ExpiresAt = &expires
+	}
+	return t, secret
+}
+
+// Create adds a persisted token and returns it with its secret (shown only once)
+func (ts *TokenStore) Create(name string, scopes []string, ttl time.Duration, user string) (*APIToken, string, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, "", fmt.Errorf("token name is required")
+	}
+	if err := validateScopes(scopes); err != nil {
+		return nil, "", err
+	}
+	if user != "" && !validUserName(user) {
+		return nil, "", fmt.Errorf("invalid user name %q", user)
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.reloadIfChanged()
+
+	t, secret := newToken(name, scopes, ttl)
+	t.User = user
+	ts.tokens[t.Hash] = t
+	if err := ts.save(); err != nil {
+		delete(ts.tokens, t.Hash)
+		return nil, "", err
+	}
+	return t, secret, nil
+}
+
+// IssueSessionToken creates an in-memory token bound to a terminal session,
+// acting as the session's owner
+func (ts *TokenStore) IssueSessionToken(sessionID, user string) string {
+	t, secret := newToken("session "+sessionID, sessionTokenScopes, 0)
+	t.SessionID = sessionID
+	t.User = user
+
+	ts.mu.Lock()
+	ts.session[t.Hash] = t
+	ts.mu.Unlock()
+	return secret
+}
+
+// RestoreSessionToken re-registers the token of a session reattached after a
+// restart; the shell still holds the secret, only its hash was kept
+func (ts *TokenStore) RestoreSessionToken(sessionID, user, hash string) {
+	if len(hash) != sha256.Size*2 {
+		return
+	}
+	t := &APIToken{
+		ID:        randomToken(6),
+		Name:      "session " + sessionID,
+		Scopes:    sessionTokenScopes,
+		Hash:      hash,
+		CreatedAt: time.Now(),
+		SessionID: sessionID,
+		User:      user,
+	}
+
+	ts.mu.Lock()
+	ts.session[t.Hash] = t
+	ts.mu.Unlock()
+}
+
+// RevokeSessionTokens drops the tokens bound to a terminal session
+func (ts *TokenStore) RevokeSessionTokens(sessionID string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	for hash, t := range ts.session {
+		if t.SessionID == sessionID {
+			delete(ts.session, hash)
+		}
+	}
+}
+
+// Revoke deletes a persisted token by ID
+func (ts *TokenStore) Revoke(id string) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.reloadIfChanged()
+
+	for hash, t := range ts.tokens {
+		if t.ID == id {
+			delete(ts.tokens, hash)
+			return ts.save()
+		}
+	}
+	return fmt.Errorf("token not found: %s", id)
+}
+
+// List returns the persisted tokens (hashes omitted)
+func (ts *TokenStore) List() []APIToken {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.reloadIfChanged()
+
+	list := make([]APIToken, 0, len(ts.tokens))
+	for _, t := range ts.tokens {
+		c := *t
+		c.Hash = ""
+		list = append(list, c)
+	}
+	slices.SortFunc(list, func(a, b APIToken) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return list
+}
+
+// Lookup returns the token for a secret if it is valid
+func (ts *TokenStore) Lookup(secret string) (*APIToken, bool) {
+	if !strings.HasPrefix(secret, apiTokenPrefix) {
+		return nil, false
+	}
+	hash := hashToken(secret)
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if t, ok := ts.session[hash]; ok {
+		return t, true
+	}
+	t, ok := ts.tokens[hash]
+	if !ok {
+		// The file may have been edited by 'webmux -create-token'
+		ts.reloadIfChanged()
+		t, ok = ts.tokens[hash]
+	}
+	if !ok || t.expired() {
+		return nil, false
+	}
+	return t, true
+}
+
+// routeScope returns the scope a token needs for a request.
+// Unknown routes require admin so new endpoints are closed by default.
+func routeScope(r *http.Request) string {
+	path := r.URL.Path
+	read := r.Method == http.MethodGet || r.Method == http.MethodHead
+
+	switch {
+	case path == "/api/info":
+		return ""
+	case path == "/api/sessions", path == "/api/resurrect", path == "/api/profiles",
+		path == "/api/workspaces", strings.HasPrefix(path, "/api/workspaces/"):
+		if read {
+			return ScopeSessionsRead
+		}
+		return ScopeSessionsWrite
+	case path == "/api/project", path == "/api/project/trust", path == "/api/project/open":
+		if read {
+			return ScopeFilesRead
+		}
+		return ScopeSessionsWrite
+	case strings.HasPrefix(path, "/api/sessions/"):
+		if strings.HasSuffix(path, "/keys") {
+			return ScopeKeysSend
+		}
+		if read {
+			return ScopeSessionsRead
+		}
+		return ScopeSessionsWrite
+	case strings.HasPrefix(path, "/api/clipboard"), strings.HasPrefix(path, "/api/scratch"):
+		return ScopeClipboard
+	case path == "/api/upload":
+		return ScopeFilesWrite
+	case path == "/api/download", path == "/api/browse", path == "/api/marked/download",
+		path == "/api/marked/events":
+		return ScopeFilesRead
+	case path == "/api/marked":
+		if read {
+			return ScopeFilesRead
+		}
+		return ScopeFilesWrite
+	case path == "/api/shares", strings.HasPrefix(path, "/api/shares/"):
+		if read {
+			return ScopeSessionsRead
+		}
+		return ScopeSessionsWrite
+	case path == "/api/settings", path == "/api/ui-state", strings.HasPrefix(path, "/api/ui-state/"):
+		return ScopeSettings
+	case strings.HasPrefix(path, "/t/"):
+		return ScopeTerminal
+	case !strings.HasPrefix(path, "/api/"):
+		// Static UI assets
+		return ""
+	}
+	return ScopeAdmin
+}
+
+// ownsToken reports whether the request may see and revoke a token: with
+// -multi-user, users manage only their own tokens and an admin manages all
+func (a *AuthManager) ownsToken(r *http.Request, t *APIToken) bool {
+	return isAdmin(r, a.multiUser) || t.User == requestUser(r)
+}
+
+// handleTokens lists and creates API tokens
+// GET /api/tokens, POST /api/tokens {"name", "scopes", "expiresIn"}
+func (a *AuthManager) handleTokens(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		tokens := make([]APIToken, 0)
+		for _, t := range a.tokens.List() {
+			if a.ownsToken(r, &t) {
+				tokens = append(tokens, t)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"tokens": tokens,
+			"scopes": allScopes,
+		})
+
+	case http.MethodPost:
+		var req struct {
+			Name      string   `json:"name"`
+			Scopes    []string `json:"scopes"`
+			ExpiresIn string   `json:"expiresIn"` // Go duration, e.g. "720h"; empty = never
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		var ttl time.Duration
+		if req.ExpiresIn != "" {
+			d, err := time.ParseDuration(req.ExpiresIn)
+			if err != nil || d <= 0 {
+				http.Error(w, "Invalid expiresIn: use a duration like 720h", http.StatusBadRequest)
+				return
+			}
+			ttl = d
+		}
+		if slices.Contains(req.Scopes, ScopeAdmin) && !isAdmin(r, a.multiUser) {
+			http.Error(w, "Forbidden: only an admin can create admin tokens", http.StatusForbidden)
+			return
+		}
+
+		t, secret, err := a.tokens.Create(req.Name, req.Scopes, ttl, requestUser(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Created API token %s (%s) with scopes %s", t.ID, t.Name, strings.Join(t.Scopes, ","))
+
+		c := *t
+		c.Hash = ""
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{"token": c, "secret": secret})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleToken revokes a single API token
+// DELETE /api/tokens/{id}
+func (a *AuthManager) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/tokens/")
+	tokens := a.tokens.List()
+	if i := slices.IndexFunc(tokens, func(t APIToken) bool { return t.ID == id }); i < 0 || !a.ownsToken(r, &tokens[i]) {
+		http.Error(w, "token not found: "+id, http.StatusNotFound)
+		return
+	}
+	if err := a.tokens.Revoke(id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	log.Printf("Revoked API token %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runCreateToken creates a persisted token from the command line and prints its secret
+func runCreateToken(name, scopes, expiresIn, user string) error {
+	ts, err := NewTokenStore()
+	if err != nil {
+		return err
+	}
+	var ttl time.Duration
+	if expiresIn != "" {
+		if ttl, err = time.ParseDuration(expiresIn); err != nil || ttl <= 0 {
+			return fmt.Errorf("invalid -token-expires %q: use a duration like 720h", expiresIn)
+		}
+	}
+
+	var scopeList []string
+	for scope := range strings.SplitSeq(scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopeList = append(scopeList, scope)
+		}
+	}
+
+	t, secret, err := ts.Create(name, scopeList, ttl, user)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Created token %s (%s) with scopes %s\n", t.ID, t.Name, strings.Join(t.Scopes, ","))
+	fmt.Println(secret)
+	return nil
+}
@@ -0,0 +1,65 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouteScope(t *testing.T) {
+	tests := []struct {
+		method, path string
+		want         string
+	}{
+		{"GET", "/api/info", ""},
+		{"GET", "/", ""},
+		{"GET", "/app.js", ""},
+		{"GET", "/api/sessions", ScopeSessionsRead},
+		{"POST", "/api/sessions", ScopeSessionsWrite},
+		{"GET", "/api/sessions/session-1", ScopeSessionsRead},
+		{"DELETE", "/api/sessions/session-1", ScopeSessionsWrite},
+		{"POST", "/api/sessions/session-1/keys", ScopeKeysSend},
+		{"POST", "/api/resurrect", ScopeSessionsWrite},
+		{"GET", "/api/profiles", ScopeSessionsRead},
+		{"GET", "/api/workspaces", ScopeSessionsRead},
+		{"POST", "/api/workspaces/apply", ScopeSessionsWrite},
+		{"GET", "/api/project", ScopeFilesRead},
+		{"POST", "/api/project/open", ScopeSessionsWrite},
+		{"POST", "/api/clipboard", ScopeClipboard},
+		{"GET", "/api/scratch/events", ScopeClipboard},
+		{"POST", "/api/upload", ScopeFilesWrite},
+		{"GET", "/api/download", ScopeFilesRead},
+		{"GET", "/api/marked", ScopeFilesRead},
+		{"POST", "/api/marked", ScopeFilesWrite},
+		{"GET", "/api/shares", ScopeSessionsRead},
+		{"DELETE", "/api/shares/abc", ScopeSessionsWrite},
+		{"POST", "/api/settings", ScopeSettings},
+		{"GET", "/api/ui-state/history", ScopeSettings},
+		{"GET", "/t/session-1/ws", ScopeTerminal},
+		// Admin routes, and anything unknown under /api/
+		{"POST", "/api/tokens", ScopeAdmin},
+		{"GET", "/api/not-yet-written", ScopeAdmin},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := routeScope(r); got != tt.want {
+			t.Errorf("routeScope(%s %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// SECTION: TOTP
+
+const (
+	// RFC 6238 parameters (the defaults every authenticator app supports)
+	totpPeriod = 30
+	totpDigits = 6
+	// Accept codes from one step before/after the current one to allow for clock drift
+	totpSkew = 1
+	// Issuer shown in authenticator apps
+	totpIssuer = "Webmux"
+	// How long an unconfirmed enrollment secret stays valid
+	totpSetupTTL = 10 * time.Minute
+	// Number of single-use recovery codes generated at enrollment
+	recoveryCodeCount = 10
+)
+
+// totpState holds in-memory TOTP state (guarded by AuthManager.mu)
+type totpState struct {
+	pendingSecret  string    // generated by setup, saved once a code is confirmed
+	pendingExpires time.Time // when the pending secret is discarded
+	lastCounter    uint64    // last accepted time step, so a code cannot be replayed
+}
+
+// totpEncoding is unpadded base32, as used in otpauth URIs
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateTOTPSecret returns a new random 160-bit secret in base32
+func generateTOTPSecret() string {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return totpEncoding.EncodeToString(b)
+}
+
+// totpCode computes the code for a secret at a time step (RFC 4226 HOTP with SHA-1)
+func totpCode(secret string, counter uint64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for range totpDigits {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod), nil
+}
+
+// matchTOTP returns the time step a code is valid for, within the allowed skew
+func matchTOTP(secret, code string, now time.Time) (uint64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := uint64(now.Unix() / totpPeriod)
+	for delta := -totpSkew; delta <= totpSkew; delta++ {
+		counter := current + uint64(delta)
+		expected, err := totpCode(secret, counter)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(code), []byte(expected)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// totpURI returns the otpauth:// URI for enrolling a secret in an authenticator app
+func totpURI(secret string) string {
+	account := "webmux"
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		account = hostname
+	}
+	if user := os.Getenv("USER"); user != "" {
+		account = user + "@" + account
+	}
+
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + url.PathEscape(totpIssuer+":"+account) + "?" + params.Encode()
+}
+
+// newRecoveryCodes returns fresh recovery codes and their hashes for storage
+func newRecoveryCodes() (codes, hashes []string) {
+	for range recoveryCodeCount {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			panic(err)
+		}
+		raw := strings.ToLower(totpEncoding.EncodeToString(b))[:10]
+		code := raw[:5] + "-" + raw[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+	return codes, hashes
+}
+
+// normalizeRecoveryCode lowercases a recovery code and drops separators
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// verifySecondFactor checks a TOTP code, or consumes a recovery code
+func (a *AuthManager) verifySecondFactor(code string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.config == nil || a.config.TOTPSecret == "" {
+		return false
+	}
+
+	if counter, ok := matchTOTP(a.config.TOTPSecret, code, time.Now()); ok {
+		// Each code is accepted once
+		if counter <= a.totp.lastCounter {
+			return false
+		}
+		a.totp.lastCounter = counter
+		return true
+	}
+
+	hash := hashToken(normalizeRecoveryCode(code))
+	for i, stored := range a.config.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(stored)) == 1 {
+			a.config.RecoveryCodes = append(a.config.RecoveryCodes[:i:i], a.config.RecoveryCodes[i+1:]...)
+			if err := a.saveConfig(); err != nil {
+				log.Printf("Failed to save auth config after using a recovery code: %v", err)
+			}
+			log.Printf("Recovery code used (%d left)", len(a.config.RecoveryCodes))
+			return true
+		}
+	}
+	return false
+}
+
+// handleTOTP reports enrollment status or disables the second factor
+// GET /api/auth/totp, DELETE /api/auth/totp {"code": "..."}
+func (a *AuthManager) handleTOTP(w http.ResponseWriter, r *http.Request) {
+	if !a.enabled {
+		http.Error(w, "Login is not enabled (start webmux with -auth)", http.StatusBadRequest)
+		return
+	}
+	if a.sessionUser(r) != "" {
+		http.Error(w, "Forbidden: two-factor authentication applies to the shared password only", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		config := a.currentConfig()
+		json.NewEncoder(w).Encode(map[string]any{
+			"enrolled":      config.TOTPSecret != "",
+			"recoveryCodes": len(config.RecoveryCodes),
+		})
+
+	case http.MethodDelete:
+		var req struct {
+			Code string `json:"code"`
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, 4096)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if a.currentConfig().TOTPSecret == "" {
+			http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+			return
+		}
+		if !a.verifySecondFactor(req.Code) {
+			time.Sleep(time.Second)
+			http.Error(w, "Invalid authentication code", http.StatusForbidden)
+			return
+		}
+
+		a.mu.Lock()
+		a.config.TOTPSecret = ""
+		a.config.RecoveryCodes = nil
+		err := a.saveConfig()
+		a.mu.Unlock()
+		if err != nil {
+			http.Error(w, "Failed to save auth config: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Two-factor authentication disabled from %s", clientDescription(r))
+		json.NewEncoder(w).Encode(map[string]string{"status": "disabled"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTOTPSetup starts enrollment by generating a secret to add to an authenticator app
+// POST /api/auth/totp/setup
+func (a *AuthManager) handleTOTPSetup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.enabled {
+		http.Error(w, "Login is not enabled (start webmux with -auth)", http.StatusBadRequest)
+		return
+	}
+	if a.sessionUser(r) != "" {
+		http.Error(w, "Forbidden: two-factor authentication applies to the shared password only", http.StatusForbidden)
+		return
+	}
+	if a.currentConfig().TOTPSecret != "" {
+		http.Error(w, "Two-factor authentication is already enabled; disable it first", http.StatusConflict)
+		return
+	}
+
+	secret := generateTOTPSecret()
+	a.mu.Lock()
+	a.totp.pendingSecret = secret
+	a.totp.pendingExpires = time.Now().Add(totpSetupTTL)
+	a.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret": secret,
+		"uri":    totpURI(secret),
+	})
+}
+
+// handleTOTPConfirm completes enrollment once a code from the new secret verifies,
+// returning the recovery codes (shown once, stored hashed)
+// POST /api/auth/totp/confirm {"code": "123456"}
+func (a *AuthManager) handleTOTPConfirm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.enabled {
+		http.Error(w, "Login is not enabled (start webmux with -auth)", http.StatusBadRequest)
+		return
+	}
+	if a.sessionUser(r) != "" {
+		http.Error(w, "Forbidden: two-factor authentication applies to the shared password only", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a.currentConfig() // pick up outside changes before modifying
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.totp.pendingSecret == "" || time.Now().After(a.totp.pendingExpires) {
+		a.totp.pendingSecret = ""
+		http.Error(w, "No enrollment in progress; start setup again", http.StatusBadRequest)
+		return
+	}
+	counter, ok := matchTOTP(a.totp.pendingSecret, req.Code, time.Now())
+	if !ok {
+		http.Error(w, "Invalid authentication code", http.StatusForbidden)
+		return
+	}
+
+	codes, hashes := newRecoveryCodes()
+	a.config.TOTPSecret = a.totp.pendingSecret
+	a.config.RecoveryCodes = hashes
+	if err := a.saveConfig(); err != nil {
+		a.config.TOTPSecret = ""
+		a.config.RecoveryCodes = nil
+		http.Error(w, "Failed to save auth config: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	a.totp.pendingSecret = ""
+	a.totp.lastCounter = counter
+	log.Printf("Two-factor authentication enabled from %s", clientDescription(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":        "enabled",
+		"recoveryCodes": codes,
+	})
+}
+
+// runResetTOTP removes the TOTP secret and recovery codes from the local auth config
+func runResetTOTP() error {
+	config, err := LoadAuthConfig()
+	if err != nil {
+		return err
+	}
+	if config == nil || config.TOTPSecret == "" {
+		fmt.Fprintln(os.Stderr, "Two-factor authentication is not enabled")
+		return nil
+	}
+
+	config.TOTPSecret = ""
+	config.RecoveryCodes = nil
+	if err := SaveAuthConfig(config); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Two-factor authentication reset in %s\n", authFilePath())
+	return nil
+}
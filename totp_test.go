@@ -0,0 +1,81 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 test key from RFC 6238 appendix B ("12345678901234567890")
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := totpCode(rfc6238Secret, uint64(tt.unix/totpPeriod))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+	if _, err := totpCode("not base32!", 1); err == nil {
+		t.Error("totpCode accepted an invalid secret")
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0) // step 37037037, code 050471
+	tests := []struct {
+		code    string
+		counter uint64
+		ok      bool
+	}{
+		{"050471", 37037037, true},
+		{" 050 471 ", 37037037, true},
+		{"081804", 37037036, true}, // one step earlier
+		{"287082", 0, false},       // far outside the skew
+		{"05047", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		counter, ok := matchTOTP(rfc6238Secret, tt.code, now)
+		if ok != tt.ok || counter != tt.counter {
+			t.Errorf("matchTOTP(%q) = %d, %v; want %d, %v", tt.code, counter, ok, tt.counter, tt.ok)
+		}
+	}
+	// The same code is still accepted one step later, but not two
+	if _, ok := matchTOTP(rfc6238Secret, "050471", now.Add(totpPeriod*time.Second)); !ok {
+		t.Error("code rejected one step later")
+	}
+	if _, ok := matchTOTP(rfc6238Secret, "050471", now.Add(2*totpPeriod*time.Second)); ok {
+		t.Error("code accepted two steps later")
+	}
+}
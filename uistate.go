@@ -0,0 +1,300 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+// SECTION: UI STATE
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// UI state persistence
+const (
+	uiStateFile        = "ui-state.json"
+	uiStateHistoryFile = "ui-state-history.json"
+	maxUIStateHistory  = 20
+	uiStateCoalesce    = 5 * time.Second // Layout changes this close together are one undo step
+)
+
+// validLayouts are the group layouts the UI can draw
+var validLayouts = []string{"single", "horizontal", "vertical", "grid"}
+
+// UIStateSnapshot is a previous layout kept for undo
+type UIStateSnapshot struct {
+	SavedAt time.Time `json:"savedAt"`
+	State   *UIState  `json:"state"`
+}
+
+// sanitizeUIState drops malformed entries from a state read from disk or sent
+// by a browser: duplicate groups, sessions in more than one group, unknown
+// layouts and out-of-range split ratios
+func sanitizeUIState(state *UIState) {
+	seenGroups := make(map[string]bool)
+	seenSessions := make(map[string]bool)
+	groups := make([]UIGroup, 0, len(state.Groups))
+	for _, group := range state.Groups {
+		if group.ID == "" || seenGroups[group.ID] {
+			continue
+		}
+		ids := make([]string, 0, len(group.SessionIDs))
+		for _, sid := range group.SessionIDs {
+			if !seenSessions[sid] {
+				seenSessions[sid] = true
+				ids = append(ids, sid)
+			}
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		validRatios := !slices.ContainsFunc(group.SplitRatio, func(r float64) bool { return !(r > 0 && r < 1) })
+		if len(ids) != len(group.SessionIDs) || !slices.Contains(validLayouts, group.Layout) || !validRatios {
+			group.Layout = getDefaultLayout(len(ids))
+			group.SplitRatio = getDefaultSplitRatio(len(ids))
+			group.CellMapping = nil
+		}
+		switch group.ExpandedQuadrant {
+		case "", "top", "bottom", "left", "right":
+		default:
+			group.ExpandedQuadrant = ""
+		}
+		group.SessionIDs = ids
+		seenGroups[group.ID] = true
+		groups = append(groups, group)
+	}
+	state.Groups = groups
+	if state.GroupCounter < 0 {
+		state.GroupCounter = 0
+	}
+}
+
+// layoutOf returns what undo restores of a state: its groups, order and names,
+// but not which group is active or whether the sidebar is collapsed
+func layoutOf(state *UIState) []byte {
+	if state == nil {
+		return nil
+	}
+	layout := *state
+	layout.ActiveGroupID = ""
+	layout.SidebarCollapsed = false
+	layout.Revision = 0
+	data, _ := json.Marshal(layout)
+	return data
+}
+
+// setUIState replaces the UI state, keeping the previous layout for undo, and
+// saves it
+func (s *Server) setUIState(state *UIState) {
+	s.uiStateMu.Lock()
+	defer s.uiStateMu.Unlock()
+
+	if old := s.uiState; old != nil && len(old.Groups) > 0 && !bytes.Equal(layoutOf(old), layoutOf(state)) {
+		// A drag or resize sends many states; keep only the one before it started
+		if time.Since(s.uiStateChangedAt) > uiStateCoalesce || len(s.uiHistory) == 0 {
+			s.uiHistory = append(s.uiHistory, UIStateSnapshot{SavedAt: time.Now(), State: old})
+			if len(s.uiHistory) > maxUIStateHistory {
+				s.uiHistory = slices.Delete(s.uiHistory, 0, len(s.uiHistory)-maxUIStateHistory)
+			}
+			s.saveUIStateHistoryLocked()
+		}
+		s.uiStateChangedAt = time.Now()
+	}
+	if s.uiState != nil {
+		state.Revision = s.uiState.Revision
+	}
+	s.uiState = state
+	s.saveUIStateLocked()
+}
+
+// undoUIState restores the most recent earlier layout that still differs from
+// the current one once sessions that are gone are dropped
+func (s *Server) undoUIState() (*UIState, error) {
+	s.uiStateMu.Lock()
+	defer s.uiStateMu.Unlock()
+
+	current := layoutOf(s.uiState)
+	for len(s.uiHistory) > 0 {
+		prev := s.uiHistory[len(s.uiHistory)-1]
+		s.uiHistory = s.uiHistory[:len(s.uiHistory)-1]
+		state := s.validateUIState(prev.State)
+		if bytes.Equal(layoutOf(state), current) {
+			continue
+		}
+		// Stay on the active group if it still exists
+		if s.uiState != nil && slices.Contains(state.GroupOrder, s.uiState.ActiveGroupID) {
+			state.ActiveGroupID = s.uiState.ActiveGroupID
+		}
+		if s.uiState != nil {
+			state.SidebarCollapsed = s.uiState.SidebarCollapsed
+			state.Revision = s.uiState.Revision
+		}
+		s.uiState = state
+		s.uiStateChangedAt = time.Time{}
+		s.changedUIStateLocked()
+		s.saveUIStateHistoryLocked()
+		return state, nil
+	}
+	s.saveUIStateHistoryLocked()
+	return nil, fmt.Errorf("nothing to undo")
+}
+
+// saveUIStateLocked writes the UI state if it changed (uiStateMu must be held)
+func (s *Server) saveUIStateLocked() {
+	if s.store == nil || s.uiState == nil {
+		return
+	}
+	data, err := json.MarshalIndent(s.uiState, "", "  ")
+	if err != nil || bytes.Equal(data, s.uiStateWritten) {
+		return
+	}
+	if err := s.store.WriteFile(userStateFile(s.user, uiStateFile), data); err != nil {
+		log.Printf("UI state: %v", err)
+		return
+	}
+	s.uiStateWritten = data
+}
+
+// changedUIStateLocked saves a layout the server changed itself, so browsers
+// reload it instead of saving theirs over it (uiStateMu must be held)
+func (s *Server) changedUIStateLocked() {
+	s.uiState.Revision++
+	s.saveUIStateLocked()
+}
+
+// saveUIStateHistoryLocked writes the undo history (uiStateMu must be held)
+func (s *Server) saveUIStateHistoryLocked() {
+	if s.store == nil {
+		return
+	}
+	name := userStateFile(s.user, uiStateHistoryFile)
+	if len(s.uiHistory) == 0 {
+		if err := s.store.Remove(name); err != nil {
+			log.Printf("UI state: %v", err)
+		}
+		return
+	}
+	data, _ := json.Marshal(s.uiHistory)
+	if err := s.store.WriteFile(name, data); err != nil {
+		log.Printf("UI state: %v", err)
+	}
+}
+
+// loadUIState restores the saved UI state and undo history, reconciled with
+// the sessions that are running now
+func (s *Server) loadUIState() {
+	if s.store == nil {
+		return
+	}
+	var state UIState
+	name := userStateFile(s.user, uiStateFile)
+	data, err := s.store.ReadFile(name)
+	if err == nil {
+		err = json.Unmarshal(data, &state)
+	}
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("UI state: %s: %v; starting with an empty layout", name, err)
+		}
+		return
+	}
+	sanitizeUIState(&state)
+
+	var history []UIStateSnapshot
+	name = userStateFile(s.user, uiStateHistoryFile)
+	if data, err := s.store.ReadFile(name); err == nil {
+		if err := json.Unmarshal(data, &history); err != nil {
+			log.Printf("UI state: %s: %v; discarding undo history", name, err)
+			history = nil
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("UI state: %v", err)
+	}
+	history = slices.DeleteFunc(history, func(h UIStateSnapshot) bool { return h.State == nil })
+	for _, h := range history {
+		sanitizeUIState(h.State)
+	}
+	if len(history) > maxUIStateHistory {
+		history = history[len(history)-maxUIStateHistory:]
+	}
+
+	s.uiStateMu.Lock()
+	defer s.uiStateMu.Unlock()
+	s.uiState = s.validateUIState(&state)
+	s.uiHistory = history
+	s.uiStateWritten = data
+	s.saveUIStateLocked()
+}
+
+// loadUIStates restores the default user's UI state and, with -multi-user,
+// that of every user who has one saved
+func (s *Server) loadUIStates() {
+	s.loadUIState()
+	if !s.multiUser {
+		return
+	}
+	paths, _ := filepath.Glob(filepath.Join(s.store.dir, "users", "*", uiStateFile))
+	for _, path := range paths {
+		if name := filepath.Base(filepath.Dir(path)); validUserName(name) {
+			s.tenant(name) // Loads its state
+		}
+	}
+}
+
+// handleUIStateHistory lists the layouts undo can return to
+// GET /api/ui-state/history
+func (s *Server) handleUIStateHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.uiStateMu.RLock()
+	history := slices.Clone(s.uiHistory)
+	s.uiStateMu.RUnlock()
+
+	// Newest first, as each would be after undoing to it
+	entries := make([]UIStateSnapshot, 0, len(history))
+	for _, h := range slices.Backward(history) {
+		entries = append(entries, UIStateSnapshot{SavedAt: h.SavedAt, State: s.validateUIState(h.State)})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// handleUIStateUndo restores the previous layout
+// POST /api/ui-state/undo
+func (s *Server) handleUIStateUndo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	state, err := s.undoUIState()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
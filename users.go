@@ -0,0 +1,343 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// SECTION: USERS
+
+// Access levels to a session
+const (
+	AccessView    = "view"    // watch the terminal
+	AccessControl = "control" // also type into it and send keys
+	AccessOwner   = "owner"   // also rename, close, share and grant access
+)
+
+// SessionACL maps other users to the access a session's owner granted them
+type SessionACL map[string]string
+
+// userNamePattern limits user names to what is safe in paths and Unix account names
+var userNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]{0,31}$`)
+
+// validUserName reports whether name can be used as a webmux user
+func validUserName(name string) bool {
+	return userNamePattern.MatchString(name)
+}
+
+// isAdmin reports whether a request may use admin endpoints and the admin scope.
+// Without -multi-user everyone shares one namespace; with it, only requests without
+// a named user (the shared password, or no auth) administer the server.
+func isAdmin(r *http.Request, multiUser bool) bool {
+	return !multiUser || requestUser(r) == ""
+}
+
+// accessFor returns user's access to the session ("" = none).
+// Must be called with sm.mu held.
+func (s *Session) accessFor(user string) string {
+	if s.Owner == user {
+		return AccessOwner
+	}
+	return s.ACL[user]
+}
+
+// SessionAccess returns user's access to a session ("" if none or no such session)
+func (sm *SessionManager) SessionAccess(id, user string) string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[id]
+	if !ok {
+		return ""
+	}
+	return session.accessFor(user)
+}
+
+// SessionListing is a session as listed for one user
+type SessionListing struct {
+	*Session
+	Access string `json:"access"`
+}
+
+// ListSessionsFor returns snapshots of the sessions user can see
+func (sm *SessionManager) ListSessionsFor(user string) []SessionListing {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	sessions := make([]SessionListing, 0, len(sm.sessions))
+	for _, s := range sm.sessions {
+		access := s.accessFor(user)
+		if access == "" {
+			continue
+		}
+		snapshot := *s
+		snapshot.ACL = maps.Clone(s.ACL)
+		sessions = append(sessions, SessionListing{Session: &snapshot, Access: access})
+	}
+	return sessions
+}
+
+// SetSessionACL replaces the users granted access to a session
+func (sm *SessionManager) SetSessionACL(id string, acl SessionACL) error {
+	clean := make(SessionACL, len(acl))
+	for name, access := range acl {
+		if !validUserName(name) {
+			return fmt.Errorf("invalid user name %q", name)
+		}
+		switch access {
+		case AccessView, AccessControl:
+			clean[name] = access
+		case "", "none":
+			// Omitted users have no access
+		default:
+			return fmt.Errorf("invalid access %q for %s (use view, control or none)", access, name)
+		}
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, ok := sm.sessions[id]
+	if !ok {
+		return fmt.Errorf("session not found: %s", id)
+	}
+	delete(clean, session.Owner)
+	if len(clean) == 0 {
+		clean = nil
+	}
+	session.ACL = clean
+	sm.setTmuxOption(session, tmuxOptACL, encodeSessionACL(clean))
+	return nil
+}
+
+// userSocketPath returns the tmux socket for a named user's sessions.
+// Unix users get tmux's own per-uid directory, which tmux creates and checks itself.
+func (sm *SessionManager) userSocketPath(user string) string {
+	if sm.unixUsers {
+		if account, err := lookupUnixAccount(user); err == nil {
+			return filepath.Join("/tmp", fmt.Sprintf("tmux-%d", account.uid), "webmux")
+		}
+	}
+	dir := filepath.Join(xdgDataHome(), "webmux", "users", user)
+	os.MkdirAll(dir, 0700)
+	return filepath.Join(dir, "tmux.sock")
+}
+
+// userStateFile returns the state store name of a per-user file ("" = the default user)
+func userStateFile(user, name string) string {
+	if user == "" {
+		return name
+	}
+	return filepath.Join("users", user, name)
+}
+
+// unixAccount is the system account a user's shells run as (-unix-users)
+type unixAccount struct {
+	name   string
+	uid    uint32
+	gid    uint32
+	groups []uint32
+	home   string
+}
+
+// lookupUnixAccount finds the system account named after a webmux user
+func lookupUnixAccount(name string) (*unixAccount, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, fmt.Errorf("no Unix account for user %s: %w", name, err)
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %s: unsupported uid %q", name, u.Uid)
+	}
+	if uid == 0 {
+		return nil, fmt.Errorf("refusing to run sessions for %s as root", name)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %s: unsupported gid %q", name, u.Gid)
+	}
+	account := &unixAccount{name: u.Username, uid: uint32(uid), gid: uint32(gid), home: u.HomeDir}
+	if ids, err := u.GroupIds(); err == nil {
+		for _, id := range ids {
+			if g, err := strconv.ParseUint(id, 10, 32); err == nil {
+				account.groups = append(account.groups, uint32(g))
+			}
+		}
+	}
+	return account, nil
+}
+
+// unixUserEnv are variables passed from webmux's environment to other users' shells
+var unixUserEnv = []string{"PATH", "LANG", "LC_ALL", "TERM", "TZ"}
+
+// apply makes cmd run as the account, with its home directory and a clean environment
+func (a *unixAccount) apply(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: a.uid, Gid: a.gid, Groups: a.groups}
+	cmd.Dir = a.home
+	cmd.Env = []string{"HOME=" + a.home, "USER=" + a.name, "LOGNAME=" + a.name}
+	for _, key := range unixUserEnv {
+		if value, ok := os.LookupEnv(key); ok {
+			cmd.Env = append(cmd.Env, key+"="+value)
+		}
+	}
+}
+
+// accountCheckScript repeats the file checks of SessionOptions.validate in a shell
+// running as the account: $1 is the working directory, $2 the command and $3 the shell
+const accountCheckScript = `
+if [ -n "$1" ] && ! cd "$1" 2>/dev/null; then echo "working directory is not accessible to $USER: $1"; exit 1; fi
+if [ -n "$2" ] && ! command -v "$2" >/dev/null 2>&1; then echo "command not found for $USER: $2"; exit 1; fi
+if [ -n "$3" ] && ! [ -x "$3" ]; then echo "shell is not executable by $USER: $3"; exit 1; fi
+`
+
+// checkOptions rejects a working directory, command or shell the account cannot
+// use. validate runs as webmux (root under -unix-users), which can use them all.
+func (a *unixAccount) checkOptions(opts SessionOptions) error {
+	var command string
+	if len(opts.Command) > 0 {
+		command = opts.Command[0]
+	}
+	if opts.Cwd == "" && command == "" && opts.Shell == "" {
+		return nil
+	}
+	cmd := exec.Command("/bin/sh", "-c", accountCheckScript, "sh", opts.Cwd, command, opts.Shell)
+	a.apply(cmd)
+	cmd.Dir = "/"
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return errors.New(msg)
+		}
+		return fmt.Errorf("checking session options as %s: %w", a.name, err)
+	}
+	return nil
+}
+
+// tenant returns the server state (settings, UI state, scratch pad, marked files
+// and clipboard) for user, creating it on first use. Without -multi-user, and for
+// the default user, this is s itself. Tenants share the server's file sandbox
+// unless -unix-users confines them: their shells run as the same account anyway.
+func (s *Server) tenant(user string) *Server {
+	if !s.multiUser || user == "" {
+		return s
+	}
+	s.tenantsMu.Lock()
+	defer s.tenantsMu.Unlock()
+
+	if t, ok := s.tenants[user]; ok {
+		return t
+	}
+	t := &Server{
+		root:            s,
+		manager:         s.manager,
+		auth:            s.auth,
+		files:           s.files,
+		shares:          s.shares,
+		audit:           s.audit,
+		store:           s.store,
+		resurrect:       s.resurrect,
+		snapshots:       s.snapshots,
+		limiter:         s.limiter,
+		readOnly:        s.readOnly,
+		multiUser:       true,
+		user:            user,
+		uploadDir:       filepath.Join(s.uploadDir, user),
+		settings:        LoadSettings(user),
+		scratchSubs:     make(map[chan string]struct{}),
+		markedFiles:     make([]MarkedFile, 0),
+		markedSubs:      make(map[chan string]struct{}),
+		clipboardPolicy: s.clipboardPolicy,
+		uiState: &UIState{
+			Groups:     make([]UIGroup, 0),
+			GroupOrder: make([]string, 0),
+		},
+	}
+	t.applyRedactionSettings()
+	// Unix users only see their own home directory and uploads
+	if s.manager.unixUsers {
+		roots := []string{t.uploadDir}
+		if account, err := lookupUnixAccount(user); err == nil {
+			roots = []string{account.home, t.uploadDir}
+		}
+		files, err := s.files.Within(roots...)
+		if err != nil {
+			log.Printf("User %s: confining file access failed: %v", user, err)
+			files = &FileSandbox{roots: []string{filepath.Clean(t.uploadDir)}, deny: s.files.deny}
+		}
+		t.files = files
+	}
+	if s.tenants == nil {
+		s.tenants = make(map[string]*Server)
+	}
+	t.loadUIState()
+	s.tenants[user] = t
+	log.Printf("Created namespace for user %s", user)
+	return t
+}
+
+// eachTenant calls fn for the default server and every user's server
+func (s *Server) eachTenant(fn func(*Server)) {
+	s.tenantsMu.Lock()
+	tenants := make([]*Server, 0, len(s.tenants)+1)
+	tenants = append(tenants, s)
+	for _, t := range s.tenants {
+		tenants = append(tenants, t)
+	}
+	s.tenantsMu.Unlock()
+
+	for _, t := range tenants {
+		fn(t)
+	}
+}
+
+// userServer returns user's server from any tenant, going through the default server
+func (s *Server) userServer(user string) *Server {
+	if s.root != nil {
+		return s.root.tenant(user)
+	}
+	return s.tenant(user)
+}
+
+// forUser adapts a Server handler to run against the requesting user's state
+func (s *Server) forUser(h func(*Server, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h(s.tenant(requestUser(r)), w, r)
+	}
+}
+
+// sessionAccess returns this server's user's access to a session ("" = none)
+func (s *Server) sessionAccess(id string) string {
+	return s.manager.SessionAccess(id, s.user)
+}
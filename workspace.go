@@ -0,0 +1,638 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+// SECTION: WORKSPACES
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Readiness checks wait this long unless they set a timeout (at most maxReadyTimeout)
+const (
+	defaultReadyTimeout = time.Minute
+	maxReadyTimeout     = 10 * time.Minute
+	readyPollInterval   = 250 * time.Millisecond
+)
+
+// workspaceExtensions are the file types workspaces are read from, in lookup order
+var workspaceExtensions = []string{".json", ".yaml", ".yml"}
+
+// Workspace declares a set of sessions and how they are grouped in the sidebar
+type Workspace struct {
+	Name     string             `json:"name"`
+	Sessions []WorkspaceSession `json:"sessions"`
+	Groups   []WorkspaceGroup   `json:"groups,omitempty"`
+}
+
+// WorkspaceSession is one session of a workspace
+type WorkspaceSession struct {
+	Name      string            `json:"name"`
+	Profile   string            `json:"profile,omitempty"` // Applied first; the fields below override it
+	Cwd       string            `json:"cwd,omitempty"`     // ~ is the owner's home
+	Command   []string          `json:"command,omitempty"` // Run instead of the shell
+	Env       map[string]string `json:"env,omitempty"`
+	DependsOn []string          `json:"dependsOn,omitempty"` // Sessions that must be ready before this one starts
+	Ready     *ReadyCheck       `json:"ready,omitempty"`     // When this session counts as ready (default: once started)
+}
+
+// ReadyCheck decides when a session that others depend on is ready
+type ReadyCheck struct {
+	Output  string `json:"output,omitempty"`  // Regexp to wait for in the pane
+	Port    int    `json:"port,omitempty"`    // Wait until this localhost TCP port accepts connections
+	Delay   string `json:"delay,omitempty"`   // Fixed wait, e.g. "2s"
+	Timeout string `json:"timeout,omitempty"` // Give up after this long (default 1m)
+
+	output  *regexp.Regexp
+	delay   time.Duration
+	timeout time.Duration
+}
+
+// WorkspaceGroup is a sidebar group, with the layout fields of UIGroup
+type WorkspaceGroup struct {
+	Name             string    `json:"name"`
+	Sessions         []string  `json:"sessions"` // Session names, up to 4
+	Layout           string    `json:"layout,omitempty"`
+	ExpandedQuadrant string    `json:"expandedQuadrant,omitempty"`
+	SplitRatio       []float64 `json:"splitRatio,omitempty"`
+	CellMapping      []int     `json:"cellMapping,omitempty"`
+}
+
+// WorkspaceResult reports what applying a workspace did
+type WorkspaceResult struct {
+	Workspace string             `json:"workspace"`
+	Created   []*Session         `json:"created"`
+	Existing  []string           `json:"existing,omitempty"` // Sessions that were already running
+	Failed    []WorkspaceFailure `json:"failed,omitempty"`
+
+	limited *rateLimitError // set when sessions were refused by the sessions rate limit
+}
+
+// WorkspaceFailure is a session that could not be started
+type WorkspaceFailure struct {
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// workspacesDir returns the directory a user's workspace files are kept in
+func workspacesDir(user string) string {
+	if user != "" {
+		return filepath.Join(xdgConfigHome(), "webmux", "users", user, "workspaces")
+	}
+	return filepath.Join(xdgConfigHome(), "webmux", "workspaces")
+}
+
+// parseWorkspace reads a workspace from JSON or YAML; name is used if it sets none
+func parseWorkspace(data []byte, name string) (*Workspace, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		v, err := parseYAML(data)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var ws Workspace
+	if err := dec.Decode(&ws); err != nil {
+		return nil, err
+	}
+	if ws.Name == "" {
+		ws.Name = name
+	}
+	if err := ws.validate(); err != nil {
+		return nil, err
+	}
+	return &ws, nil
+}
+
+// loadWorkspaceFile reads a workspace file, named after the file unless it sets a name
+func loadWorkspaceFile(path string) (*Workspace, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ws, err := parseWorkspace(data, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return ws, nil
+}
+
+// findWorkspace loads a user's workspace by name from their workspaces dir,
+// falling back to the shared one
+func findWorkspace(user, name string) (*Workspace, error) {
+	if !validProfileName.MatchString(name) {
+		return nil, fmt.Errorf("invalid workspace name %q", name)
+	}
+	dirs := []string{workspacesDir("")}
+	if user != "" {
+		dirs = []string{workspacesDir(user), workspacesDir("")}
+	}
+	for _, dir := range dirs {
+		for _, ext := range workspaceExtensions {
+			path := filepath.Join(dir, name+ext)
+			if _, err := os.Stat(path); err == nil {
+				return loadWorkspaceFile(path)
+			}
+		}
+	}
+	return nil, fmt.Errorf("unknown workspace %q: %w", name, fs.ErrNotExist)
+}
+
+// validate checks a workspace and compiles its readiness checks
+func (ws *Workspace) validate() error {
+	if !validProfileName.MatchString(ws.Name) {
+		return fmt.Errorf("invalid workspace name %q", ws.Name)
+	}
+	if len(ws.Sessions) == 0 {
+		return fmt.Errorf("workspace %s has no sessions", ws.Name)
+	}
+	names := make(map[string]bool)
+	for _, sess := range ws.Sessions {
+		if strings.TrimSpace(sess.Name) == "" {
+			return fmt.Errorf("every session needs a name")
+		}
+		if names[sess.Name] {
+			return fmt.Errorf("duplicate session %q", sess.Name)
+		}
+		names[sess.Name] = true
+	}
+	for i := range ws.Sessions {
+		sess := &ws.Sessions[i]
+		for _, dep := range sess.DependsOn {
+			if !names[dep] || dep == sess.Name {
+				return fmt.Errorf("session %s: unknown dependency %q", sess.Name, dep)
+			}
+		}
+		if err := sess.Ready.compile(); err != nil {
+			return fmt.Errorf("session %s: ready: %w", sess.Name, err)
+		}
+	}
+	if _, err := ws.startOrder(); err != nil {
+		return err
+	}
+
+	grouped := make(map[string]bool)
+	for _, group := range ws.Groups {
+		if len(group.Sessions) == 0 || len(group.Sessions) > 4 {
+			return fmt.Errorf("group %q must have 1 to 4 sessions", group.Name)
+		}
+		for _, name := range group.Sessions {
+			if !names[name] {
+				return fmt.Errorf("group %q: unknown session %q", group.Name, name)
+			}
+			if grouped[name] {
+				return fmt.Errorf("session %q is in more than one group", name)
+			}
+			grouped[name] = true
+		}
+		if group.Layout != "" && !slices.Contains(validLayouts, group.Layout) {
+			return fmt.Errorf("group %q: layout must be one of %s", group.Name, strings.Join(validLayouts, ", "))
+		}
+		if slices.ContainsFunc(group.SplitRatio, func(r float64) bool { return !(r > 0 && r < 1) }) {
+			return fmt.Errorf("group %q: split ratios must be between 0 and 1", group.Name)
+		}
+	}
+	return nil
+}
+
+// compile parses a readiness check's regexp and durations
+func (c *ReadyCheck) compile() error {
+	if c == nil {
+		return nil
+	}
+	var err error
+	if c.Output != "" {
+		if c.output, err = regexp.Compile(c.Output); err != nil {
+			return err
+		}
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("invalid port %d", c.Port)
+	}
+	if c.Delay != "" {
+		if c.delay, err = time.ParseDuration(c.Delay); err != nil || c.delay < 0 || c.delay > maxReadyTimeout {
+			return fmt.Errorf("invalid delay %q", c.Delay)
+		}
+	}
+	c.timeout = defaultReadyTimeout
+	if c.Timeout != "" {
+		if c.timeout, err = time.ParseDuration(c.Timeout); err != nil || c.timeout <= 0 || c.timeout > maxReadyTimeout {
+			return fmt.Errorf("invalid timeout %q (at most %s)", c.Timeout, maxReadyTimeout)
+		}
+	}
+	return nil
+}
+
+// startOrder returns the session indexes so each comes after its
+// dependencies, otherwise keeping the declared order
+func (ws *Workspace) startOrder() ([]int, error) {
+	index := make(map[string]int, len(ws.Sessions))
+	for i, sess := range ws.Sessions {
+		index[sess.Name] = i
+	}
+	order := make([]int, 0, len(ws.Sessions))
+	state := make([]int, len(ws.Sessions)) // 0 = new, 1 = visiting, 2 = done
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case 1:
+			return fmt.Errorf("dependency cycle through session %s", ws.Sessions[i].Name)
+		case 2:
+			return nil
+		}
+		state[i] = 1
+		for _, dep := range ws.Sessions[i].DependsOn {
+			if err := visit(index[dep]); err != nil {
+				return err
+			}
+		}
+		state[i] = 2
+		order = append(order, i)
+		return nil
+	}
+	for i := range ws.Sessions {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// waitReady blocks until a session passes its readiness check
+func (s *Server) waitReady(ctx context.Context, session *Session, check *ReadyCheck) error {
+	if check == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, check.timeout)
+	defer cancel()
+	if check.delay > 0 {
+		select {
+		case <-time.After(check.delay):
+		case <-ctx.Done():
+			return fmt.Errorf("not ready after %s", check.timeout)
+		}
+	}
+	ticker := time.NewTicker(readyPollInterval)
+	defer ticker.Stop()
+	for {
+		if _, ok := s.manager.GetSession(session.ID); !ok {
+			return fmt.Errorf("session exited before it was ready")
+		}
+		ready := true
+		if check.Port > 0 {
+			conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(check.Port)), time.Second)
+			if err == nil {
+				conn.Close()
+			}
+			ready = err == nil
+		}
+		if ready && check.output != nil {
+			out, err := exec.Command("tmux", "-S", session.tmuxSocket, "capture-pane", "-p", "-J", "-S", "-", "-t", session.tmuxSession).Output()
+			ready = err == nil && check.output.Match(out)
+		}
+		if ready {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("not ready after %s", check.timeout)
+		}
+	}
+}
+
+// applyWorkspace starts the workspace's sessions that are not already running,
+// in dependency order, and arranges them into its groups. r is the request
+// that asked for it (nil for -workspace), for the audit log.
+func (s *Server) applyWorkspace(ctx context.Context, ws *Workspace, r *http.Request) *WorkspaceResult {
+	s.workspaceMu.Lock()
+	defer s.workspaceMu.Unlock()
+
+	result := &WorkspaceResult{Workspace: ws.Name, Created: make([]*Session, 0)}
+	running := make(map[string]*Session)
+	for _, session := range s.manager.ListSessions() {
+		if session.Owner == s.user && session.Workspace == ws.Name {
+			running[session.Name] = session
+		}
+	}
+
+	order, _ := ws.startOrder()
+	started := make(map[string]*Session)
+	readiness := make(map[string]error)
+	waitFor := func(name string) error {
+		if err, done := readiness[name]; done {
+			return err
+		}
+		var err error
+		if session := started[name]; session == nil {
+			err = fmt.Errorf("not started")
+		} else {
+			spec := ws.Sessions[slices.IndexFunc(ws.Sessions, func(w WorkspaceSession) bool { return w.Name == name })]
+			err = s.waitReady(ctx, session, spec.Ready)
+		}
+		readiness[name] = err
+		return err
+	}
+
+	for _, i := range order {
+		spec := ws.Sessions[i]
+		if session, ok := running[spec.Name]; ok {
+			started[spec.Name] = session
+			result.Existing = append(result.Existing, session.ID)
+			continue
+		}
+		var err error
+		for _, dep := range spec.DependsOn {
+			if depErr := waitFor(dep); depErr != nil {
+				err = fmt.Errorf("dependency %s: %v", dep, depErr)
+				break
+			}
+		}
+		if err == nil {
+			if err = s.chargeSession(r); err != nil {
+				errors.As(err, &result.limited)
+			}
+		}
+		var session *Session
+		if err == nil {
+			session, err = s.startWorkspaceSession(ws.Name, spec)
+		}
+		if err != nil {
+			log.Printf("Workspace %s: session %s: %v", ws.Name, spec.Name, err)
+			result.Failed = append(result.Failed, WorkspaceFailure{Name: spec.Name, Error: err.Error()})
+			continue
+		}
+		started[spec.Name] = session
+		result.Created = append(result.Created, session)
+		s.audit.Record(r, AuditSessionCreate, session.ID, map[string]any{"name": session.Name, "workspace": ws.Name})
+	}
+
+	s.arrangeWorkspace(ws, started)
+	if len(result.Created) > 0 {
+		s.resurrect.requestSave()
+	}
+	log.Printf("Workspace %s: started %d session(s), %d already running, %d failed",
+		ws.Name, len(result.Created), len(result.Existing), len(result.Failed))
+	return result
+}
+
+// startWorkspaceSession creates one session of a workspace
+func (s *Server) startWorkspaceSession(workspace string, spec WorkspaceSession) (*Session, error) {
+	var opts SessionOptions
+	if spec.Profile != "" {
+		var err error
+		if opts, err = s.profileOptions(spec.Profile); err != nil {
+			return nil, err
+		}
+	}
+	if spec.Cwd != "" {
+		opts.Cwd = (&SessionProfile{Cwd: spec.Cwd}).options("", s.manager.homeDir(s.user)).Cwd
+	}
+	if len(spec.Command) > 0 {
+		opts.Command = spec.Command
+	}
+	for key, value := range spec.Env {
+		if opts.Env == nil {
+			opts.Env = make(map[string]string)
+		}
+		opts.Env[key] = value
+	}
+	opts.Workspace = workspace
+	return s.manager.CreateSession(spec.Name, s.user, opts)
+}
+
+// arrangeWorkspace puts the workspace's sessions into its groups, taking them
+// out of any groups they were moved to since
+func (s *Server) arrangeWorkspace(ws *Workspace, started map[string]*Session) {
+	if len(ws.Groups) == 0 {
+		return
+	}
+	s.uiStateMu.Lock()
+	defer s.uiStateMu.Unlock()
+	if s.uiState == nil {
+		s.uiState = &UIState{Groups: make([]UIGroup, 0), GroupOrder: make([]string, 0)}
+	}
+
+	ids := make(map[string]bool)
+	for _, group := range ws.Groups {
+		for _, name := range group.Sessions {
+			if session := started[name]; session != nil {
+				ids[session.ID] = true
+			}
+		}
+	}
+	s.removeSessionsFromUIStateLocked(ids)
+
+	first := ""
+	for _, wg := range ws.Groups {
+		group := UIGroup{
+			Name:             wg.Name,
+			Layout:           wg.Layout,
+			ExpandedQuadrant: wg.ExpandedQuadrant,
+			SplitRatio:       wg.SplitRatio,
+			CellMapping:      wg.CellMapping,
+		}
+		for _, name := range wg.Sessions {
+			if session := started[name]; session != nil {
+				group.SessionIDs = append(group.SessionIDs, session.ID)
+			}
+		}
+		if len(group.SessionIDs) == 0 {
+			continue
+		}
+		// Some sessions failed to start, or the file left the layout out
+		if len(group.SessionIDs) != len(wg.Sessions) || group.Layout == "" {
+			group.Layout = getDefaultLayout(len(group.SessionIDs))
+			group.SplitRatio = getDefaultSplitRatio(len(group.SessionIDs))
+			group.CellMapping = nil
+		}
+		s.uiState.GroupCounter++
+		group.ID = fmt.Sprintf("group-%d", s.uiState.GroupCounter)
+		s.uiState.Groups = append(s.uiState.Groups, group)
+		s.uiState.GroupOrder = append(s.uiState.GroupOrder, group.ID)
+		if first == "" {
+			first = group.ID
+		}
+	}
+	sanitizeUIState(s.uiState)
+	if first != "" {
+		s.uiState.ActiveGroupID = first
+	}
+	s.changedUIStateLocked()
+}
+
+// workspaceDown closes this user's sessions that a workspace started and
+// returns their IDs
+func (s *Server) workspaceDown(name string) []string {
+	var closed []string
+	for _, session := range s.manager.ListSessions() {
+		if session.Owner != s.user || session.Workspace != name {
+			continue
+		}
+		if err := s.manager.CloseSession(session.ID); err != nil {
+			log.Printf("Workspace %s: closing %s: %v", name, session.ID, err)
+			continue
+		}
+		closed = append(closed, session.ID)
+	}
+	if len(closed) > 0 {
+		log.Printf("Workspace %s: closed %d session(s)", name, len(closed))
+	}
+	return closed
+}
+
+// handleWorkspaces lists the saved workspaces and how many of their sessions run
+// GET /api/workspaces
+func (s *Server) handleWorkspaces(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	type listing struct {
+		Name    string `json:"name"`
+		File    string `json:"file,omitempty"`
+		Running int    `json:"running"`
+	}
+	found := make(map[string]*listing)
+	dirs := []string{workspacesDir("")}
+	if s.user != "" {
+		dirs = append(dirs, workspacesDir(s.user))
+	}
+	for _, dir := range dirs {
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			name := strings.TrimSuffix(entry.Name(), ext)
+			if entry.IsDir() || !slices.Contains(workspaceExtensions, ext) || !validProfileName.MatchString(name) {
+				continue
+			}
+			found[name] = &listing{Name: name, File: filepath.Join(dir, entry.Name())}
+		}
+	}
+	for _, session := range s.manager.ListSessions() {
+		if session.Owner != s.user || session.Workspace == "" {
+			continue
+		}
+		if found[session.Workspace] == nil {
+			found[session.Workspace] = &listing{Name: session.Workspace}
+		}
+		found[session.Workspace].Running++
+	}
+
+	list := make([]*listing, 0, len(found))
+	for _, name := range slices.Sorted(maps.Keys(found)) {
+		list = append(list, found[name])
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// handleWorkspaceApply starts a workspace: a saved one by name, or one sent
+// as a JSON object or as JSON/YAML source text
+// POST /api/workspaces/apply {"name": ...} | {"workspace": {...}} | {"source": "...", "name": ...}
+func (s *Server) handleWorkspaceApply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Name      string          `json:"name"`
+		Workspace json.RawMessage `json:"workspace"`
+		Source    string          `json:"source"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var ws *Workspace
+	var err error
+	switch {
+	case len(req.Workspace) > 0:
+		ws, err = parseWorkspace(req.Workspace, req.Name)
+	case req.Source != "":
+		ws, err = parseWorkspace([]byte(req.Source), req.Name)
+	case req.Name != "":
+		ws, err = findWorkspace(s.user, req.Name)
+		if errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	default:
+		err = fmt.Errorf("name, workspace or source is required")
+	}
+	if err != nil {
+		http.Error(w, "Invalid workspace: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := s.applyWorkspace(r.Context(), ws, r)
+	w.Header().Set("Content-Type", "application/json")
+	if len(result.Created) == 0 && result.limited != nil {
+		w.Header().Set("Retry-After", result.limited.retryAfter())
+		w.WriteHeader(http.StatusTooManyRequests)
+	} else if len(result.Created) == 0 && len(result.Failed) > 0 {
+		w.WriteHeader(http.StatusInternalServerError)
+	} else if len(result.Created) > 0 {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleWorkspaceDown closes the sessions a workspace started
+// POST /api/workspaces/down {"name": ...}
+func (s *Server) handleWorkspaceDown(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !validProfileName.MatchString(req.Name) {
+		http.Error(w, "Invalid workspace name", http.StatusBadRequest)
+		return
+	}
+	closed := s.workspaceDown(req.Name)
+	for _, id := range closed {
+		s.audit.Record(r, AuditSessionClose, id, map[string]any{"workspace": req.Name})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"closed": len(closed)})
+}
@@ -0,0 +1,377 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+// SECTION: YAML
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML reads the subset of YAML used by hand-written config files: block
+// mappings and sequences, flow [lists] and {maps}, comments, and plain, single-
+// or double-quoted scalars. Anchors, tags, multi-document streams and block
+// scalars (| and >) are not supported. The result holds map[string]any, []any,
+// string, bool, float64 and nil, like encoding/json.
+func parseYAML(data []byte) (any, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(string(data), "\n") {
+		raw = strings.TrimRight(raw, " \r")
+		text := strings.TrimLeft(raw, " ")
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+		text = stripYAMLComment(text)
+		if text == "" || (len(lines) == 0 && text == "---") {
+			continue
+		}
+		lines = append(lines, yamlLine{num: i + 1, indent: len(raw) - len(strings.TrimLeft(raw, " ")), text: text})
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	p := &yamlParser{lines: lines}
+	v, err := p.block(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, p.errorf("unexpected content after the top-level value")
+	}
+	return v, nil
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	line := p.lines[min(p.pos, len(p.lines)-1)]
+	return fmt.Errorf("line %d: %s", line.num, fmt.Sprintf(format, args...))
+}
+
+// block parses the mapping or sequence starting at the current line
+func (p *yamlParser) block(indent int) (any, error) {
+	if line := p.lines[p.pos]; line.text == "-" || strings.HasPrefix(line.text, "- ") {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func (p *yamlParser) sequence(indent int) ([]any, error) {
+	list := make([]any, 0)
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		isItem := line.text == "-" || strings.HasPrefix(line.text, "- ")
+		// A list under a key at the key's indentation ends at the next key
+		if line.indent < indent || line.indent == indent && !isItem {
+			break
+		}
+		if line.indent > indent {
+			return nil, p.errorf("expected a list item")
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		if rest == "" {
+			p.pos++
+			item, err := p.nested(indent)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+			continue
+		}
+		// "- key: value" and "- - item" start a block indented to where their content is
+		itemIndent := line.indent + len(line.text) - len(rest)
+		_, _, isMap := splitYAMLKey(rest)
+		isMap = isMap && !strings.HasPrefix(rest, "[") && !strings.HasPrefix(rest, "{")
+		if isMap || rest == "-" || strings.HasPrefix(rest, "- ") {
+			p.lines[p.pos] = yamlLine{num: line.num, indent: itemIndent, text: rest}
+			item, err := p.block(itemIndent)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+			continue
+		}
+		item, err := parseYAMLValue(rest)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		list = append(list, item)
+		p.pos++
+	}
+	return list, nil
+}
+
+func (p *yamlParser) mapping(indent int) (map[string]any, error) {
+	m := make(map[string]any)
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		key, rest, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, p.errorf("expected key: value")
+		}
+		if _, dup := m[key]; dup {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		p.pos++
+		if rest == "" {
+			value, err := p.nested(indent)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+			continue
+		}
+		if rest == "|" || rest == ">" || strings.HasPrefix(rest, "|") || strings.HasPrefix(rest, ">") {
+			return nil, p.errorf("block scalars are not supported; use a quoted string")
+		}
+		value, err := parseYAMLValue(rest)
+		if err != nil {
+			p.pos--
+			return nil, p.errorf("%v", err)
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+// nested parses the value on the lines after "key:" or "-" (null if there is none)
+func (p *yamlParser) nested(parent int) (any, error) {
+	if p.pos >= len(p.lines) {
+		return nil, nil
+	}
+	next := p.lines[p.pos]
+	isItem := next.text == "-" || strings.HasPrefix(next.text, "- ")
+	// A list under a key may sit at the key's own indentation
+	if next.indent > parent || (next.indent == parent && isItem) {
+		return p.block(next.indent)
+	}
+	return nil, nil
+}
+
+// splitYAMLKey splits "key: value" (value may be empty), honoring quoted keys
+func splitYAMLKey(text string) (key, rest string, ok bool) {
+	if strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "'") {
+		end := quotedYAMLEnd(text)
+		if end < 0 || end+1 >= len(text) || text[end+1] != ':' {
+			return "", "", false
+		}
+		k, err := parseYAMLScalar(text[:end+1])
+		if err != nil {
+			return "", "", false
+		}
+		rest = text[end+2:]
+		if rest != "" && rest[0] != ' ' {
+			return "", "", false
+		}
+		return fmt.Sprint(k), strings.TrimSpace(rest), true
+	}
+	i := strings.Index(text, ": ")
+	if i < 0 {
+		if !strings.HasSuffix(text, ":") {
+			return "", "", false
+		}
+		i = len(text) - 1
+	}
+	key = strings.TrimSpace(text[:i])
+	if key == "" || strings.ContainsAny(key[:1], "[{-") {
+		return "", "", false
+	}
+	return key, strings.TrimSpace(text[i+1:]), true
+}
+
+// quotedYAMLEnd returns the index of the quote closing the string text starts with
+func quotedYAMLEnd(text string) int {
+	q := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case q == '"' && text[i] == '\\':
+			i++
+		case q == '\'' && text[i] == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == q:
+			return i
+		}
+	}
+	return -1
+}
+
+// stripYAMLComment removes a trailing # comment outside quotes
+func stripYAMLComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.ContainsRune(" [{,:-", rune(text[i-1])) {
+				quote = c
+			}
+		case c == '#' && (i == 0 || text[i-1] == ' '):
+			return strings.TrimRight(text[:i], " ")
+		}
+	}
+	return text
+}
+
+// parseYAMLValue parses an inline value: a flow collection or a scalar
+func parseYAMLValue(text string) (any, error) {
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+		v, rest, err := parseYAMLFlow(text)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("unexpected %q after %c", strings.TrimSpace(rest), text[0])
+		}
+		return v, nil
+	}
+	return parseYAMLScalar(text)
+}
+
+// parseYAMLFlow parses a [list] or {map} at the start of text and returns what follows it
+func parseYAMLFlow(text string) (any, string, error) {
+	open := text[0]
+	closing := byte(']')
+	if open == '{' {
+		closing = '}'
+	}
+	text = strings.TrimLeft(text[1:], " ")
+	list := make([]any, 0)
+	m := make(map[string]any)
+	for {
+		if text == "" {
+			return nil, "", fmt.Errorf("unterminated %c", open)
+		}
+		if text[0] == closing {
+			if open == '{' {
+				return m, text[1:], nil
+			}
+			return list, text[1:], nil
+		}
+		var item any
+		var key string
+		var err error
+		if open == '{' {
+			var k any
+			if k, text, err = parseYAMLFlowItem(text, ":"); err != nil {
+				return nil, "", err
+			}
+			if !strings.HasPrefix(text, ":") {
+				return nil, "", fmt.Errorf("expected : after %v", k)
+			}
+			key = fmt.Sprint(k)
+			text = strings.TrimLeft(text[1:], " ")
+		}
+		if item, text, err = parseYAMLFlowItem(text, string(closing)); err != nil {
+			return nil, "", err
+		}
+		if open == '{' {
+			m[key] = item
+		} else {
+			list = append(list, item)
+		}
+		text = strings.TrimLeft(text, " ")
+		if strings.HasPrefix(text, ",") {
+			text = strings.TrimLeft(text[1:], " ")
+		} else if text == "" || text[0] != closing {
+			return nil, "", fmt.Errorf("expected , or %c", closing)
+		}
+	}
+}
+
+// parseYAMLFlowItem parses one element of a flow collection, ending at a comma or stop
+func parseYAMLFlowItem(text, stop string) (any, string, error) {
+	switch text[0] {
+	case '[', '{':
+		v, rest, err := parseYAMLFlow(text)
+		return v, strings.TrimLeft(rest, " "), err
+	case '"', '\'':
+		end := quotedYAMLEnd(text)
+		if end < 0 {
+			return nil, "", fmt.Errorf("unterminated string")
+		}
+		v, err := parseYAMLScalar(text[:end+1])
+		return v, strings.TrimLeft(text[end+1:], " "), err
+	}
+	end := strings.IndexAny(text, ","+stop)
+	if end < 0 {
+		end = len(text)
+	}
+	v, err := parseYAMLScalar(strings.TrimSpace(text[:end]))
+	return v, text[end:], err
+}
+
+// parseYAMLScalar parses a quoted or plain scalar
+func parseYAMLScalar(text string) (any, error) {
+	switch {
+	case strings.HasPrefix(text, `"`):
+		if quotedYAMLEnd(text) != len(text)-1 {
+			return nil, fmt.Errorf("bad string %s", text)
+		}
+		var s string
+		if err := json.Unmarshal([]byte(text), &s); err != nil {
+			return nil, fmt.Errorf("bad string %s", text)
+		}
+		return s, nil
+	case strings.HasPrefix(text, "'"):
+		if quotedYAMLEnd(text) != len(text)-1 {
+			return nil, fmt.Errorf("bad string %s", text)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	}
+	switch text {
+	case "", "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if strings.ContainsAny(text[:1], "&*!|>%@`") {
+		return nil, fmt.Errorf("unsupported YAML %q", text)
+	}
+	if strings.ContainsAny(text[:1], "0123456789+-.") && !strings.ContainsAny(text, "xo_") {
+		if n, err := strconv.ParseFloat(text, 64); err == nil {
+			return n, nil
+		}
+	}
+	return text, nil
+}
@@ -0,0 +1,114 @@
+/* *
+ * Webmux - a browser-based terminal multiplexer
+ * Copyright (C) 2026  Webmux contributors
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want any
+	}{
+		{"empty", "# only a comment\n", nil},
+		{"scalars", `
+name: webmux   # trailing comment
+port: 8080
+ratio: -1.5
+enabled: true
+off: False
+nothing: ~
+empty:
+hex: 0x1F
+`, map[string]any{
+			"name": "webmux", "port": 8080.0, "ratio": -1.5, "enabled": true,
+			"off": false, "nothing": nil, "empty": nil, "hex": "0x1F",
+		}},
+		{"quoted", `
+double: "a # not a comment\tx"
+single: 'it''s'
+colon: "key: value"
+`, map[string]any{"double": "a # not a comment\tx", "single": "it's", "colon": "key: value"}},
+		{"nested", `
+server:
+  listen: 127.0.0.1
+  tls:
+    enabled: yes
+`, map[string]any{"server": map[string]any{
+			"listen": "127.0.0.1",
+			"tls":    map[string]any{"enabled": "yes"},
+		}}},
+		{"sequence of maps", `
+---
+- name: editor
+  command: vim
+- name: shell
+-   plain
+`, []any{
+			map[string]any{"name": "editor", "command": "vim"},
+			map[string]any{"name": "shell"},
+			"plain",
+		}},
+		{"sequence under key", `
+panes:
+- top
+- bottom
+`, map[string]any{"panes": []any{"top", "bottom"}}},
+		{"flow", `
+list: [1, "two", [3], {}]
+map: {a: 1, b: [x, y], "c d": 'e'}
+none: []
+`, map[string]any{
+			"list": []any{1.0, "two", []any{3.0}, map[string]any{}},
+			"map":  map[string]any{"a": 1.0, "b": []any{"x", "y"}, "c d": "e"},
+			"none": []any{},
+		}},
+	}
+	for _, tt := range tests {
+		got, err := parseYAML([]byte(tt.in))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []string{
+		"a:\n\tb: 1\n",
+		"base: &anchor 1\n",
+		"ref: *anchor\n",
+		"tagged: !!str 1\n",
+		"text: |\n  block\n",
+		"list: [1, 2\n",
+		"map: {a 1}\n",
+		"s: \"unterminated\n",
+		"a: 1\n- b\n",
+	}
+	for _, in := range tests {
+		if got, err := parseYAML([]byte(in)); err == nil {
+			t.Errorf("parseYAML(%q) = %#v, want an error", in, got)
+		}
+	}
+}